@@ -0,0 +1,247 @@
+// Package balancer spreads the calls to ServiceB over its instances, found
+// from a static list or DNS SRV records.
+package balancer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+	"willianszwy/FC-Tracing/pkg/logging"
+	"willianszwy/FC-Tracing/pkg/tracing"
+)
+
+const (
+	PolicyRoundRobin  = "round-robin"
+	PolicyLeastLoaded = "least-loaded"
+)
+
+// Span attributes describing the instance that served a call.
+const (
+	InstanceKey         = attribute.Key("lb.instance")
+	PolicyKey           = attribute.Key("lb.policy")
+	InstanceCountKey    = attribute.Key("lb.instances")
+	InstanceInFlightKey = attribute.Key("lb.instance.in_flight")
+)
+
+// ErrNoInstances is returned when discovery found no instance.
+var ErrNoInstances = errors.New("balancer: no instances available")
+
+var logger = logging.Package("balancer")
+
+// Resolver lists the base URLs of the instances, e.g. http://10.0.0.1:8080.
+type Resolver interface {
+	Resolve(ctx context.Context) ([]*url.URL, error)
+}
+
+// Static is a fixed list of instances.
+type Static []*url.URL
+
+func (s Static) Resolve(context.Context) ([]*url.URL, error) {
+	return s, nil
+}
+
+// SRV looks instances up as DNS SRV records of Name, e.g.
+// _http._tcp.service-b, reached with Scheme.
+type SRV struct {
+	Name   string
+	Scheme string
+	// LookupSRV defaults to net.DefaultResolver.LookupSRV.
+	LookupSRV func(ctx context.Context, service, proto, name string) (string, []*net.SRV, error)
+}
+
+func (s SRV) Resolve(ctx context.Context) ([]*url.URL, error) {
+	lookup := s.LookupSRV
+	if lookup == nil {
+		lookup = net.DefaultResolver.LookupSRV
+	}
+	_, records, err := lookup(ctx, "", "", s.Name)
+	if err != nil {
+		return nil, fmt.Errorf("balancer: lookup %s: %w", s.Name, err)
+	}
+	urls := make([]*url.URL, 0, len(records))
+	for _, r := range records {
+		host := r.Target
+		if n := len(host); n > 0 && host[n-1] == '.' {
+			host = host[:n-1]
+		}
+		urls = append(urls, &url.URL{Scheme: s.Scheme, Host: net.JoinHostPort(host, strconv.Itoa(int(r.Port)))})
+	}
+	return urls, nil
+}
+
+// Instance is one discovered instance.
+type Instance struct {
+	URL      *url.URL
+	inFlight atomic.Int64
+}
+
+// InFlight returns the number of calls the instance is serving.
+func (i *Instance) InFlight() int64 {
+	return i.inFlight.Load()
+}
+
+// Balancer picks an instance for each call.
+type Balancer struct {
+	resolver  Resolver
+	policy    string
+	mu        sync.RWMutex
+	instances []*Instance
+	next      atomic.Uint64
+}
+
+// New returns a balancer applying policy, round-robin or least-loaded, to
+// the instances of resolver. Call Refresh or Run to discover them.
+func New(resolver Resolver, policy string) (*Balancer, error) {
+	if policy != PolicyRoundRobin && policy != PolicyLeastLoaded {
+		return nil, fmt.Errorf("balancer: unknown policy %q, expected %s or %s", policy, PolicyRoundRobin, PolicyLeastLoaded)
+	}
+	return &Balancer{resolver: resolver, policy: policy}, nil
+}
+
+// Refresh replaces the instances with the ones resolved now, keeping the
+// load of those still present. On failure or an empty answer the current
+// instances are kept.
+func (b *Balancer) Refresh(ctx context.Context) error {
+	urls, err := b.resolver.Resolve(ctx)
+	if err != nil {
+		return err
+	}
+	if len(urls) == 0 {
+		return ErrNoInstances
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	known := map[string]*Instance{}
+	for _, i := range b.instances {
+		known[i.URL.String()] = i
+	}
+	instances := make([]*Instance, 0, len(urls))
+	for _, u := range urls {
+		if i, ok := known[u.String()]; ok {
+			instances = append(instances, i)
+			continue
+		}
+		instances = append(instances, &Instance{URL: u})
+	}
+	b.instances = instances
+	return nil
+}
+
+// Run refreshes the instances every interval until ctx is done.
+func (b *Balancer) Run(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := b.Refresh(ctx); err != nil {
+				logger.WarnContext(ctx, "instance discovery failed, keeping the current instances", "error", err)
+			}
+		}
+	}
+}
+
+// Instances returns the current instances.
+func (b *Balancer) Instances() []*Instance {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return append([]*Instance(nil), b.instances...)
+}
+
+// Pick returns the instance for the next call.
+func (b *Balancer) Pick() (*Instance, error) {
+	instances := b.Instances()
+	if len(instances) == 0 {
+		return nil, ErrNoInstances
+	}
+	start := int(b.next.Add(1) % uint64(len(instances)))
+	picked := instances[start]
+	if b.policy == PolicyLeastLoaded {
+		// Starting from the round-robin position spreads ties evenly.
+		for n := 1; n < len(instances); n++ {
+			i := instances[(start+n)%len(instances)]
+			if i.InFlight() < picked.InFlight() {
+				picked = i
+			}
+		}
+	}
+	return picked, nil
+}
+
+// Transport returns a RoundTripper sending each request to a picked
+// instance through base, http.DefaultTransport when nil. Placed under
+// tracing.Transport, it adds the instance to the client span.
+func (b *Balancer) Transport(base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &transport{balancer: b, base: base}
+}
+
+type transport struct {
+	balancer *Balancer
+	base     http.RoundTripper
+}
+
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	instance, err := t.balancer.Pick()
+	if err != nil {
+		if req.Body != nil {
+			req.Body.Close()
+		}
+		return nil, err
+	}
+	r := req.Clone(req.Context())
+	r.URL.Scheme, r.URL.Host, r.Host = instance.URL.Scheme, instance.URL.Host, ""
+
+	attrs := []attribute.KeyValue{
+		InstanceKey.String(instance.URL.Host),
+		PolicyKey.String(t.balancer.policy),
+		InstanceCountKey.Int(len(t.balancer.Instances())),
+		InstanceInFlightKey.Int64(instance.InFlight()),
+		semconv.URLFull(tracing.RedactURL(r.URL)),
+	}
+	if host, port, err := net.SplitHostPort(instance.URL.Host); err == nil {
+		p, _ := strconv.Atoi(port)
+		attrs = append(attrs, semconv.ServerAddress(host), semconv.ServerPort(p))
+	}
+	trace.SpanFromContext(req.Context()).SetAttributes(attrs...)
+
+	instance.inFlight.Add(1)
+	resp, err := t.base.RoundTrip(r)
+	if err != nil {
+		instance.inFlight.Add(-1)
+		return nil, err
+	}
+	resp.Body = &doneBody{ReadCloser: resp.Body, done: func() { instance.inFlight.Add(-1) }}
+	return resp, nil
+}
+
+// doneBody calls done once, when the body is closed.
+type doneBody struct {
+	io.ReadCloser
+	once sync.Once
+	done func()
+}
+
+func (b *doneBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(b.done)
+	return err
+}
@@ -0,0 +1,160 @@
+package balancer
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"willianszwy/FC-Tracing/pkg/tracing"
+)
+
+type ResolverMock struct {
+	URLs []*url.URL
+	Err  error
+}
+
+func (r *ResolverMock) Resolve(context.Context) ([]*url.URL, error) {
+	return r.URLs, r.Err
+}
+
+type RoundTripperMock struct {
+	Reqs []*http.Request
+	Err  error
+}
+
+func (m *RoundTripperMock) RoundTrip(req *http.Request) (*http.Response, error) {
+	m.Reqs = append(m.Reqs, req)
+	if m.Err != nil {
+		return nil, m.Err
+	}
+	return &http.Response{StatusCode: 200, Body: io.NopCloser(strings.NewReader("ok")), Request: req}, nil
+}
+
+func urls(hosts ...string) []*url.URL {
+	var u []*url.URL
+	for _, host := range hosts {
+		u = append(u, &url.URL{Scheme: "http", Host: host})
+	}
+	return u
+}
+
+func newBalancer(t *testing.T, policy string, hosts ...string) *Balancer {
+	b, err := New(Static(urls(hosts...)), policy)
+	assert.Nil(t, err)
+	assert.Nil(t, b.Refresh(context.Background()))
+	return b
+}
+
+func TestNew_UnknownPolicy(t *testing.T) {
+	_, err := New(Static{}, "random")
+
+	assert.ErrorContains(t, err, `unknown policy "random"`)
+}
+
+func TestPick_RoundRobin(t *testing.T) {
+	b := newBalancer(t, PolicyRoundRobin, "b1:8080", "b2:8080", "b3:8080")
+
+	var hosts []string
+	for n := 0; n < 6; n++ {
+		i, err := b.Pick()
+		assert.Nil(t, err)
+		hosts = append(hosts, i.URL.Host)
+	}
+
+	assert.Equal(t, []string{"b2:8080", "b3:8080", "b1:8080", "b2:8080", "b3:8080", "b1:8080"}, hosts)
+}
+
+func TestPick_LeastLoaded(t *testing.T) {
+	b := newBalancer(t, PolicyLeastLoaded, "b1:8080", "b2:8080", "b3:8080")
+	instances := b.Instances()
+	instances[0].inFlight.Add(2)
+	instances[1].inFlight.Add(1)
+	instances[2].inFlight.Add(3)
+
+	i, err := b.Pick()
+
+	assert.Nil(t, err)
+	assert.Equal(t, "b2:8080", i.URL.Host)
+}
+
+func TestPick_NoInstances(t *testing.T) {
+	b, err := New(Static{}, PolicyRoundRobin)
+	assert.Nil(t, err)
+
+	_, err = b.Pick()
+
+	assert.ErrorIs(t, err, ErrNoInstances)
+}
+
+func TestRefresh(t *testing.T) {
+	resolver := &ResolverMock{URLs: urls("b1:8080", "b2:8080")}
+	b, err := New(resolver, PolicyLeastLoaded)
+	assert.Nil(t, err)
+	assert.Nil(t, b.Refresh(context.Background()))
+	b.Instances()[1].inFlight.Add(1)
+
+	resolver.URLs = urls("b2:8080", "b3:8080")
+	assert.Nil(t, b.Refresh(context.Background()))
+	instances := b.Instances()
+	assert.Equal(t, "b2:8080", instances[0].URL.Host)
+	assert.Equal(t, int64(1), instances[0].InFlight())
+	assert.Equal(t, "b3:8080", instances[1].URL.Host)
+
+	resolver.Err = errors.New("lookup failed")
+	assert.NotNil(t, b.Refresh(context.Background()))
+	resolver.URLs, resolver.Err = nil, nil
+	assert.ErrorIs(t, b.Refresh(context.Background()), ErrNoInstances)
+	assert.Len(t, b.Instances(), 2)
+}
+
+func TestSRV_Resolve(t *testing.T) {
+	srv := SRV{Name: "_http._tcp.service-b", Scheme: "http", LookupSRV: func(_ context.Context, _, _, name string) (string, []*net.SRV, error) {
+		assert.Equal(t, "_http._tcp.service-b", name)
+		return "", []*net.SRV{{Target: "b1.local.", Port: 8080}, {Target: "b2.local.", Port: 8081}}, nil
+	}}
+
+	u, err := srv.Resolve(context.Background())
+
+	assert.Nil(t, err)
+	assert.Equal(t, urls("b1.local:8080", "b2.local:8081"), u)
+}
+
+func TestTransport(t *testing.T) {
+	sr := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr))
+	b := newBalancer(t, PolicyRoundRobin, "b1:8080", "b2:9090")
+	base := &RoundTripperMock{}
+	client := &http.Client{Transport: tracing.NewTransport(b.Transport(base), tracing.WithTracerProvider(tp))}
+
+	res, err := client.Get("http://service-b:8080/temperature")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), b.Instances()[1].InFlight())
+	res.Body.Close()
+
+	assert.Equal(t, int64(0), b.Instances()[1].InFlight())
+	assert.Equal(t, "http://b2:9090/temperature", base.Reqs[0].URL.String())
+	attrs := sr.Ended()[0].Attributes()
+	assert.Contains(t, attrs, attribute.String("lb.instance", "b2:9090"))
+	assert.Contains(t, attrs, attribute.String("lb.policy", "round-robin"))
+	assert.Contains(t, attrs, attribute.Int("lb.instances", 2))
+	assert.Contains(t, attrs, attribute.String("server.address", "b2"))
+	assert.Contains(t, attrs, attribute.Int("server.port", 9090))
+}
+
+func TestTransport_Error(t *testing.T) {
+	b := newBalancer(t, PolicyRoundRobin, "b1:8080")
+	client := &http.Client{Transport: b.Transport(&RoundTripperMock{Err: errors.New("connection refused")})}
+
+	_, err := client.Get("http://service-b:8080/temperature")
+
+	assert.NotNil(t, err)
+	assert.Equal(t, int64(0), b.Instances()[0].InFlight())
+}
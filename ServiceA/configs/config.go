@@ -0,0 +1,495 @@
+package configs
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/spf13/viper"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+	"willianszwy/FC-Tracing/balancer"
+	"willianszwy/FC-Tracing/pkg/breaker"
+	"willianszwy/FC-Tracing/pkg/deadline"
+	"willianszwy/FC-Tracing/pkg/health"
+	"willianszwy/FC-Tracing/pkg/logging"
+	"willianszwy/FC-Tracing/pkg/retry"
+	"willianszwy/FC-Tracing/pkg/server"
+	"willianszwy/FC-Tracing/pkg/telemetry"
+)
+
+// Config holds every setting of ServiceA.
+//
+// Values are resolved with this precedence, highest first: flags,
+// environment variables, the .env file, the YAML file given by -config or
+// CONFIG_FILE, and the defaults. Environment variable names are the YAML
+// keys in upper case with dots replaced by underscores, e.g. service_b.url
+// is SERVICE_B_URL. The env section of the YAML file and the .env file can
+// also set the OTEL_* and LOG_* variables read by the telemetry and logging
+// settings.
+type Config struct {
+	ListenAddr string         `mapstructure:"listen_addr"`
+	ServiceB   ServiceBConfig `mapstructure:"service_b"`
+	Server     ServerConfig   `mapstructure:"server"`
+	Retry      RetryConfig    `mapstructure:"retry"`
+	Health     HealthConfig   `mapstructure:"health"`
+	Breaker    BreakerConfig  `mapstructure:"breaker"`
+	Deadline   DeadlineConfig `mapstructure:"deadline"`
+
+	Telemetry telemetry.Config `mapstructure:"-"`
+	Log       logging.Config   `mapstructure:"-"`
+}
+
+// ServiceBConfig locates ServiceB.
+type ServiceBConfig struct {
+	// URL is the base URL, the temperature path is appended to it.
+	URL string `mapstructure:"url"`
+	// Timeout bounds a whole call to ServiceB.
+	Timeout time.Duration `mapstructure:"timeout"`
+	// Discovery finds the instances, static or dns-srv.
+	Discovery string `mapstructure:"discovery"`
+	// Instances are the base URLs of the static discovery, URL when empty.
+	Instances []string `mapstructure:"instances"`
+	// SRVName is the record looked up by the dns-srv discovery, e.g.
+	// _http._tcp.service-b.
+	SRVName string `mapstructure:"srv_name"`
+	// RefreshInterval is how often the instances are discovered again, 0
+	// disables it.
+	RefreshInterval time.Duration `mapstructure:"refresh_interval"`
+	// Balancer is the policy picking an instance, round-robin or
+	// least-loaded.
+	Balancer string `mapstructure:"balancer"`
+}
+
+// Discovery modes of ServiceB instances.
+const (
+	DiscoveryStatic = "static"
+	DiscoverySRV    = "dns-srv"
+)
+
+// ServerConfig holds the limits of the HTTP server.
+type ServerConfig struct {
+	ReadHeaderTimeout time.Duration `mapstructure:"read_header_timeout"`
+	ReadTimeout       time.Duration `mapstructure:"read_timeout"`
+	WriteTimeout      time.Duration `mapstructure:"write_timeout"`
+	IdleTimeout       time.Duration `mapstructure:"idle_timeout"`
+	ShutdownTimeout   time.Duration `mapstructure:"shutdown_timeout"`
+	// MaxBodyBytes bounds request bodies.
+	MaxBodyBytes int64 `mapstructure:"max_body_bytes"`
+}
+
+// RetryConfig is the retry policy of calls to ServiceB.
+type RetryConfig struct {
+	MaxAttempts    int           `mapstructure:"max_attempts"`
+	InitialBackoff time.Duration `mapstructure:"initial_backoff"`
+	MaxBackoff     time.Duration `mapstructure:"max_backoff"`
+	// Jitter is the randomized fraction of each backoff, from 0 to 1.
+	Jitter float64 `mapstructure:"jitter"`
+	// Statuses are the ServiceB statuses retried.
+	Statuses []int `mapstructure:"statuses"`
+}
+
+// Policy is the retry policy described by r.
+func (r RetryConfig) Policy() retry.Policy {
+	return retry.Policy{
+		MaxAttempts:    r.MaxAttempts,
+		InitialBackoff: r.InitialBackoff,
+		MaxBackoff:     r.MaxBackoff,
+		Jitter:         r.Jitter,
+		Statuses:       r.Statuses,
+	}
+}
+
+// HealthConfig tunes the readiness check of ServiceB.
+type HealthConfig struct {
+	Timeout  time.Duration `mapstructure:"timeout"`
+	CacheTTL time.Duration `mapstructure:"cache_ttl"`
+}
+
+// BreakerConfig tunes the circuit breaker of calls to ServiceB.
+type BreakerConfig struct {
+	WindowSize       int           `mapstructure:"window_size"`
+	MinCalls         int           `mapstructure:"min_calls"`
+	FailureRate      float64       `mapstructure:"failure_rate"`
+	SlowCallDuration time.Duration `mapstructure:"slow_call_duration"`
+	SlowCallRate     float64       `mapstructure:"slow_call_rate"`
+	OpenTimeout      time.Duration `mapstructure:"open_timeout"`
+	HalfOpenCalls    int           `mapstructure:"half_open_calls"`
+}
+
+// Settings are the breaker settings described by b.
+func (b BreakerConfig) Settings() breaker.Settings {
+	return breaker.Settings{
+		WindowSize:       b.WindowSize,
+		MinCalls:         b.MinCalls,
+		FailureRate:      b.FailureRate,
+		SlowCallDuration: b.SlowCallDuration,
+		SlowCallRate:     b.SlowCallRate,
+		OpenTimeout:      b.OpenTimeout,
+		HalfOpenCalls:    b.HalfOpenCalls,
+	}
+}
+
+// DeadlineConfig bounds the handling of a request, ServiceB calls included.
+type DeadlineConfig struct {
+	// Budget is the time given to a request, ServiceB gets what is left.
+	Budget time.Duration `mapstructure:"budget"`
+	// Margin is kept from the budget sent to ServiceB to relay its answer.
+	Margin time.Duration `mapstructure:"margin"`
+}
+
+var defaults = map[string]any{
+	"listen_addr":                ":8081",
+	"service_b.url":              "http://service-b:8080",
+	"service_b.timeout":          5 * time.Second,
+	"service_b.discovery":        DiscoveryStatic,
+	"service_b.instances":        []string{},
+	"service_b.srv_name":         "",
+	"service_b.refresh_interval": 30 * time.Second,
+	"service_b.balancer":         balancer.PolicyRoundRobin,
+	"server.read_header_timeout": 2 * time.Second,
+	"server.read_timeout":        5 * time.Second,
+	"server.write_timeout":       10 * time.Second,
+	"server.idle_timeout":        60 * time.Second,
+	"server.shutdown_timeout":    10 * time.Second,
+	"server.max_body_bytes":      server.DefaultMaxBodyBytes,
+	"retry.max_attempts":         3,
+	"retry.initial_backoff":      100 * time.Millisecond,
+	"retry.max_backoff":          time.Second,
+	"retry.jitter":               0.2,
+	"retry.statuses":             retry.DefaultStatuses,
+	"health.timeout":             health.DefaultTimeout,
+	"health.cache_ttl":           5 * time.Second,
+	"breaker.window_size":        breaker.DefaultSettings().WindowSize,
+	"breaker.min_calls":          breaker.DefaultSettings().MinCalls,
+	"breaker.failure_rate":       breaker.DefaultSettings().FailureRate,
+	"breaker.slow_call_duration": breaker.DefaultSettings().SlowCallDuration,
+	"breaker.slow_call_rate":     breaker.DefaultSettings().SlowCallRate,
+	"breaker.open_timeout":       breaker.DefaultSettings().OpenTimeout,
+	"breaker.half_open_calls":    breaker.DefaultSettings().HalfOpenCalls,
+	"deadline.budget":            5 * time.Second,
+	"deadline.margin":            100 * time.Millisecond,
+}
+
+// Load resolves the config from args, the environment, the .env file in the
+// working directory and the optional YAML file, registering its flags on
+// fs. It reports every invalid setting at once.
+func Load(fs *flag.FlagSet, args []string) (*Config, error) {
+	v := viper.New()
+	for key, value := range defaults {
+		v.SetDefault(key, value)
+	}
+
+	file := configFile(args)
+	var yamlEnv map[string]string
+	if file != "" {
+		v.SetConfigFile(file)
+		v.SetConfigType("yaml")
+		if err := v.ReadInConfig(); err != nil {
+			return nil, fmt.Errorf("config file %s: %w", file, err)
+		}
+		yamlEnv = v.GetStringMapString("env")
+	}
+	if err := loadDotEnv(".env"); err != nil {
+		return nil, err
+	}
+	setEnvDefaults(yamlEnv)
+
+	v.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
+	v.AutomaticEnv()
+
+	cfg := &Config{}
+	if err := v.Unmarshal(cfg); err != nil {
+		return nil, fmt.Errorf("config: %w", err)
+	}
+	var errs []error
+	var err error
+	if cfg.Log, err = logging.ConfigFromEnv(); err != nil {
+		errs = append(errs, err)
+	}
+	if cfg.Telemetry, err = telemetry.ConfigFromEnv("service-a"); err != nil {
+		errs = append(errs, err)
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+
+	cfg.RegisterFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// RegisterFlags binds the config fields to fs, using the current values as
+// defaults so flags take precedence over the environment.
+func (c *Config) RegisterFlags(fs *flag.FlagSet) {
+	fs.String("config", "", "YAML config file, also read from CONFIG_FILE")
+	fs.StringVar(&c.ListenAddr, "listen", c.ListenAddr, "address the server listens on")
+	fs.StringVar(&c.ServiceB.URL, "service-b-url", c.ServiceB.URL, "base URL of ServiceB")
+	fs.DurationVar(&c.ServiceB.Timeout, "service-b-timeout", c.ServiceB.Timeout, "timeout of a call to ServiceB")
+	fs.StringVar(&c.ServiceB.Discovery, "service-b-discovery", c.ServiceB.Discovery, "how ServiceB instances are found, static or dns-srv")
+	fs.Func("service-b-instances", "comma separated base URLs of the ServiceB instances, defaults to -service-b-url", func(value string) error {
+		c.ServiceB.Instances = splitList(value)
+		return nil
+	})
+	fs.StringVar(&c.ServiceB.SRVName, "service-b-srv-name", c.ServiceB.SRVName, "DNS SRV record of the ServiceB instances, e.g. _http._tcp.service-b")
+	fs.DurationVar(&c.ServiceB.RefreshInterval, "service-b-refresh-interval", c.ServiceB.RefreshInterval, "how often ServiceB instances are discovered again, 0 disables it")
+	fs.StringVar(&c.ServiceB.Balancer, "service-b-balancer", c.ServiceB.Balancer, "policy picking a ServiceB instance, round-robin or least-loaded")
+	fs.DurationVar(&c.Server.ReadHeaderTimeout, "read-header-timeout", c.Server.ReadHeaderTimeout, "maximum duration for reading request headers")
+	fs.DurationVar(&c.Server.ReadTimeout, "read-timeout", c.Server.ReadTimeout, "maximum duration for reading a request")
+	fs.DurationVar(&c.Server.WriteTimeout, "write-timeout", c.Server.WriteTimeout, "maximum duration for writing a response")
+	fs.DurationVar(&c.Server.IdleTimeout, "idle-timeout", c.Server.IdleTimeout, "maximum time an idle keep-alive connection is kept")
+	fs.DurationVar(&c.Server.ShutdownTimeout, "shutdown-timeout", c.Server.ShutdownTimeout, "time given to in-flight requests on shutdown")
+	fs.Int64Var(&c.Server.MaxBodyBytes, "max-body-bytes", c.Server.MaxBodyBytes, "maximum size of a request body")
+	fs.IntVar(&c.Retry.MaxAttempts, "retry-max-attempts", c.Retry.MaxAttempts, "attempts of a call to ServiceB, 1 disables retries")
+	fs.DurationVar(&c.Retry.InitialBackoff, "retry-initial-backoff", c.Retry.InitialBackoff, "wait before the first retry")
+	fs.DurationVar(&c.Retry.MaxBackoff, "retry-max-backoff", c.Retry.MaxBackoff, "maximum wait between two retries")
+	fs.Float64Var(&c.Retry.Jitter, "retry-jitter", c.Retry.Jitter, "randomized fraction of each retry wait, from 0 to 1")
+	fs.Func("retry-statuses", "comma separated ServiceB statuses that are retried", func(value string) error {
+		statuses, err := parseStatuses(value)
+		c.Retry.Statuses = statuses
+		return err
+	})
+	fs.DurationVar(&c.Health.Timeout, "health-timeout", c.Health.Timeout, "timeout of the readiness check of ServiceB")
+	fs.DurationVar(&c.Health.CacheTTL, "health-cache-ttl", c.Health.CacheTTL, "how long a readiness check result of ServiceB is reused")
+	fs.IntVar(&c.Breaker.WindowSize, "breaker-window-size", c.Breaker.WindowSize, "number of latest ServiceB calls the breaker rates are computed on")
+	fs.IntVar(&c.Breaker.MinCalls, "breaker-min-calls", c.Breaker.MinCalls, "calls needed before the ServiceB breaker may open")
+	fs.Float64Var(&c.Breaker.FailureRate, "breaker-failure-rate", c.Breaker.FailureRate, "failure rate, from 0 to 1, opening the ServiceB breaker")
+	fs.DurationVar(&c.Breaker.SlowCallDuration, "breaker-slow-call-duration", c.Breaker.SlowCallDuration, "duration from which a ServiceB call is slow")
+	fs.Float64Var(&c.Breaker.SlowCallRate, "breaker-slow-call-rate", c.Breaker.SlowCallRate, "slow call rate, from 0 to 1, opening the ServiceB breaker")
+	fs.DurationVar(&c.Breaker.OpenTimeout, "breaker-open-timeout", c.Breaker.OpenTimeout, "how long the ServiceB breaker stays open before probing")
+	fs.IntVar(&c.Breaker.HalfOpenCalls, "breaker-half-open-calls", c.Breaker.HalfOpenCalls, "trial calls deciding whether the ServiceB breaker closes")
+	fs.DurationVar(&c.Deadline.Budget, "deadline-budget", c.Deadline.Budget, "time given to a request, ServiceB calls included")
+	fs.DurationVar(&c.Deadline.Margin, "deadline-margin", c.Deadline.Margin, "part of the budget kept from ServiceB to relay its answer")
+	c.Log.RegisterFlags(fs)
+	c.Telemetry.RegisterFlags(fs)
+}
+
+// Validate reports every invalid setting, naming the variable and flag
+// that set it.
+func (c *Config) Validate() error {
+	var errs []error
+	if _, _, err := net.SplitHostPort(c.ListenAddr); err != nil {
+		errs = append(errs, fmt.Errorf("LISTEN_ADDR (-listen): must be host:port or :port, got %q", c.ListenAddr))
+	}
+	if !isHTTPURL(c.ServiceB.URL) {
+		errs = append(errs, fmt.Errorf("SERVICE_B_URL (-service-b-url): must be an absolute http or https URL, got %q", c.ServiceB.URL))
+	}
+	for _, instance := range c.ServiceB.Instances {
+		if !isHTTPURL(instance) {
+			errs = append(errs, fmt.Errorf("SERVICE_B_INSTANCES (-service-b-instances): must be absolute http or https URLs, got %q", instance))
+		}
+	}
+	switch c.ServiceB.Discovery {
+	case DiscoveryStatic:
+	case DiscoverySRV:
+		if c.ServiceB.SRVName == "" {
+			errs = append(errs, errors.New("SERVICE_B_SRV_NAME (-service-b-srv-name): required by the dns-srv discovery"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("SERVICE_B_DISCOVERY (-service-b-discovery): must be %s or %s, got %q", DiscoveryStatic, DiscoverySRV, c.ServiceB.Discovery))
+	}
+	if c.ServiceB.RefreshInterval < 0 {
+		errs = append(errs, fmt.Errorf("SERVICE_B_REFRESH_INTERVAL (-service-b-refresh-interval): must not be negative, got %s", c.ServiceB.RefreshInterval))
+	}
+	if c.ServiceB.Balancer != balancer.PolicyRoundRobin && c.ServiceB.Balancer != balancer.PolicyLeastLoaded {
+		errs = append(errs, fmt.Errorf("SERVICE_B_BALANCER (-service-b-balancer): must be %s or %s, got %q", balancer.PolicyRoundRobin, balancer.PolicyLeastLoaded, c.ServiceB.Balancer))
+	}
+	positive := []struct {
+		name  string
+		value time.Duration
+	}{
+		{"SERVICE_B_TIMEOUT (-service-b-timeout)", c.ServiceB.Timeout},
+		{"SERVER_READ_HEADER_TIMEOUT (-read-header-timeout)", c.Server.ReadHeaderTimeout},
+		{"SERVER_READ_TIMEOUT (-read-timeout)", c.Server.ReadTimeout},
+		{"SERVER_WRITE_TIMEOUT (-write-timeout)", c.Server.WriteTimeout},
+		{"SERVER_IDLE_TIMEOUT (-idle-timeout)", c.Server.IdleTimeout},
+		{"SERVER_SHUTDOWN_TIMEOUT (-shutdown-timeout)", c.Server.ShutdownTimeout},
+		{"RETRY_INITIAL_BACKOFF (-retry-initial-backoff)", c.Retry.InitialBackoff},
+		{"RETRY_MAX_BACKOFF (-retry-max-backoff)", c.Retry.MaxBackoff},
+		{"HEALTH_TIMEOUT (-health-timeout)", c.Health.Timeout},
+		{"BREAKER_SLOW_CALL_DURATION (-breaker-slow-call-duration)", c.Breaker.SlowCallDuration},
+		{"BREAKER_OPEN_TIMEOUT (-breaker-open-timeout)", c.Breaker.OpenTimeout},
+		{"DEADLINE_BUDGET (-deadline-budget)", c.Deadline.Budget},
+	}
+	for _, p := range positive {
+		if p.value <= 0 {
+			errs = append(errs, fmt.Errorf("%s: must be a positive duration such as 5s, got %s", p.name, p.value))
+		}
+	}
+	if c.Server.MaxBodyBytes < 1 {
+		errs = append(errs, fmt.Errorf("SERVER_MAX_BODY_BYTES (-max-body-bytes): must be at least 1, got %d", c.Server.MaxBodyBytes))
+	}
+	if c.Health.CacheTTL < 0 {
+		errs = append(errs, fmt.Errorf("HEALTH_CACHE_TTL (-health-cache-ttl): must not be negative, got %s", c.Health.CacheTTL))
+	}
+	if c.Deadline.Margin < 0 || c.Deadline.Budget-c.Deadline.Margin < deadline.MinBudget {
+		errs = append(errs, fmt.Errorf("DEADLINE_MARGIN (-deadline-margin): must be at least 0 and leave %s of DEADLINE_BUDGET %s, got %s", deadline.MinBudget, c.Deadline.Budget, c.Deadline.Margin))
+	}
+	if c.Retry.MaxAttempts < 1 {
+		errs = append(errs, fmt.Errorf("RETRY_MAX_ATTEMPTS (-retry-max-attempts): must be at least 1, got %d", c.Retry.MaxAttempts))
+	}
+	if c.Retry.MaxBackoff < c.Retry.InitialBackoff {
+		errs = append(errs, fmt.Errorf("RETRY_MAX_BACKOFF (-retry-max-backoff): must not be below RETRY_INITIAL_BACKOFF %s, got %s", c.Retry.InitialBackoff, c.Retry.MaxBackoff))
+	}
+	if c.Retry.Jitter < 0 || c.Retry.Jitter > 1 {
+		errs = append(errs, fmt.Errorf("RETRY_JITTER (-retry-jitter): must be between 0 and 1, got %g", c.Retry.Jitter))
+	}
+	for _, status := range c.Retry.Statuses {
+		if status < 100 || status > 599 {
+			errs = append(errs, fmt.Errorf("RETRY_STATUSES (-retry-statuses): must be HTTP statuses, got %d", status))
+		}
+	}
+	for _, n := range []struct {
+		name  string
+		value int
+	}{
+		{"BREAKER_WINDOW_SIZE (-breaker-window-size)", c.Breaker.WindowSize},
+		{"BREAKER_MIN_CALLS (-breaker-min-calls)", c.Breaker.MinCalls},
+		{"BREAKER_HALF_OPEN_CALLS (-breaker-half-open-calls)", c.Breaker.HalfOpenCalls},
+	} {
+		if n.value < 1 {
+			errs = append(errs, fmt.Errorf("%s: must be at least 1, got %d", n.name, n.value))
+		}
+	}
+	for _, r := range []struct {
+		name  string
+		value float64
+	}{
+		{"BREAKER_FAILURE_RATE (-breaker-failure-rate)", c.Breaker.FailureRate},
+		{"BREAKER_SLOW_CALL_RATE (-breaker-slow-call-rate)", c.Breaker.SlowCallRate},
+	} {
+		if r.value <= 0 || r.value > 1 {
+			errs = append(errs, fmt.Errorf("%s: must be above 0 and at most 1, got %g", r.name, r.value))
+		}
+	}
+	if err := c.Log.Validate(); err != nil {
+		errs = append(errs, err)
+	}
+	if err := c.Telemetry.Validate(); err != nil {
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+// TemperatureURL is the ServiceB endpoint called for each request.
+func (c *Config) TemperatureURL() string {
+	return c.serviceBURL("/temperature")
+}
+
+// HealthURL is the ServiceB readiness endpoint, so ServiceA is only ready
+// when ServiceB is.
+func (c *Config) HealthURL() string {
+	return c.serviceBURL(health.ReadinessRoute)
+}
+
+func (c *Config) serviceBURL(path string) string {
+	return strings.TrimRight(c.ServiceB.URL, "/") + path
+}
+
+// Resolver finds the ServiceB instances as configured. The scheme of URL is
+// used for the instances found by DNS SRV.
+func (c *Config) Resolver() balancer.Resolver {
+	if c.ServiceB.Discovery == DiscoverySRV {
+		scheme := "http"
+		if u, err := url.Parse(c.ServiceB.URL); err == nil && u.Scheme != "" {
+			scheme = u.Scheme
+		}
+		return balancer.SRV{Name: c.ServiceB.SRVName, Scheme: scheme}
+	}
+	instances := c.ServiceB.Instances
+	if len(instances) == 0 {
+		instances = []string{c.ServiceB.URL}
+	}
+	static := make(balancer.Static, 0, len(instances))
+	for _, instance := range instances {
+		if u, err := url.Parse(instance); err == nil {
+			static = append(static, &url.URL{Scheme: u.Scheme, Host: u.Host})
+		}
+	}
+	return static
+}
+
+func isHTTPURL(s string) bool {
+	u, err := url.Parse(s)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+// parseStatuses parses a comma separated list of HTTP statuses.
+func parseStatuses(s string) ([]int, error) {
+	var statuses []int
+	for _, item := range splitList(s) {
+		status, err := strconv.Atoi(item)
+		if err != nil {
+			return nil, fmt.Errorf("invalid status %q", item)
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+// splitList splits a comma separated list, dropping empty items.
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// configFile finds the -config flag in args before they are parsed, as the
+// file has to be read before the flags get their defaults.
+func configFile(args []string) string {
+	for i, arg := range args {
+		name, value, hasValue := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		if !strings.HasPrefix(arg, "-") || name != "config" {
+			continue
+		}
+		if hasValue {
+			return value
+		}
+		if i+1 < len(args) {
+			return args[i+1]
+		}
+	}
+	return os.Getenv("CONFIG_FILE")
+}
+
+// loadDotEnv sets the variables of a dotenv file that are not already set
+// in the environment. A missing file is not an error.
+func loadDotEnv(path string) error {
+	if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	v := viper.New()
+	v.SetConfigFile(path)
+	v.SetConfigType("env")
+	if err := v.ReadInConfig(); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	values := map[string]string{}
+	for _, key := range v.AllKeys() {
+		values[key] = v.GetString(key)
+	}
+	setEnvDefaults(values)
+	return nil
+}
+
+// setEnvDefaults sets each variable of values that is not already set.
+func setEnvDefaults(values map[string]string) {
+	for key, value := range values {
+		key = strings.ToUpper(key)
+		if _, ok := os.LookupEnv(key); !ok {
+			os.Setenv(key, value)
+		}
+	}
+}
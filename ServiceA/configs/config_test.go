@@ -0,0 +1,209 @@
+package configs
+
+import (
+	"context"
+	"flag"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+	"willianszwy/FC-Tracing/balancer"
+)
+
+func load(t *testing.T, args ...string) (*Config, error) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	return Load(fs, args)
+}
+
+func chdir(t *testing.T, dir string) {
+	wd, err := os.Getwd()
+	assert.Nil(t, err)
+	assert.Nil(t, os.Chdir(dir))
+	t.Cleanup(func() { os.Chdir(wd) })
+}
+
+// unsetenv unsets keys for the test, restoring them on cleanup, as Load sets
+// the variables read from the .env and YAML files.
+func unsetenv(t *testing.T, keys ...string) {
+	for _, key := range keys {
+		t.Setenv(key, "")
+		os.Unsetenv(key)
+	}
+}
+
+func writeFile(t *testing.T, dir, name, content string) string {
+	path := filepath.Join(dir, name)
+	assert.Nil(t, os.WriteFile(path, []byte(content), 0o600))
+	return path
+}
+
+func TestLoad_Defaults(t *testing.T) {
+	chdir(t, t.TempDir())
+
+	cfg, err := load(t)
+
+	assert.Nil(t, err)
+	assert.Equal(t, ":8081", cfg.ListenAddr)
+	assert.Equal(t, "http://service-b:8080/temperature", cfg.TemperatureURL())
+	assert.Equal(t, "http://service-b:8080/readyz", cfg.HealthURL())
+	assert.Equal(t, 5*time.Second, cfg.ServiceB.Timeout)
+	assert.Equal(t, 3, cfg.Retry.MaxAttempts)
+	assert.Equal(t, "service-a", cfg.Telemetry.ServiceName)
+}
+
+func TestLoad_Precedence(t *testing.T) {
+	dir := t.TempDir()
+	chdir(t, dir)
+	file := writeFile(t, dir, "config.yaml", `
+listen_addr: ":9000"
+service_b:
+  url: http://yaml:8080
+  timeout: 1s
+retry:
+  max_attempts: 5
+  initial_backoff: 50ms
+env:
+  LOG_LEVEL: debug
+`)
+	writeFile(t, dir, ".env", "SERVICE_B_TIMEOUT=2s\nRETRY_MAX_ATTEMPTS=4\n")
+	t.Setenv("SERVICE_B_URL", "http://env:8080")
+	unsetenv(t, "SERVICE_B_TIMEOUT", "RETRY_MAX_ATTEMPTS", "LOG_LEVEL")
+
+	cfg, err := load(t, "-config", file, "-retry-max-attempts=2")
+
+	assert.Nil(t, err)
+	assert.Equal(t, ":9000", cfg.ListenAddr)
+	assert.Equal(t, "http://env:8080", cfg.ServiceB.URL)
+	assert.Equal(t, 2*time.Second, cfg.ServiceB.Timeout)
+	assert.Equal(t, 2, cfg.Retry.MaxAttempts)
+	assert.Equal(t, 50*time.Millisecond, cfg.Retry.InitialBackoff)
+	assert.Equal(t, "DEBUG", cfg.Log.Level.String())
+}
+
+func TestLoad_ConfigFileFromEnv(t *testing.T) {
+	dir := t.TempDir()
+	chdir(t, dir)
+	t.Setenv("CONFIG_FILE", writeFile(t, dir, "config.yaml", "listen_addr: \":9001\"\n"))
+
+	cfg, err := load(t)
+
+	assert.Nil(t, err)
+	assert.Equal(t, ":9001", cfg.ListenAddr)
+}
+
+func TestLoad_MissingConfigFile(t *testing.T) {
+	chdir(t, t.TempDir())
+
+	_, err := load(t, "-config=missing.yaml")
+
+	assert.ErrorContains(t, err, "config file missing.yaml")
+}
+
+func TestLoad_ReportsAllErrors(t *testing.T) {
+	chdir(t, t.TempDir())
+
+	_, err := load(t, "-listen", "8081", "-service-b-url", "service-b", "-service-b-timeout", "0s", "-retry-max-attempts", "0")
+
+	assert.ErrorContains(t, err, "LISTEN_ADDR (-listen): must be host:port or :port")
+	assert.ErrorContains(t, err, "SERVICE_B_URL (-service-b-url): must be an absolute http or https URL")
+	assert.ErrorContains(t, err, "SERVICE_B_TIMEOUT (-service-b-timeout): must be a positive duration")
+	assert.ErrorContains(t, err, "RETRY_MAX_ATTEMPTS (-retry-max-attempts): must be at least 1")
+}
+
+func TestConfigFile(t *testing.T) {
+	t.Setenv("CONFIG_FILE", "env.yaml")
+
+	assert.Equal(t, "a.yaml", configFile([]string{"-config", "a.yaml"}))
+	assert.Equal(t, "b.yaml", configFile([]string{"-listen=:1", "--config=b.yaml"}))
+	assert.Equal(t, "env.yaml", configFile([]string{"-listen", "config"}))
+}
+
+func TestLoad_ServiceBInstances(t *testing.T) {
+	chdir(t, t.TempDir())
+	t.Setenv("SERVICE_B_INSTANCES", "http://b1:8080,http://b2:8080")
+
+	cfg, err := load(t, "-service-b-balancer", "least-loaded")
+
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"http://b1:8080", "http://b2:8080"}, cfg.ServiceB.Instances)
+	assert.Equal(t, "least-loaded", cfg.ServiceB.Balancer)
+	urls, err := cfg.Resolver().Resolve(context.Background())
+	assert.Nil(t, err)
+	assert.Len(t, urls, 2)
+	assert.Equal(t, "http://b2:8080", urls[1].String())
+}
+
+func TestLoad_ServiceBDiscovery(t *testing.T) {
+	chdir(t, t.TempDir())
+
+	cfg, err := load(t)
+	assert.Nil(t, err)
+	assert.Equal(t, balancer.Static{{Scheme: "http", Host: "service-b:8080"}}, cfg.Resolver())
+
+	cfg, err = load(t, "-service-b-discovery", "dns-srv", "-service-b-srv-name", "_http._tcp.service-b")
+	assert.Nil(t, err)
+	assert.Equal(t, balancer.SRV{Name: "_http._tcp.service-b", Scheme: "http"}, cfg.Resolver())
+
+	_, err = load(t, "-service-b-discovery", "dns-srv", "-service-b-instances", "b1:8080", "-service-b-balancer", "random")
+	assert.ErrorContains(t, err, "SERVICE_B_SRV_NAME (-service-b-srv-name): required")
+	assert.ErrorContains(t, err, `SERVICE_B_INSTANCES (-service-b-instances): must be absolute http or https URLs, got "b1:8080"`)
+	assert.ErrorContains(t, err, `SERVICE_B_BALANCER (-service-b-balancer): must be round-robin or least-loaded, got "random"`)
+}
+
+func TestLoad_Retry(t *testing.T) {
+	chdir(t, t.TempDir())
+	t.Setenv("RETRY_STATUSES", "502,503")
+
+	cfg, err := load(t, "-retry-jitter", "0.5")
+
+	assert.Nil(t, err)
+	policy := cfg.Retry.Policy()
+	assert.Equal(t, []int{502, 503}, policy.Statuses)
+	assert.Equal(t, 0.5, policy.Jitter)
+	assert.Equal(t, 3, policy.MaxAttempts)
+
+	_, err = load(t, "-retry-jitter", "2", "-retry-statuses", "503,42")
+	assert.ErrorContains(t, err, "RETRY_JITTER (-retry-jitter): must be between 0 and 1, got 2")
+	assert.ErrorContains(t, err, "RETRY_STATUSES (-retry-statuses): must be HTTP statuses, got 42")
+}
+
+func TestLoad_Breaker(t *testing.T) {
+	chdir(t, t.TempDir())
+	t.Setenv("BREAKER_OPEN_TIMEOUT", "1m")
+
+	cfg, err := load(t, "-breaker-failure-rate", "0.25")
+
+	assert.Nil(t, err)
+	settings := cfg.Breaker.Settings()
+	assert.Equal(t, time.Minute, settings.OpenTimeout)
+	assert.Equal(t, 0.25, settings.FailureRate)
+	assert.Equal(t, 20, settings.WindowSize)
+
+	_, err = load(t, "-breaker-slow-call-rate", "1.5", "-breaker-min-calls", "0")
+	assert.ErrorContains(t, err, "BREAKER_SLOW_CALL_RATE (-breaker-slow-call-rate): must be above 0 and at most 1, got 1.5")
+	assert.ErrorContains(t, err, "BREAKER_MIN_CALLS (-breaker-min-calls): must be at least 1, got 0")
+}
+
+func TestLoad_Deadline(t *testing.T) {
+	chdir(t, t.TempDir())
+	t.Setenv("DEADLINE_BUDGET", "3s")
+
+	cfg, err := load(t, "-deadline-margin", "50ms")
+
+	assert.Nil(t, err)
+	assert.Equal(t, 3*time.Second, cfg.Deadline.Budget)
+	assert.Equal(t, 50*time.Millisecond, cfg.Deadline.Margin)
+
+	_, err = load(t, "-deadline-margin", "3s")
+	assert.ErrorContains(t, err, "DEADLINE_MARGIN (-deadline-margin): must be at least 0 and leave 10ms of DEADLINE_BUDGET 3s, got 3s")
+	_, err = load(t, "-deadline-margin", "2.995s")
+	assert.ErrorContains(t, err, "DEADLINE_MARGIN (-deadline-margin): must be at least 0 and leave 10ms of DEADLINE_BUDGET 3s, got 2.995s")
+	_, err = load(t, "-deadline-margin", "2.99s")
+	assert.Nil(t, err)
+
+	_, err = load(t, "-deadline-budget", "0s")
+	assert.ErrorContains(t, err, "DEADLINE_BUDGET (-deadline-budget): must be a positive duration")
+}
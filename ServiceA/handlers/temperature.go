@@ -0,0 +1,178 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/go-chi/chi/v5/middleware"
+	"go.opentelemetry.io/otel/trace"
+	"io"
+	"net/http"
+	"regexp"
+	"willianszwy/FC-Tracing/pkg/breaker"
+	"willianszwy/FC-Tracing/pkg/deadline"
+	"willianszwy/FC-Tracing/pkg/logging"
+	"willianszwy/FC-Tracing/pkg/retry"
+	"willianszwy/FC-Tracing/pkg/server"
+	"willianszwy/FC-Tracing/pkg/tracing"
+)
+
+// MaxResponseBytes bounds the ServiceB response body relayed to the caller.
+const MaxResponseBytes = 1 << 20
+
+const provider = "service-b"
+
+type HTTPClient interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
+// TemperatureHandler validates the zipcode and relays the ServiceB answer,
+// keeping its status, content type and body.
+type TemperatureHandler struct {
+	client       HTTPClient
+	endpoint     string
+	maxBodyBytes int64
+}
+
+// Option customizes a TemperatureHandler.
+type Option func(*TemperatureHandler)
+
+// WithMaxBodyBytes rejects request bodies larger than n bytes instead of
+// server.DefaultMaxBodyBytes.
+func WithMaxBodyBytes(n int64) Option {
+	return func(t *TemperatureHandler) {
+		t.maxBodyBytes = n
+	}
+}
+
+var (
+	errInvalidZipcode  = errors.New("invalid zipCode")
+	errResponseTooLong = fmt.Errorf("service B response exceeds %d bytes", MaxResponseBytes)
+	zipcodeRegex       = regexp.MustCompile("^[0-9]{8}$")
+)
+
+var logger = logging.Package("handlers")
+
+type RequestBody struct {
+	Zipcode string `json:"zipcode"`
+}
+
+// New returns a handler posting to endpoint, the ServiceB temperature URL.
+func New(client HTTPClient, endpoint string, opts ...Option) *TemperatureHandler {
+	t := &TemperatureHandler{
+		client:       client,
+		endpoint:     endpoint,
+		maxBodyBytes: server.DefaultMaxBodyBytes,
+	}
+	for _, opt := range opts {
+		opt(t)
+	}
+	return t
+}
+
+func (t *TemperatureHandler) Handler(writer http.ResponseWriter, request *http.Request) {
+	ctx := request.Context()
+	span := trace.SpanFromContext(ctx)
+	logger.InfoContext(ctx, "starting request service A")
+
+	var reqBody RequestBody
+	err := server.DecodeJSON(writer, request, t.maxBodyBytes, &reqBody)
+	if err != nil {
+		tracing.RecordError(span, tracing.Classify(tracing.ErrorValidation, err))
+		http.Error(writer, err.Error(), server.StatusOf(err))
+		return
+	}
+	logger.DebugContext(ctx, "request decoded", "zipcode", reqBody.Zipcode)
+	span.SetAttributes(tracing.PII(tracing.ZipcodeKey, reqBody.Zipcode)...)
+
+	if !zipcodeRegex.MatchString(reqBody.Zipcode) {
+		tracing.RecordError(span, tracing.Classify(tracing.ErrorValidation, errInvalidZipcode))
+		http.Error(writer, "invalid zipCode", http.StatusUnprocessableEntity)
+		return
+	}
+	span.AddEvent(tracing.EventValidationPassed)
+
+	body, _ := json.Marshal(map[string]string{
+		"zipcode": reqBody.Zipcode,
+	})
+	hop := deadline.StartHop(ctx, provider, 0)
+	defer hop.End()
+	req, err := http.NewRequestWithContext(hop.Context(), http.MethodPost, t.endpoint, bytes.NewReader(body))
+	if err != nil {
+		tracing.RecordError(span, err)
+		http.Error(writer, "error calling service B", http.StatusInternalServerError)
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	// The lookup has no side effect, the request ID lets it be retried.
+	if id := middleware.GetReqID(ctx); id != "" {
+		req.Header.Set(retry.IdempotencyKeyHeader, id)
+	}
+
+	span.SetAttributes(tracing.UpstreamProviderKey.String(provider))
+	response, err := t.client.Do(req)
+	if errors.Is(err, breaker.ErrOpen) {
+		logger.WarnContext(ctx, "failing fast, service B unavailable", "error", err)
+		tracing.RecordError(span, err)
+		http.Error(writer, "service B unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	if err != nil {
+		err = tracing.ClassifyUpstream(err)
+		logger.ErrorContext(ctx, "error calling service B", "error", err)
+		tracing.RecordError(span, err)
+		if hop.Exhausted(err) {
+			http.Error(writer, "service B timed out", http.StatusGatewayTimeout)
+			return
+		}
+		http.Error(writer, "service B unavailable", http.StatusBadGateway)
+		return
+	}
+	defer response.Body.Close()
+	span.SetAttributes(tracing.UpstreamStatusCodeKey.Int(response.StatusCode))
+
+	resBody, err := io.ReadAll(io.LimitReader(response.Body, MaxResponseBytes+1))
+	if err == nil && len(resBody) > MaxResponseBytes {
+		err = errResponseTooLong
+	}
+	if err != nil {
+		err = tracing.Classify(tracing.ErrorUpstreamBadResponse, err)
+		logger.ErrorContext(ctx, "impossible to read all body of response", "error", err)
+		tracing.RecordError(span, err)
+		http.Error(writer, "invalid response from service B", http.StatusBadGateway)
+		return
+	}
+	logger.DebugContext(ctx, "service B response", "status", response.StatusCode, "body", string(resBody))
+	switch {
+	case response.StatusCode >= http.StatusInternalServerError:
+		tracing.RecordError(span, tracing.Classify(statusClass(response.StatusCode),
+			fmt.Errorf("service B answered %d: %s", response.StatusCode, bytes.TrimSpace(resBody))))
+	case response.StatusCode >= http.StatusBadRequest:
+		// A rejected request is not a failure of the service, as in
+		// tracing.Middleware: classify it without the error status.
+		span.SetAttributes(tracing.ErrorClassKey.String(statusClass(response.StatusCode)))
+	}
+
+	if contentType := response.Header.Get("Content-Type"); contentType != "" {
+		writer.Header().Set("Content-Type", contentType)
+	}
+	writer.Header().Set("X-Content-Type-Options", "nosniff")
+	writer.WriteHeader(response.StatusCode)
+	writer.Write(resBody)
+}
+
+// statusClass is the error class of a ServiceB 4xx or 5xx status.
+func statusClass(status int) string {
+	switch {
+	case status == http.StatusNotFound:
+		return tracing.ErrorNotFound
+	case status == http.StatusGatewayTimeout:
+		return tracing.ErrorUpstreamTimeout
+	case status == http.StatusServiceUnavailable || status == http.StatusBadGateway:
+		return tracing.ErrorUpstreamUnavailable
+	case status >= http.StatusInternalServerError:
+		return tracing.ErrorUpstreamBadResponse
+	}
+	return tracing.ErrorValidation
+}
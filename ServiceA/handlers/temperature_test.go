@@ -0,0 +1,166 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"willianszwy/FC-Tracing/pkg/breaker"
+	"willianszwy/FC-Tracing/pkg/deadline"
+	"willianszwy/FC-Tracing/pkg/tracing"
+)
+
+type ClientMock struct {
+	Res *http.Response
+	Err error
+	Req *http.Request
+}
+
+func (c *ClientMock) Do(req *http.Request) (*http.Response, error) {
+	c.Req = req
+	return c.Res, c.Err
+}
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+var _ net.Error = timeoutError{}
+
+type failingBody struct{}
+
+func (failingBody) Read([]byte) (int, error) { return 0, errors.New("connection reset") }
+func (failingBody) Close() error             { return nil }
+
+func response(status int, contentType, body string) *http.Response {
+	header := http.Header{}
+	if contentType != "" {
+		header.Set("Content-Type", contentType)
+	}
+	return &http.Response{StatusCode: status, Header: header, Body: io.NopCloser(strings.NewReader(body))}
+}
+
+// serve runs the handler under a recorded server span.
+func serve(client *ClientMock, body string) (*httptest.ResponseRecorder, sdktrace.ReadOnlySpan) {
+	sr := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr))
+	ctx, span := tp.Tracer("test").Start(context.WithValue(context.Background(), middleware.RequestIDKey, "req-1"), "POST /")
+	req := httptest.NewRequest("POST", "http://service-a/", strings.NewReader(body)).WithContext(ctx)
+	w := httptest.NewRecorder()
+
+	New(client, "http://service-b:8080/temperature").Handler(w, req)
+	span.End()
+	return w, sr.Ended()[0]
+}
+
+func TestHandler_RelaysServiceB(t *testing.T) {
+	tests := []struct {
+		name        string
+		res         *http.Response
+		contentType string
+		class       string
+		failed      bool
+	}{
+		{"ok", response(200, "application/json", `{"city":"São Paulo","temp_C":18}`), "application/json", "", false},
+		{"not found", response(404, "text/plain; charset=utf-8", "can not find zipcode\n"), "text/plain; charset=utf-8", "not_found", false},
+		{"invalid", response(422, "text/plain; charset=utf-8", "invalid zipCode\n"), "text/plain; charset=utf-8", "validation", false},
+		{"server error", response(500, "", "weather failed\n"), "", "upstream_bad_response", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body, _ := io.ReadAll(tt.res.Body)
+			tt.res.Body = io.NopCloser(strings.NewReader(string(body)))
+			client := &ClientMock{Res: tt.res}
+
+			w, span := serve(client, `{"zipcode": "01001000"}`)
+
+			assert.Equal(t, tt.res.StatusCode, w.Code)
+			assert.Equal(t, string(body), w.Body.String())
+			assert.Equal(t, tt.contentType, w.Result().Header.Get("Content-Type"))
+			assert.Equal(t, "http://service-b:8080/temperature", client.Req.URL.String())
+			assert.Equal(t, "application/json", client.Req.Header.Get("Content-Type"))
+			assert.Equal(t, "req-1", client.Req.Header.Get("Idempotency-Key"))
+			assert.Contains(t, span.Attributes(), attribute.Int("upstream.http.status_code", tt.res.StatusCode))
+			if !tt.failed {
+				assert.Equal(t, codes.Unset, span.Status().Code)
+				for _, e := range span.Events() {
+					assert.NotEqual(t, "exception", e.Name)
+				}
+			} else {
+				assert.Equal(t, codes.Error, span.Status().Code)
+			}
+			if tt.class != "" {
+				assert.Contains(t, span.Attributes(), attribute.String("error.class", tt.class))
+			}
+		})
+	}
+}
+
+func TestHandler_Failures(t *testing.T) {
+	tests := []struct {
+		name   string
+		client ClientMock
+		status int
+		class  string
+	}{
+		{"timeout", ClientMock{Err: context.DeadlineExceeded}, http.StatusGatewayTimeout, "upstream_timeout"},
+		{"net timeout", ClientMock{Err: timeoutError{}}, http.StatusGatewayTimeout, "upstream_timeout"},
+		{"unavailable", ClientMock{Err: errors.New("connection refused")}, http.StatusBadGateway, "upstream_unavailable"},
+		{"breaker open", ClientMock{Err: tracing.Classify(tracing.ErrorCircuitOpen, fmt.Errorf("service-b: %w", breaker.ErrOpen))}, http.StatusServiceUnavailable, "circuit_open"},
+		{"bad body", ClientMock{Res: &http.Response{StatusCode: 200, Body: failingBody{}}}, http.StatusBadGateway, "upstream_bad_response"},
+		{"body too long", ClientMock{Res: response(200, "application/json", strings.Repeat("a", MaxResponseBytes+1))}, http.StatusBadGateway, "upstream_bad_response"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w, span := serve(&tt.client, `{"zipcode": "01001000"}`)
+
+			assert.Equal(t, tt.status, w.Code)
+			assert.Equal(t, codes.Error, span.Status().Code)
+			assert.Contains(t, span.Attributes(), attribute.String("error.class", tt.class))
+		})
+	}
+}
+
+func TestHandler_RecordsExhaustedHop(t *testing.T) {
+	w, span := serve(&ClientMock{Err: timeoutError{}}, `{"zipcode": "01001000"}`)
+
+	assert.Equal(t, http.StatusGatewayTimeout, w.Code)
+	assert.Contains(t, span.Attributes(), deadline.ExhaustedHopKey.String("service-b"))
+	assert.Contains(t, span.Attributes(), deadline.ExhaustedByKey.String(deadline.ExhaustedTimeout))
+
+	w, span = serve(&ClientMock{Err: fmt.Errorf("%w: %w", deadline.ErrExhausted, context.DeadlineExceeded)}, `{"zipcode": "01001000"}`)
+
+	assert.Equal(t, http.StatusGatewayTimeout, w.Code)
+	assert.Contains(t, span.Attributes(), deadline.ExhaustedByKey.String(deadline.ExhaustedBudget))
+
+	w, span = serve(&ClientMock{Err: errors.New("connection refused")}, `{"zipcode": "01001000"}`)
+
+	assert.Equal(t, http.StatusBadGateway, w.Code)
+	for _, attr := range span.Attributes() {
+		assert.NotEqual(t, deadline.ExhaustedHopKey, attr.Key)
+	}
+}
+
+func TestHandler_InvalidZipcode(t *testing.T) {
+	client := &ClientMock{Err: errors.New("should not be called")}
+
+	w, span := serve(client, `{"zipcode": "0100"}`)
+
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	assert.Equal(t, "invalid zipCode\n", w.Body.String())
+	assert.Nil(t, client.Req)
+	assert.Contains(t, span.Attributes(), attribute.String("error.class", "validation"))
+}
@@ -1,136 +1,94 @@
 package main
 
 import (
-	"bytes"
 	"context"
-	"encoding/json"
 	"flag"
-	"fmt"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
-	"go.opentelemetry.io/otel"
-	"go.opentelemetry.io/otel/exporters/zipkin"
-	"go.opentelemetry.io/otel/propagation"
-	"go.opentelemetry.io/otel/sdk/resource"
-	sdktrace "go.opentelemetry.io/otel/sdk/trace"
-	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
-	"io"
-	"log"
+	"log/slog"
 	"net/http"
 	"os"
 	"os/signal"
-	"regexp"
+	"syscall"
+	"willianszwy/FC-Tracing/balancer"
+	"willianszwy/FC-Tracing/configs"
+	"willianszwy/FC-Tracing/handlers"
+	"willianszwy/FC-Tracing/pkg/breaker"
+	"willianszwy/FC-Tracing/pkg/deadline"
+	"willianszwy/FC-Tracing/pkg/health"
+	"willianszwy/FC-Tracing/pkg/logging"
+	"willianszwy/FC-Tracing/pkg/retry"
+	"willianszwy/FC-Tracing/pkg/server"
+	"willianszwy/FC-Tracing/pkg/telemetry"
+	"willianszwy/FC-Tracing/pkg/tracing"
 )
 
-var logger = log.New(os.Stderr, "zipkin-example", log.Ldate|log.Ltime|log.Llongfile)
+const metricsRoute = "/metrics"
 
-func initTracer(url string) (func(context.Context) error, error) {
-	exporter, err := zipkin.New(
-		url,
-		zipkin.WithLogger(logger),
-	)
+func main() {
+	cfg, err := configs.Load(flag.CommandLine, os.Args[1:])
 	if err != nil {
-		return nil, err
+		fatal("invalid config", err)
 	}
 
-	batcher := sdktrace.NewBatchSpanProcessor(exporter)
-
-	tp := sdktrace.NewTracerProvider(
-		sdktrace.WithSampler(sdktrace.AlwaysSample()),
-		sdktrace.WithSpanProcessor(batcher),
-		sdktrace.WithResource(resource.NewWithAttributes(
-			semconv.SchemaURL,
-			semconv.ServiceName("service-a"),
-		)),
-	)
-	otel.SetTracerProvider(tp)
-	otel.SetTextMapPropagator(propagation.TraceContext{})
-
-	return tp.Shutdown, nil
-}
-
-func main() {
-	log.Println("Start service A...")
-	url := flag.String("zipkin", "http://zipkin:9411/api/v2/spans", "zipkin url")
-	flag.Parse()
+	logger, err := logging.Setup(os.Stdout, cfg.Log)
+	if err != nil {
+		fatal("invalid log config", err)
+	}
+	logger.Info("Start service A...")
 
-	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 	defer cancel()
 
-	shutdown, err := initTracer(*url)
+	shutdown, err := telemetry.Setup(ctx, cfg.Telemetry)
 	if err != nil {
-		log.Fatal(err)
+		fatal("failed to setup telemetry", err)
 	}
-	defer func() {
-		if err := shutdown(ctx); err != nil {
-			log.Fatal("failed to shutdown TracerProvider: %w", err)
-		}
-	}()
 
-	tr := otel.GetTracerProvider().Tracer("component-main")
+	lb, err := balancer.New(cfg.Resolver(), cfg.ServiceB.Balancer)
+	if err != nil {
+		fatal("invalid config", err)
+	}
+	if err := lb.Refresh(ctx); err != nil {
+		logger.WarnContext(ctx, "ServiceB discovery failed, retrying in the background", "error", err)
+	}
+	go lb.Run(ctx, cfg.ServiceB.RefreshInterval)
+	client := &http.Client{
+		Transport: tracing.NewTransport(deadline.Transport(lb.Transport(nil), cfg.Deadline.Margin)),
+		Timeout:   cfg.ServiceB.Timeout,
+	}
 
 	r := chi.NewRouter()
 	r.Use(middleware.RequestID)
 	r.Use(middleware.RealIP)
-	r.Use(middleware.Logger)
-
-	r.Post("/", func(writer http.ResponseWriter, request *http.Request) {
-		carrier := propagation.HeaderCarrier(request.Header)
-		ctx := request.Context()
-		ctx = otel.GetTextMapPropagator().Extract(ctx, carrier)
-		ctx, span := tr.Start(ctx, "zipcode service")
-		defer span.End()
-
-		log.Println("starting request service A")
-
-		var reqBody RequestBody
-		err := json.NewDecoder(request.Body).Decode(&reqBody)
-		if err != nil {
-			http.Error(writer, err.Error(), http.StatusBadRequest)
-			return
-		}
-		log.Println(fmt.Sprintf("[zipcode:%s]", reqBody.Zipcode))
-
-		regex := regexp.MustCompile("^[0-9]{8}$")
-		if !regex.MatchString(reqBody.Zipcode) {
-			writer.WriteHeader(http.StatusUnprocessableEntity)
-			http.Error(writer, "invalid zipCode", http.StatusUnprocessableEntity)
-			return
-		}
-
-		endpoint := "http://service-b:8080/temperature"
-		body, _ := json.Marshal(map[string]string{
-			"zipcode": reqBody.Zipcode,
-		})
-
-		req, err := http.NewRequestWithContext(ctx, "POST", endpoint, bytes.NewBuffer(body))
-		if err != nil {
-			http.Error(writer, err.Error(), http.StatusInternalServerError)
-		}
-
-		otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
-		response, err := http.DefaultClient.Do(req)
-		if err != nil {
-			log.Println("error: ", err)
-			http.Error(writer, "error calling service B", http.StatusInternalServerError)
-			return
-		}
-
-		writer.Header().Set("Content-Type", "application/json")
-		writer.WriteHeader(http.StatusOK)
-		defer response.Body.Close()
-		resBody, err := io.ReadAll(response.Body)
-		if err != nil {
-			log.Fatalf("impossible to read all body of response: %s", err)
-		}
-		log.Printf("body: %s", string(resBody))
-		writer.Write(resBody)
-
-	})
-
-	http.ListenAndServe(":8081", r)
+	r.Use(telemetry.DebugHeader(cfg.Telemetry.Sampling.DebugHeader))
+	r.Use(tracing.Middleware(r, tracing.WithIgnoredRoutes(metricsRoute)))
+	r.Use(deadline.Middleware(cfg.Deadline.Budget))
+	r.Use(logging.Middleware(logger))
+	r.Handle(metricsRoute, telemetry.MetricsHandler())
+	r.Handle(health.LivenessRoute, health.Liveness())
+	serviceB := breaker.New("service-b", cfg.Breaker.Settings())
+	r.Handle(health.ReadinessRoute, health.NewReadiness(cfg.Health.Timeout).
+		Add("service-b", health.Cached(health.HTTPGet(&http.Client{Transport: lb.Transport(nil), Timeout: cfg.Health.Timeout}, cfg.HealthURL()), cfg.Health.CacheTTL)).
+		AddNonCritical("breaker.service-b", serviceB.Check))
+
+	r.Post("/", handlers.New(breaker.NewClient(retry.NewClient(client, cfg.Retry.Policy()), serviceB), cfg.TemperatureURL(), handlers.WithMaxBodyBytes(cfg.Server.MaxBodyBytes)).Handler)
+
+	srv := &http.Server{
+		Addr:              cfg.ListenAddr,
+		Handler:           r,
+		ReadHeaderTimeout: cfg.Server.ReadHeaderTimeout,
+		ReadTimeout:       cfg.Server.ReadTimeout,
+		WriteTimeout:      cfg.Server.WriteTimeout,
+		IdleTimeout:       cfg.Server.IdleTimeout,
+	}
+	if err := server.Run(ctx, srv, cfg.Server.ShutdownTimeout, server.ShutdownFunc(shutdown)); err != nil {
+		fatal("server stopped with an error", err)
+	}
 }
 
-type RequestBody struct {
-	Zipcode string `json:"zipcode"`
+// fatal logs err through the default logger and exits.
+func fatal(msg string, err error) {
+	slog.Error(msg, "error", err)
+	os.Exit(1)
 }
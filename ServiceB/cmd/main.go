@@ -3,86 +3,143 @@ package main
 import (
 	"context"
 	"flag"
+	"fmt"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 	"go.opentelemetry.io/otel"
-	"go.opentelemetry.io/otel/exporters/zipkin"
-	"go.opentelemetry.io/otel/propagation"
-	"go.opentelemetry.io/otel/sdk/resource"
-	sdktrace "go.opentelemetry.io/otel/sdk/trace"
-	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
-	"log"
+	"log/slog"
 	"net/http"
 	"os"
 	"os/signal"
+	"syscall"
 	"willianszwy/FC-Cloud-Run/configs"
+	"willianszwy/FC-Cloud-Run/internal/cache"
 	"willianszwy/FC-Cloud-Run/internal/handlers"
+	"willianszwy/FC-Cloud-Run/internal/secrets"
 	"willianszwy/FC-Cloud-Run/internal/viacep"
 	"willianszwy/FC-Cloud-Run/internal/weather"
+	"willianszwy/FC-Tracing/pkg/breaker"
+	"willianszwy/FC-Tracing/pkg/deadline"
+	"willianszwy/FC-Tracing/pkg/health"
+	"willianszwy/FC-Tracing/pkg/logging"
+	"willianszwy/FC-Tracing/pkg/retry"
+	"willianszwy/FC-Tracing/pkg/server"
+	"willianszwy/FC-Tracing/pkg/telemetry"
+	"willianszwy/FC-Tracing/pkg/tracing"
 )
 
-var logger = log.New(os.Stderr, "zipkin-example", log.Ldate|log.Ltime|log.Llongfile)
+const metricsRoute = "/metrics"
 
-func initTracer(url string) (func(context.Context) error, error) {
-	exporter, err := zipkin.New(
-		url,
-		zipkin.WithLogger(logger),
-	)
+func main() {
+	config, err := configs.LoadConfig(".")
 	if err != nil {
-		return nil, err
+		fatal("invalid config", err)
 	}
-
-	batcher := sdktrace.NewBatchSpanProcessor(exporter)
-
-	tp := sdktrace.NewTracerProvider(
-		sdktrace.WithSampler(sdktrace.AlwaysSample()),
-		sdktrace.WithSpanProcessor(batcher),
-		sdktrace.WithResource(resource.NewWithAttributes(
-			semconv.SchemaURL,
-			semconv.ServiceName("service-b"),
-		)),
-	)
-	otel.SetTracerProvider(tp)
-	otel.SetTextMapPropagator(propagation.TraceContext{})
-
-	return tp.Shutdown, nil
-}
-
-func main() {
-
-	url := flag.String("zipkin", "http://zipkin:9411/api/v2/spans", "zipkin url")
+	config.RegisterFlags(flag.CommandLine)
 	flag.Parse()
+	if err := config.Validate(); err != nil {
+		fatal("invalid config", err)
+	}
 
-	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	logger, err := logging.Setup(os.Stdout, config.Log)
+	if err != nil {
+		fatal("invalid log config", err)
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 	defer cancel()
 
-	shutdown, err := initTracer(*url)
+	shutdown, err := telemetry.Setup(ctx, config.Telemetry)
 	if err != nil {
-		log.Fatal(err)
+		fatal("failed to setup telemetry", err)
 	}
-	defer func() {
-		if err := shutdown(ctx); err != nil {
-			log.Fatal("failed to shutdown TracerProvider: %w", err)
-		}
-	}()
 
 	tr := otel.GetTracerProvider().Tracer("component-main")
 
-	config, err := configs.LoadConfig("")
-	if err != nil {
-		panic(err)
-	}
-	log.Println("Start service B...")
+	logger.Info("Start service B...")
 	r := chi.NewRouter()
 	r.Use(middleware.RequestID)
 	r.Use(middleware.RealIP)
-	r.Use(middleware.Logger)
+	r.Use(telemetry.DebugHeader(config.Telemetry.Sampling.DebugHeader))
+	r.Use(tracing.Middleware(r, tracing.WithIgnoredRoutes(metricsRoute)))
+	r.Use(deadline.Middleware(config.Deadline.Budget))
+	r.Use(logging.Middleware(logger))
+	r.Handle(metricsRoute, telemetry.MetricsHandler())
 
-	viaCepClient := viacep.New(http.DefaultClient, tr)
-	weatherClient := weather.New(http.DefaultClient, config.WeatherAPIKey, tr)
-	temperatureHandler := handlers.New(viaCepClient, weatherClient, tr)
+	httpClient := retry.NewClient(tracing.NewClient(), config.Retry.Policy())
+	viaCepBreaker := breaker.New("viacep", config.Breaker.Settings())
+	weatherBreaker := breaker.New("weatherapi", config.Breaker.Settings())
+	viaCepCache := cache.New[viacep.City](config.Cache.ViaCEPTTL)
+	viaCepClient := viacep.New(httpClient, tr,
+		viacep.WithBreaker(viaCepBreaker),
+		viacep.WithBaseURL(config.ViaCEP.URL),
+		viacep.WithTimeout(config.ViaCEP.Timeout),
+		viacep.WithCache(viaCepCache),
+	)
+	weatherCache := cache.New[weather.Response](config.Cache.WeatherTTL)
+	weatherClient := weather.New(httpClient, "", tr,
+		weather.WithBreaker(weatherBreaker),
+		weather.WithBaseURL(config.WeatherAPI.URL),
+		weather.WithTimeout(config.WeatherAPI.Timeout),
+		weather.WithCache(weatherCache),
+	)
+	apiKey, err := secrets.NewRefresher(ctx, secrets.NewResolver(), config.WeatherAPIKey, weatherClient.SetAPIKey)
+	if err != nil {
+		fatal("failed to resolve WEATHER_API_KEY", err)
+	}
+	go apiKey.Run(ctx, config.SecretRefreshInterval)
+	watcher := configs.Watch(config, flag.CommandLine, tr, func(ctx context.Context, c *configs.Config) error {
+		weatherClient.SetTimeout(c.WeatherAPI.Timeout)
+		viaCepClient.SetTimeout(c.ViaCEP.Timeout)
+		weatherCache.SetTTL(c.Cache.WeatherTTL)
+		viaCepCache.SetTTL(c.Cache.ViaCEPTTL)
+		logging.SetLevels(c.Log.Level, c.Log.Levels)
+		if err := telemetry.SetSamplingRatio(c.Telemetry.Sampling.Ratio); err != nil {
+			logger.ErrorContext(ctx, "failed to apply sampler ratio", "error", err)
+		}
+		// A bad reference keeps the current key, reported by the config
+		// check rather than failing the readiness of a working key.
+		if err := apiKey.SetRef(ctx, c.WeatherAPIKey); err != nil {
+			return fmt.Errorf("WEATHER_API_KEY, keeping the current key: %w", err)
+		}
+		return nil
+	})
+	temperatureHandler := handlers.New(viaCepClient, weatherClient,
+		handlers.WithMaxBodyBytes(config.Server.MaxBodyBytes),
+		handlers.WithViaCEPShare(config.Deadline.ViaCEPShare),
+	)
 
 	r.Post("/temperature", temperatureHandler.Handler)
 
-	http.ListenAndServe(":8080", r)
+	readiness := health.NewReadiness(config.Health.Timeout).
+		Add("weather_api_key", func(context.Context) error { return apiKey.Err() }).
+		AddNonCritical("config", func(context.Context) error { return watcher.Err() }).
+		AddNonCritical("breaker.viacep", viaCepBreaker.Check).
+		AddNonCritical("breaker.weatherapi", weatherBreaker.Check)
+	if config.Health.ProbeUpstreams {
+		probeClient := &http.Client{Timeout: config.Health.Timeout}
+		readiness.
+			Add("viacep", health.Cached(health.HTTPGet(probeClient, config.ViaCEP.URL), config.Health.CacheTTL)).
+			Add("weatherapi", health.Cached(health.HTTPGet(probeClient, config.WeatherAPI.URL), config.Health.CacheTTL))
+	}
+	r.Handle(health.LivenessRoute, health.Liveness())
+	r.Handle(health.ReadinessRoute, readiness)
+
+	srv := &http.Server{
+		Addr:              config.Addr(),
+		Handler:           r,
+		ReadHeaderTimeout: config.Server.ReadHeaderTimeout,
+		ReadTimeout:       config.Server.ReadTimeout,
+		WriteTimeout:      config.Server.WriteTimeout,
+		IdleTimeout:       config.Server.IdleTimeout,
+	}
+	if err := server.Run(ctx, srv, config.Server.ShutdownTimeout, server.ShutdownFunc(shutdown)); err != nil {
+		fatal("server stopped with an error", err)
+	}
+}
+
+// fatal logs err through the default logger and exits.
+func fatal(msg string, err error) {
+	slog.Error(msg, "error", err)
+	os.Exit(1)
 }
@@ -1,31 +1,433 @@
 package configs
 
-import "github.com/spf13/viper"
-
-var cfg *Config
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/spf13/viper"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+	"willianszwy/FC-Cloud-Run/internal/secrets"
+	"willianszwy/FC-Tracing/pkg/breaker"
+	"willianszwy/FC-Tracing/pkg/health"
+	"willianszwy/FC-Tracing/pkg/logging"
+	"willianszwy/FC-Tracing/pkg/retry"
+	"willianszwy/FC-Tracing/pkg/server"
+	"willianszwy/FC-Tracing/pkg/telemetry"
+)
 
+// Config holds every setting of ServiceB.
+//
+// Values come from the environment, then the .env file of the directory
+// given to LoadConfig, then the defaults. The .env file can also set the
+// OTEL_* and LOG_* variables read by the telemetry and logging settings.
 type Config struct {
-	WeatherAPIKey string `mapstructure:"WEATHER_API_KEY"`
+	Port int `mapstructure:"PORT"`
+	// WeatherAPIKey is the key or a reference to it, see secrets.Resolver.
+	WeatherAPIKey secrets.Secret `mapstructure:"WEATHER_API_KEY"`
+	// SecretRefreshInterval is how often secret references are resolved
+	// again, zero disables it.
+	SecretRefreshInterval time.Duration `mapstructure:"SECRET_REFRESH_INTERVAL"`
+
+	ViaCEP     UpstreamConfig `mapstructure:"-"`
+	WeatherAPI UpstreamConfig `mapstructure:"-"`
+	Server     ServerConfig   `mapstructure:",squash"`
+	Cache      CacheConfig    `mapstructure:",squash"`
+	Health     HealthConfig   `mapstructure:",squash"`
+	Retry      RetryConfig    `mapstructure:",squash"`
+	Breaker    BreakerConfig  `mapstructure:",squash"`
+	Deadline   DeadlineConfig `mapstructure:",squash"`
+
+	Telemetry telemetry.Config `mapstructure:"-"`
+	Log       logging.Config   `mapstructure:"-"`
+
+	// path and dotEnvKeys let Watch read the .env file again, overriding
+	// only the variables that came from it.
+	path       string
+	dotEnvKeys map[string]bool
 }
 
-func LoadConfig(path string) (*Config, error) {
-	if cfg != nil {
-		return cfg, nil
+// UpstreamConfig locates an upstream API, read from <NAME>_URL and
+// <NAME>_TIMEOUT.
+type UpstreamConfig struct {
+	URL     string
+	Timeout time.Duration
+}
+
+// ServerConfig holds the limits of the HTTP server.
+type ServerConfig struct {
+	ReadHeaderTimeout time.Duration `mapstructure:"SERVER_READ_HEADER_TIMEOUT"`
+	ReadTimeout       time.Duration `mapstructure:"SERVER_READ_TIMEOUT"`
+	WriteTimeout      time.Duration `mapstructure:"SERVER_WRITE_TIMEOUT"`
+	IdleTimeout       time.Duration `mapstructure:"SERVER_IDLE_TIMEOUT"`
+	ShutdownTimeout   time.Duration `mapstructure:"SERVER_SHUTDOWN_TIMEOUT"`
+	// MaxBodyBytes bounds request bodies.
+	MaxBodyBytes int64 `mapstructure:"SERVER_MAX_BODY_BYTES"`
+}
+
+// CacheConfig holds the lifetime of cached upstream answers, zero disables
+// a cache.
+type CacheConfig struct {
+	ViaCEPTTL  time.Duration `mapstructure:"VIACEP_CACHE_TTL"`
+	WeatherTTL time.Duration `mapstructure:"WEATHER_CACHE_TTL"`
+}
+
+// HealthConfig tunes the readiness checks.
+type HealthConfig struct {
+	// ProbeUpstreams makes readiness depend on ViaCEP and WeatherAPI being
+	// reachable.
+	ProbeUpstreams bool          `mapstructure:"HEALTH_PROBE_UPSTREAMS"`
+	CacheTTL       time.Duration `mapstructure:"HEALTH_CACHE_TTL"`
+	Timeout        time.Duration `mapstructure:"HEALTH_TIMEOUT"`
+}
+
+// RetryConfig is the retry policy of the ViaCEP and WeatherAPI calls.
+type RetryConfig struct {
+	MaxAttempts    int           `mapstructure:"RETRY_MAX_ATTEMPTS"`
+	InitialBackoff time.Duration `mapstructure:"RETRY_INITIAL_BACKOFF"`
+	MaxBackoff     time.Duration `mapstructure:"RETRY_MAX_BACKOFF"`
+	// Jitter is the randomized fraction of each backoff, from 0 to 1.
+	Jitter   float64 `mapstructure:"RETRY_JITTER"`
+	Statuses []int   `mapstructure:"RETRY_STATUSES"`
+}
+
+// Policy is the retry policy described by r.
+func (r RetryConfig) Policy() retry.Policy {
+	return retry.Policy{
+		MaxAttempts:    r.MaxAttempts,
+		InitialBackoff: r.InitialBackoff,
+		MaxBackoff:     r.MaxBackoff,
+		Jitter:         r.Jitter,
+		Statuses:       r.Statuses,
 	}
+}
 
-	viper.SetConfigName("configs")
-	viper.SetConfigType("env")
-	viper.AddConfigPath(path)
-	viper.SetConfigFile(".env")
-	viper.AutomaticEnv()
+// BreakerConfig tunes the circuit breakers of ViaCEP and WeatherAPI, one
+// per upstream.
+type BreakerConfig struct {
+	WindowSize       int           `mapstructure:"BREAKER_WINDOW_SIZE"`
+	MinCalls         int           `mapstructure:"BREAKER_MIN_CALLS"`
+	FailureRate      float64       `mapstructure:"BREAKER_FAILURE_RATE"`
+	SlowCallDuration time.Duration `mapstructure:"BREAKER_SLOW_CALL_DURATION"`
+	SlowCallRate     float64       `mapstructure:"BREAKER_SLOW_CALL_RATE"`
+	OpenTimeout      time.Duration `mapstructure:"BREAKER_OPEN_TIMEOUT"`
+	HalfOpenCalls    int           `mapstructure:"BREAKER_HALF_OPEN_CALLS"`
+}
 
-	if err := viper.ReadInConfig(); err != nil {
+// Settings are the breaker settings described by b.
+func (b BreakerConfig) Settings() breaker.Settings {
+	return breaker.Settings{
+		WindowSize:       b.WindowSize,
+		MinCalls:         b.MinCalls,
+		FailureRate:      b.FailureRate,
+		SlowCallDuration: b.SlowCallDuration,
+		SlowCallRate:     b.SlowCallRate,
+		OpenTimeout:      b.OpenTimeout,
+		HalfOpenCalls:    b.HalfOpenCalls,
+	}
+}
+
+// DeadlineConfig bounds the handling of a request.
+type DeadlineConfig struct {
+	// Budget bounds requests without a budget from ServiceA, and caps the
+	// ones with it.
+	Budget time.Duration `mapstructure:"DEADLINE_BUDGET"`
+	// ViaCEPShare is the share of the time left that the ViaCEP lookup may
+	// use, the rest is kept for WeatherAPI.
+	ViaCEPShare float64 `mapstructure:"DEADLINE_VIACEP_SHARE"`
+}
+
+var defaults = map[string]any{
+	"PORT":                       8080,
+	"VIACEP_URL":                 "https://viacep.com.br/ws",
+	"VIACEP_TIMEOUT":             3 * time.Second,
+	"WEATHER_API_URL":            "https://api.weatherapi.com/v1",
+	"WEATHER_API_TIMEOUT":        3 * time.Second,
+	"SERVER_READ_HEADER_TIMEOUT": 2 * time.Second,
+	"SERVER_READ_TIMEOUT":        5 * time.Second,
+	"SERVER_WRITE_TIMEOUT":       10 * time.Second,
+	"SERVER_IDLE_TIMEOUT":        60 * time.Second,
+	"SERVER_SHUTDOWN_TIMEOUT":    10 * time.Second,
+	"SERVER_MAX_BODY_BYTES":      server.DefaultMaxBodyBytes,
+	"VIACEP_CACHE_TTL":           24 * time.Hour,
+	"WEATHER_CACHE_TTL":          5 * time.Minute,
+	"WEATHER_API_KEY":            "",
+	"SECRET_REFRESH_INTERVAL":    time.Minute,
+	"HEALTH_PROBE_UPSTREAMS":     false,
+	"HEALTH_CACHE_TTL":           30 * time.Second,
+	"HEALTH_TIMEOUT":             health.DefaultTimeout,
+	"RETRY_MAX_ATTEMPTS":         3,
+	"RETRY_INITIAL_BACKOFF":      100 * time.Millisecond,
+	"RETRY_MAX_BACKOFF":          time.Second,
+	"RETRY_JITTER":               0.2,
+	"RETRY_STATUSES":             retry.DefaultStatuses,
+	"BREAKER_WINDOW_SIZE":        breaker.DefaultSettings().WindowSize,
+	"BREAKER_MIN_CALLS":          breaker.DefaultSettings().MinCalls,
+	"BREAKER_FAILURE_RATE":       breaker.DefaultSettings().FailureRate,
+	"BREAKER_SLOW_CALL_DURATION": breaker.DefaultSettings().SlowCallDuration,
+	"BREAKER_SLOW_CALL_RATE":     breaker.DefaultSettings().SlowCallRate,
+	"BREAKER_OPEN_TIMEOUT":       breaker.DefaultSettings().OpenTimeout,
+	"BREAKER_HALF_OPEN_CALLS":    breaker.DefaultSettings().HalfOpenCalls,
+	"DEADLINE_BUDGET":            5 * time.Second,
+	"DEADLINE_VIACEP_SHARE":      0.4,
+}
+
+// LoadConfig returns the validated config, reading the optional .env file
+// of the directory path, the working directory when empty. Every invalid
+// or missing setting is reported at once.
+func LoadConfig(path string) (*Config, error) {
+	keys, err := loadDotEnv(filepath.Join(path, ".env"), nil)
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := fromEnv(nil)
+	if err != nil {
 		return nil, err
 	}
+	cfg.path, cfg.dotEnvKeys = path, keys
+	return cfg, nil
+}
 
-	if err := viper.Unmarshal(&cfg); err != nil {
+// reload reads the .env file again and returns the validated config, with
+// the flags set on fs applied on top of it.
+func (c *Config) reload(fs *flag.FlagSet) (*Config, error) {
+	keys, err := loadDotEnv(filepath.Join(c.path, ".env"), c.dotEnvKeys)
+	if err != nil {
+		return nil, err
+	}
+	next, err := fromEnv(fs)
+	if err != nil {
+		// The rejected .env values are in the environment now, keep them
+		// owned so the next reload replaces them.
+		c.dotEnvKeys = keys
 		return nil, err
 	}
+	next.path, next.dotEnvKeys = c.path, keys
+	return next, nil
+}
 
+// fromEnv builds the config from the environment, applies the flags set on
+// fs and validates it.
+func fromEnv(fs *flag.FlagSet) (*Config, error) {
+	// Decoding the defaults first keeps them in the fields whose value does
+	// not parse, so each bad variable is reported once.
+	cfg := &Config{}
+	if err := newViper().Unmarshal(cfg); err != nil {
+		return nil, err
+	}
+	// Slices are decoded over the existing items, drop the default ones.
+	cfg.Retry.Statuses = nil
+	v := newViper()
+	v.AutomaticEnv()
+	var errs []error
+	if err := v.Unmarshal(cfg); err != nil {
+		errs = append(errs, err)
+	}
+	// The upstreams share UpstreamConfig, so their keys are read by hand.
+	cfg.ViaCEP.URL = v.GetString("VIACEP_URL")
+	cfg.WeatherAPI.URL = v.GetString("WEATHER_API_URL")
+	for _, d := range []struct {
+		key string
+		to  *time.Duration
+	}{
+		{"VIACEP_TIMEOUT", &cfg.ViaCEP.Timeout},
+		{"WEATHER_API_TIMEOUT", &cfg.WeatherAPI.Timeout},
+	} {
+		*d.to = defaults[d.key].(time.Duration)
+		if timeout, err := time.ParseDuration(v.GetString(d.key)); err != nil {
+			errs = append(errs, fmt.Errorf("%s: must be a duration such as 3s, got %q", d.key, v.GetString(d.key)))
+		} else {
+			*d.to = timeout
+		}
+	}
+	var logErr, telemetryErr error
+	cfg.Log, logErr = logging.ConfigFromEnv()
+	cfg.Telemetry, telemetryErr = telemetry.ConfigFromEnv("service-b")
+	if logErr == nil && telemetryErr == nil {
+		errs = append(errs, cfg.applyFlags(fs))
+		logErr, telemetryErr = cfg.Log.Validate(), cfg.Telemetry.Validate()
+	}
+	errs = append(errs, cfg.validate(), logErr, telemetryErr)
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
 	return cfg, nil
 }
+
+func newViper() *viper.Viper {
+	v := viper.New()
+	for key, value := range defaults {
+		v.SetDefault(key, value)
+	}
+	return v
+}
+
+// RegisterFlags binds the telemetry and logging settings to fs, using the
+// current values as defaults so flags take precedence over the environment.
+func (c *Config) RegisterFlags(fs *flag.FlagSet) {
+	c.Log.RegisterFlags(fs)
+	c.Telemetry.RegisterFlags(fs)
+}
+
+// applyFlags sets the flags set on fs again on c.
+func (c *Config) applyFlags(fs *flag.FlagSet) error {
+	if fs == nil {
+		return nil
+	}
+	fresh := flag.NewFlagSet(fs.Name(), flag.ContinueOnError)
+	c.RegisterFlags(fresh)
+	var errs []error
+	fs.Visit(func(f *flag.Flag) {
+		if fresh.Lookup(f.Name) != nil {
+			errs = append(errs, fresh.Set(f.Name, f.Value.String()))
+		}
+	})
+	return errors.Join(errs...)
+}
+
+// Validate reports every invalid setting, naming the variable that set it.
+func (c *Config) Validate() error {
+	return errors.Join(c.validate(), c.Log.Validate(), c.Telemetry.Validate())
+}
+
+// validate checks the settings owned by ServiceB.
+func (c *Config) validate() error {
+	var errs []error
+	if c.Port < 1 || c.Port > 65535 {
+		errs = append(errs, fmt.Errorf("PORT: must be between 1 and 65535, got %d", c.Port))
+	}
+	if c.WeatherAPIKey == "" {
+		errs = append(errs, errors.New("WEATHER_API_KEY: is required, get one at https://www.weatherapi.com"))
+	} else if err := secrets.NewResolver().Validate(c.WeatherAPIKey); err != nil {
+		errs = append(errs, fmt.Errorf("WEATHER_API_KEY: %w", err))
+	}
+	if c.Server.MaxBodyBytes < 1 {
+		errs = append(errs, fmt.Errorf("SERVER_MAX_BODY_BYTES: must be at least 1, got %d", c.Server.MaxBodyBytes))
+	}
+	for _, u := range []struct {
+		name  string
+		value string
+	}{
+		{"VIACEP_URL", c.ViaCEP.URL},
+		{"WEATHER_API_URL", c.WeatherAPI.URL},
+	} {
+		if parsed, err := url.Parse(u.value); err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			errs = append(errs, fmt.Errorf("%s: must be an absolute http or https URL, got %q", u.name, u.value))
+		}
+	}
+	for _, d := range []struct {
+		name  string
+		value time.Duration
+	}{
+		{"VIACEP_TIMEOUT", c.ViaCEP.Timeout},
+		{"WEATHER_API_TIMEOUT", c.WeatherAPI.Timeout},
+		{"SERVER_READ_HEADER_TIMEOUT", c.Server.ReadHeaderTimeout},
+		{"SERVER_READ_TIMEOUT", c.Server.ReadTimeout},
+		{"SERVER_WRITE_TIMEOUT", c.Server.WriteTimeout},
+		{"SERVER_IDLE_TIMEOUT", c.Server.IdleTimeout},
+		{"SERVER_SHUTDOWN_TIMEOUT", c.Server.ShutdownTimeout},
+		{"HEALTH_TIMEOUT", c.Health.Timeout},
+		{"RETRY_INITIAL_BACKOFF", c.Retry.InitialBackoff},
+		{"RETRY_MAX_BACKOFF", c.Retry.MaxBackoff},
+		{"BREAKER_SLOW_CALL_DURATION", c.Breaker.SlowCallDuration},
+		{"BREAKER_OPEN_TIMEOUT", c.Breaker.OpenTimeout},
+		{"DEADLINE_BUDGET", c.Deadline.Budget},
+	} {
+		if d.value <= 0 {
+			errs = append(errs, fmt.Errorf("%s: must be a positive duration such as 5s, got %s", d.name, d.value))
+		}
+	}
+	for _, d := range []struct {
+		name  string
+		value time.Duration
+	}{
+		{"VIACEP_CACHE_TTL", c.Cache.ViaCEPTTL},
+		{"WEATHER_CACHE_TTL", c.Cache.WeatherTTL},
+		{"SECRET_REFRESH_INTERVAL", c.SecretRefreshInterval},
+		{"HEALTH_CACHE_TTL", c.Health.CacheTTL},
+	} {
+		if d.value < 0 {
+			errs = append(errs, fmt.Errorf("%s: must not be negative, use 0 to disable it, got %s", d.name, d.value))
+		}
+	}
+	if c.Retry.MaxAttempts < 1 {
+		errs = append(errs, fmt.Errorf("RETRY_MAX_ATTEMPTS: must be at least 1, got %d", c.Retry.MaxAttempts))
+	}
+	if c.Retry.MaxBackoff < c.Retry.InitialBackoff {
+		errs = append(errs, fmt.Errorf("RETRY_MAX_BACKOFF: must not be below RETRY_INITIAL_BACKOFF %s, got %s", c.Retry.InitialBackoff, c.Retry.MaxBackoff))
+	}
+	if c.Retry.Jitter < 0 || c.Retry.Jitter > 1 {
+		errs = append(errs, fmt.Errorf("RETRY_JITTER: must be between 0 and 1, got %g", c.Retry.Jitter))
+	}
+	for _, status := range c.Retry.Statuses {
+		if status < 100 || status > 599 {
+			errs = append(errs, fmt.Errorf("RETRY_STATUSES: must be HTTP statuses, got %d", status))
+		}
+	}
+	for _, n := range []struct {
+		name  string
+		value int
+	}{
+		{"BREAKER_WINDOW_SIZE", c.Breaker.WindowSize},
+		{"BREAKER_MIN_CALLS", c.Breaker.MinCalls},
+		{"BREAKER_HALF_OPEN_CALLS", c.Breaker.HalfOpenCalls},
+	} {
+		if n.value < 1 {
+			errs = append(errs, fmt.Errorf("%s: must be at least 1, got %d", n.name, n.value))
+		}
+	}
+	for _, r := range []struct {
+		name  string
+		value float64
+	}{
+		{"BREAKER_FAILURE_RATE", c.Breaker.FailureRate},
+		{"BREAKER_SLOW_CALL_RATE", c.Breaker.SlowCallRate},
+		{"DEADLINE_VIACEP_SHARE", c.Deadline.ViaCEPShare},
+	} {
+		if r.value <= 0 || r.value > 1 {
+			errs = append(errs, fmt.Errorf("%s: must be above 0 and at most 1, got %g", r.name, r.value))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Addr is the address the server listens on.
+func (c *Config) Addr() string {
+	return ":" + strconv.Itoa(c.Port)
+}
+
+// loadDotEnv sets the variables of a dotenv file that are not already set
+// in the environment, or that were set from the file before as listed by
+// owned, and unsets the owned ones the file no longer has. It returns the
+// variables now set from the file. A missing file is not an error.
+func loadDotEnv(path string, owned map[string]bool) (map[string]bool, error) {
+	values := map[string]string{}
+	if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+		v := viper.New()
+		v.SetConfigFile(path)
+		v.SetConfigType("env")
+		if err := v.ReadInConfig(); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		for _, key := range v.AllKeys() {
+			values[strings.ToUpper(key)] = v.GetString(key)
+		}
+	}
+	keys := map[string]bool{}
+	for key, value := range values {
+		if _, ok := os.LookupEnv(key); !ok || owned[key] {
+			os.Setenv(key, value)
+			keys[key] = true
+		}
+	}
+	for key := range owned {
+		if _, ok := values[key]; !ok {
+			os.Unsetenv(key)
+		}
+	}
+	return keys, nil
+}
@@ -0,0 +1,139 @@
+package configs
+
+import (
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// unsetenv unsets keys for the test, restoring them on cleanup, as
+// LoadConfig sets the variables read from the .env file.
+func unsetenv(t *testing.T, keys ...string) {
+	for _, key := range keys {
+		t.Setenv(key, "")
+		os.Unsetenv(key)
+	}
+}
+
+func TestLoadConfig_EnvOnly(t *testing.T) {
+	t.Setenv("WEATHER_API_KEY", "secret")
+	t.Setenv("PORT", "9090")
+	t.Setenv("VIACEP_TIMEOUT", "1s")
+
+	cfg, err := LoadConfig(t.TempDir())
+
+	assert.Nil(t, err)
+	assert.Equal(t, "secret", cfg.WeatherAPIKey.Reveal())
+	assert.Equal(t, ":9090", cfg.Addr())
+	assert.Equal(t, time.Second, cfg.ViaCEP.Timeout)
+	assert.Equal(t, "https://api.weatherapi.com/v1", cfg.WeatherAPI.URL)
+	assert.Equal(t, 24*time.Hour, cfg.Cache.ViaCEPTTL)
+	assert.Equal(t, "service-b", cfg.Telemetry.ServiceName)
+}
+
+func TestLoadConfig_DotEnv(t *testing.T) {
+	dir := t.TempDir()
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, ".env"), []byte("WEATHER_API_KEY=fromfile\nWEATHER_CACHE_TTL=0s\nPORT=7000\nLOG_LEVEL=debug\n"), 0o600))
+	unsetenv(t, "WEATHER_API_KEY", "WEATHER_CACHE_TTL", "LOG_LEVEL")
+	t.Setenv("PORT", "7001")
+
+	cfg, err := LoadConfig(dir)
+
+	assert.Nil(t, err)
+	assert.Equal(t, "fromfile", cfg.WeatherAPIKey.Reveal())
+	assert.Equal(t, time.Duration(0), cfg.Cache.WeatherTTL)
+	assert.Equal(t, 7001, cfg.Port)
+	assert.Equal(t, "DEBUG", cfg.Log.Level.String())
+}
+
+func TestLoadConfig_ReturnsFreshConfig(t *testing.T) {
+	t.Setenv("WEATHER_API_KEY", "first")
+	first, err := LoadConfig(t.TempDir())
+	assert.Nil(t, err)
+	t.Setenv("WEATHER_API_KEY", "second")
+
+	second, err := LoadConfig(t.TempDir())
+
+	assert.Nil(t, err)
+	assert.Equal(t, "first", first.WeatherAPIKey.Reveal())
+	assert.Equal(t, "second", second.WeatherAPIKey.Reveal())
+}
+
+func TestLoadConfig_ReportsAllErrors(t *testing.T) {
+	unsetenv(t, "WEATHER_API_KEY")
+	t.Setenv("PORT", "0")
+	t.Setenv("VIACEP_URL", "viacep.com.br")
+	t.Setenv("WEATHER_API_TIMEOUT", "soon")
+	t.Setenv("SERVER_READ_TIMEOUT", "0s")
+	t.Setenv("VIACEP_CACHE_TTL", "-1m")
+	t.Setenv("SERVER_IDLE_TIMEOUT", "forever")
+
+	_, err := LoadConfig(t.TempDir())
+
+	assert.ErrorContains(t, err, `WEATHER_API_TIMEOUT: must be a duration such as 3s, got "soon"`)
+	assert.NotContains(t, err.Error(), "WEATHER_API_TIMEOUT: must be a positive")
+	assert.ErrorContains(t, err, "PORT: must be between 1 and 65535")
+	assert.ErrorContains(t, err, "WEATHER_API_KEY: is required")
+	assert.ErrorContains(t, err, `VIACEP_URL: must be an absolute http or https URL, got "viacep.com.br"`)
+	assert.ErrorContains(t, err, "SERVER_READ_TIMEOUT: must be a positive duration")
+	assert.ErrorContains(t, err, "VIACEP_CACHE_TTL: must not be negative")
+	assert.ErrorContains(t, err, "SERVER_IDLE_TIMEOUT")
+	assert.NotContains(t, err.Error(), "SERVER_IDLE_TIMEOUT: must be a positive")
+}
+
+func TestLoadConfig_Retry(t *testing.T) {
+	t.Setenv("WEATHER_API_KEY", "secret")
+	t.Setenv("RETRY_STATUSES", "503,504")
+
+	cfg, err := LoadConfig(t.TempDir())
+
+	assert.Nil(t, err)
+	policy := cfg.Retry.Policy()
+	assert.Equal(t, 3, policy.MaxAttempts)
+	assert.Equal(t, 100*time.Millisecond, policy.InitialBackoff)
+	assert.Equal(t, []int{503, 504}, policy.Statuses)
+
+	t.Setenv("RETRY_MAX_ATTEMPTS", "0")
+	t.Setenv("RETRY_JITTER", "1.5")
+	_, err = LoadConfig(t.TempDir())
+	assert.ErrorContains(t, err, "RETRY_MAX_ATTEMPTS: must be at least 1")
+	assert.ErrorContains(t, err, "RETRY_JITTER: must be between 0 and 1")
+}
+
+func TestLoadConfig_Breaker(t *testing.T) {
+	t.Setenv("WEATHER_API_KEY", "secret")
+	t.Setenv("BREAKER_OPEN_TIMEOUT", "1m")
+
+	cfg, err := LoadConfig(t.TempDir())
+
+	assert.Nil(t, err)
+	settings := cfg.Breaker.Settings()
+	assert.Equal(t, time.Minute, settings.OpenTimeout)
+	assert.Equal(t, 20, settings.WindowSize)
+	assert.Equal(t, 0.5, settings.FailureRate)
+
+	t.Setenv("BREAKER_FAILURE_RATE", "0")
+	t.Setenv("BREAKER_HALF_OPEN_CALLS", "0")
+	_, err = LoadConfig(t.TempDir())
+	assert.ErrorContains(t, err, "BREAKER_FAILURE_RATE: must be above 0 and at most 1, got 0")
+	assert.ErrorContains(t, err, "BREAKER_HALF_OPEN_CALLS: must be at least 1, got 0")
+}
+
+func TestLoadConfig_Deadline(t *testing.T) {
+	t.Setenv("WEATHER_API_KEY", "secret")
+	t.Setenv("DEADLINE_BUDGET", "3s")
+
+	cfg, err := LoadConfig(t.TempDir())
+
+	assert.Nil(t, err)
+	assert.Equal(t, 3*time.Second, cfg.Deadline.Budget)
+	assert.Equal(t, 0.4, cfg.Deadline.ViaCEPShare)
+
+	t.Setenv("DEADLINE_BUDGET", "0s")
+	t.Setenv("DEADLINE_VIACEP_SHARE", "1.5")
+	_, err = LoadConfig(t.TempDir())
+	assert.ErrorContains(t, err, "DEADLINE_BUDGET: must be a positive duration")
+	assert.ErrorContains(t, err, "DEADLINE_VIACEP_SHARE: must be above 0 and at most 1, got 1.5")
+}
@@ -0,0 +1,156 @@
+package configs
+
+import (
+	"context"
+	"flag"
+	"github.com/fsnotify/fsnotify"
+	"github.com/spf13/viper"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"willianszwy/FC-Tracing/pkg/logging"
+	"willianszwy/FC-Tracing/pkg/tracing"
+)
+
+// ChangedKey lists the settings changed by a config reload.
+const ChangedKey = attribute.Key("config.changed")
+
+// EventReloaded is added to the reload span when new settings are applied.
+const EventReloaded = "config.reloaded"
+
+var logger = logging.Package("configs")
+
+// reloadable lists the settings that can change while the service runs,
+// each with the function copying it from src to dst.
+var reloadable = []struct {
+	name string
+	copy func(dst, src *Config)
+}{
+	{"WEATHER_API_KEY", func(dst, src *Config) { dst.WeatherAPIKey = src.WeatherAPIKey }},
+	{"LOG_LEVEL", func(dst, src *Config) { dst.Log.Level = src.Log.Level }},
+	{"LOG_LEVELS", func(dst, src *Config) { dst.Log.Levels = src.Log.Levels }},
+	{"OTEL_TRACES_SAMPLER_ARG", func(dst, src *Config) { dst.Telemetry.Sampling.Ratio = src.Telemetry.Sampling.Ratio }},
+	{"VIACEP_CACHE_TTL", func(dst, src *Config) { dst.Cache.ViaCEPTTL = src.Cache.ViaCEPTTL }},
+	{"WEATHER_CACHE_TTL", func(dst, src *Config) { dst.Cache.WeatherTTL = src.Cache.WeatherTTL }},
+	{"VIACEP_TIMEOUT", func(dst, src *Config) { dst.ViaCEP.Timeout = src.ViaCEP.Timeout }},
+	{"WEATHER_API_TIMEOUT", func(dst, src *Config) { dst.WeatherAPI.Timeout = src.WeatherAPI.Timeout }},
+}
+
+// ApplyFunc hands the reloaded config to the running components. An error
+// means some of it could not be applied.
+type ApplyFunc func(ctx context.Context, cfg *Config) error
+
+// Watch reloads the .env file cfg was loaded from whenever it changes. The
+// new config is validated first, then the reloadable settings that changed
+// are handed to apply, and handed again on the next reload when apply fails;
+// changes to other settings are logged as needing a restart. Flags set on fs keep precedence. Each reload is traced with tr.
+// Without a .env file there is nothing to watch and Watch returns nil.
+func Watch(cfg *Config, fs *flag.FlagSet, tr trace.Tracer, apply ApplyFunc) *Watcher {
+	path := filepath.Join(cfg.path, ".env")
+	if _, err := os.Stat(path); err != nil {
+		logger.Info("config reload disabled, no .env file", "path", path)
+		return nil
+	}
+	w := &Watcher{current: cfg, fs: fs, tr: tr, apply: apply}
+	v := viper.New()
+	v.SetConfigFile(path)
+	v.SetConfigType("env")
+	v.OnConfigChange(func(fsnotify.Event) {
+		w.reload(context.Background())
+	})
+	v.WatchConfig()
+	return w
+}
+
+// Watcher reloads the .env file of a config.
+type Watcher struct {
+	mu      sync.Mutex
+	current *Config
+	fs      *flag.FlagSet
+	tr      trace.Tracer
+	apply   ApplyFunc
+	err     error
+}
+
+// Err reports why the last reload was rejected or failed to apply, nil once
+// a reload is applied. A nil Watcher has no error.
+func (w *Watcher) Err() error {
+	if w == nil {
+		return nil
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.err
+}
+
+func (w *Watcher) reload(ctx context.Context) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	ctx, span := w.tr.Start(ctx, "config.reload")
+	defer span.End()
+
+	next, err := w.current.reload(w.fs)
+	if err != nil {
+		err = tracing.Classify(tracing.ErrorValidation, err)
+		logger.ErrorContext(ctx, "config reload rejected", "error", err)
+		tracing.RecordError(span, err)
+		w.err = err
+		return
+	}
+	w.err = nil
+	if restartOnly(w.current, next) {
+		logger.WarnContext(ctx, "config change needs a restart", "reloadable", reloadableNames())
+	}
+	applied := *w.current
+	applied.dotEnvKeys = next.dotEnvKeys
+	var changed []string
+	for _, r := range reloadable {
+		probe := applied
+		r.copy(&probe, next)
+		if !reflect.DeepEqual(probe, applied) {
+			changed = append(changed, r.name)
+			applied = probe
+		}
+	}
+	span.SetAttributes(ChangedKey.StringSlice(changed))
+	if len(changed) == 0 {
+		w.current = &applied
+		return
+	}
+	if err := w.apply(ctx, &applied); err != nil {
+		logger.ErrorContext(ctx, "config reload not applied", "error", err)
+		tracing.RecordError(span, err)
+		w.err = err
+		// Keep the current settings so the next reload applies them again,
+		// only the .env values now in the environment change hands.
+		kept := *w.current
+		kept.dotEnvKeys = next.dotEnvKeys
+		w.current = &kept
+		return
+	}
+	w.current = &applied
+	span.AddEvent(EventReloaded, trace.WithAttributes(ChangedKey.StringSlice(changed)))
+	logger.InfoContext(ctx, "config reloaded", "changed", changed)
+}
+
+// restartOnly reports whether next differs from current in settings that
+// are not reloadable.
+func restartOnly(current, next *Config) bool {
+	probe := *next
+	for _, r := range reloadable {
+		r.copy(&probe, current)
+	}
+	probe.dotEnvKeys = current.dotEnvKeys
+	return !reflect.DeepEqual(probe, *current)
+}
+
+func reloadableNames() []string {
+	var names []string
+	for _, r := range reloadable {
+		names = append(names, r.name)
+	}
+	return names
+}
@@ -0,0 +1,166 @@
+package configs
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func writeDotEnv(t *testing.T, dir, content string) {
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, ".env"), []byte(content), 0o600))
+}
+
+func newWatcher(t *testing.T, dir string, fs *flag.FlagSet) (*Watcher, *tracetest.SpanRecorder, *[]*Config) {
+	return newFailingWatcher(t, dir, fs, nil)
+}
+
+// newFailingWatcher applies configs failing with *applyErr when set.
+func newFailingWatcher(t *testing.T, dir string, fs *flag.FlagSet, applyErr *error) (*Watcher, *tracetest.SpanRecorder, *[]*Config) {
+	unsetenv(t, "WEATHER_API_KEY", "WEATHER_API_TIMEOUT", "PORT", "LOG_LEVEL", "OTEL_TRACES_SAMPLER_ARG")
+	cfg, err := LoadConfig(dir)
+	assert.Nil(t, err)
+	if fs != nil {
+		cfg.RegisterFlags(fs)
+	}
+	sr := tracetest.NewSpanRecorder()
+	var applied []*Config
+	w := &Watcher{
+		current: cfg,
+		fs:      fs,
+		tr:      sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr)).Tracer("test"),
+		apply: func(_ context.Context, cfg *Config) error {
+			applied = append(applied, cfg)
+			if applyErr != nil {
+				return *applyErr
+			}
+			return nil
+		},
+	}
+	return w, sr, &applied
+}
+
+func TestWatcher_Reload(t *testing.T) {
+	dir := t.TempDir()
+	writeDotEnv(t, dir, "WEATHER_API_KEY=old\nWEATHER_API_TIMEOUT=1s\n")
+	w, sr, applied := newWatcher(t, dir, nil)
+
+	writeDotEnv(t, dir, "WEATHER_API_KEY=new\nWEATHER_API_TIMEOUT=2s\nPORT=9000\n")
+	w.reload(context.TODO())
+
+	assert.Len(t, *applied, 1)
+	assert.Equal(t, "new", (*applied)[0].WeatherAPIKey.Reveal())
+	assert.Equal(t, 2*time.Second, (*applied)[0].WeatherAPI.Timeout)
+	assert.Equal(t, 8080, (*applied)[0].Port)
+	span := sr.Ended()[0]
+	assert.Equal(t, "config.reload", span.Name())
+	assert.Contains(t, span.Attributes(), ChangedKey.StringSlice([]string{"WEATHER_API_KEY", "WEATHER_API_TIMEOUT"}))
+	assert.Equal(t, EventReloaded, span.Events()[0].Name)
+}
+
+func TestWatcher_RejectsInvalidConfig(t *testing.T) {
+	dir := t.TempDir()
+	writeDotEnv(t, dir, "WEATHER_API_KEY=old\n")
+	w, sr, applied := newWatcher(t, dir, nil)
+
+	writeDotEnv(t, dir, "WEATHER_API_TIMEOUT=-1s\n")
+	w.reload(context.TODO())
+
+	assert.Empty(t, *applied)
+	assert.Equal(t, "old", w.current.WeatherAPIKey.Reveal())
+	span := sr.Ended()[0]
+	assert.Equal(t, codes.Error, span.Status().Code)
+	assert.Contains(t, span.Status().Description, "WEATHER_API_KEY: is required")
+	assert.ErrorContains(t, w.Err(), "WEATHER_API_KEY: is required")
+
+	writeDotEnv(t, dir, "WEATHER_API_KEY=new\nWEATHER_API_TIMEOUT=1s\n")
+	w.reload(context.TODO())
+	assert.Nil(t, w.Err())
+}
+
+func TestWatcher_RecoversFromRejectedReload(t *testing.T) {
+	dir := t.TempDir()
+	writeDotEnv(t, dir, "WEATHER_API_KEY=old\n")
+	w, _, applied := newWatcher(t, dir, nil)
+
+	writeDotEnv(t, dir, "WEATHER_API_KEY=old\nWEATHER_API_TIMEOUT=-1s\n")
+	w.reload(context.TODO())
+	writeDotEnv(t, dir, "WEATHER_API_KEY=old\nWEATHER_API_TIMEOUT=2s\n")
+	w.reload(context.TODO())
+
+	assert.Len(t, *applied, 1)
+	assert.Equal(t, 2*time.Second, (*applied)[0].WeatherAPI.Timeout)
+}
+
+func TestWatcher_ReportsApplyFailure(t *testing.T) {
+	dir := t.TempDir()
+	writeDotEnv(t, dir, "WEATHER_API_KEY=old\n")
+	applyErr := errors.New("WEATHER_API_KEY: secrets: env: MISSING is not set")
+	w, sr, applied := newFailingWatcher(t, dir, nil, &applyErr)
+
+	writeDotEnv(t, dir, "WEATHER_API_KEY=env:MISSING\n")
+	w.reload(context.TODO())
+
+	assert.Equal(t, applyErr, w.Err())
+	assert.Equal(t, "old", w.current.WeatherAPIKey.Reveal())
+	assert.Equal(t, codes.Error, sr.Ended()[0].Status().Code)
+
+	// The failed setting is applied again on the next reload.
+	applyErr = nil
+	writeDotEnv(t, dir, "WEATHER_API_KEY=env:MISSING\nWEATHER_API_TIMEOUT=2s\n")
+	w.reload(context.TODO())
+
+	assert.Nil(t, w.Err())
+	assert.Len(t, *applied, 2)
+	assert.Equal(t, "env:MISSING", (*applied)[1].WeatherAPIKey.Reveal())
+	assert.Equal(t, "env:MISSING", w.current.WeatherAPIKey.Reveal())
+}
+
+func TestWatcher_EnvAndFlagsKeepPrecedence(t *testing.T) {
+	dir := t.TempDir()
+	writeDotEnv(t, dir, "WEATHER_API_KEY=old\n")
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	w, _, applied := newWatcher(t, dir, fs)
+	assert.Nil(t, fs.Parse([]string{"-log-level", "error"}))
+	w.current.Log.Level = slog.LevelError
+	t.Setenv("OTEL_TRACES_SAMPLER_ARG", "0.5")
+
+	writeDotEnv(t, dir, "WEATHER_API_KEY=new\nLOG_LEVEL=debug\nOTEL_TRACES_SAMPLER_ARG=0.1\n")
+	w.reload(context.TODO())
+
+	assert.Len(t, *applied, 1)
+	assert.Equal(t, "new", (*applied)[0].WeatherAPIKey.Reveal())
+	assert.Equal(t, slog.LevelError, (*applied)[0].Log.Level)
+	assert.Equal(t, 0.5, (*applied)[0].Telemetry.Sampling.Ratio)
+}
+
+func TestWatch(t *testing.T) {
+	dir := t.TempDir()
+	writeDotEnv(t, dir, "WEATHER_API_KEY=old\n")
+	unsetenv(t, "WEATHER_API_KEY")
+	cfg, err := LoadConfig(dir)
+	assert.Nil(t, err)
+	keys := make(chan string, 10)
+
+	w := Watch(cfg, nil, sdktrace.NewTracerProvider().Tracer("test"), func(_ context.Context, cfg *Config) error {
+		keys <- cfg.WeatherAPIKey.Reveal()
+		return nil
+	})
+	writeDotEnv(t, dir, "WEATHER_API_KEY=new\n")
+
+	select {
+	case key := <-keys:
+		assert.Equal(t, "new", key)
+		assert.Nil(t, w.Err())
+	case <-time.After(5 * time.Second):
+		t.Fatal("config not reloaded")
+	}
+}
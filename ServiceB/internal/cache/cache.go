@@ -0,0 +1,94 @@
+package cache
+
+import (
+	"sync"
+	"time"
+)
+
+const defaultMaxEntries = 10000
+
+type entry[V any] struct {
+	value   V
+	expires time.Time
+}
+
+// Cache is an in-memory key/value store whose entries expire after a TTL.
+type Cache[V any] struct {
+	mu         sync.Mutex
+	ttl        time.Duration
+	maxEntries int
+	items      map[string]entry[V]
+	now        func() time.Time
+}
+
+// New returns a cache keeping entries for ttl. A ttl of zero disables it.
+func New[V any](ttl time.Duration) *Cache[V] {
+	return &Cache[V]{
+		ttl:        ttl,
+		maxEntries: defaultMaxEntries,
+		items:      map[string]entry[V]{},
+		now:        time.Now,
+	}
+}
+
+func (c *Cache[V]) Get(key string) (V, bool) {
+	var zero V
+	if c == nil {
+		return zero, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.items[key]
+	if !ok {
+		return zero, false
+	}
+	if !c.now().Before(e.expires) {
+		delete(c.items, key)
+		return zero, false
+	}
+	return e.value, true
+}
+
+func (c *Cache[V]) Set(key string, value V) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.ttl <= 0 {
+		return
+	}
+	if len(c.items) >= c.maxEntries {
+		c.purge()
+	}
+	c.items[key] = entry[V]{value: value, expires: c.now().Add(c.ttl)}
+}
+
+// SetTTL changes the TTL used for new entries.
+func (c *Cache[V]) SetTTL(ttl time.Duration) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.ttl = ttl
+}
+
+// purge drops expired entries and, if the cache is still full, the entry
+// closest to expiring.
+func (c *Cache[V]) purge() {
+	now := c.now()
+	var oldest string
+	for k, e := range c.items {
+		if !now.Before(e.expires) {
+			delete(c.items, k)
+			continue
+		}
+		if oldest == "" || e.expires.Before(c.items[oldest].expires) {
+			oldest = k
+		}
+	}
+	if len(c.items) >= c.maxEntries {
+		delete(c.items, oldest)
+	}
+}
@@ -0,0 +1,55 @@
+package cache
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestCache(t *testing.T) {
+	now := time.Now()
+	c := New[string](time.Minute)
+	c.now = func() time.Time { return now }
+
+	_, ok := c.Get("06835100")
+	assert.False(t, ok)
+
+	c.Set("06835100", "Embu das Artes")
+	v, ok := c.Get("06835100")
+	assert.True(t, ok)
+	assert.Equal(t, "Embu das Artes", v)
+
+	now = now.Add(time.Minute)
+	_, ok = c.Get("06835100")
+	assert.False(t, ok)
+}
+
+func TestCache_Disabled(t *testing.T) {
+	c := New[string](0)
+
+	c.Set("06835100", "Embu das Artes")
+	_, ok := c.Get("06835100")
+
+	assert.False(t, ok)
+
+	var nilCache *Cache[string]
+	nilCache.Set("06835100", "Embu das Artes")
+	_, ok = nilCache.Get("06835100")
+	assert.False(t, ok)
+}
+
+func TestCache_MaxEntries(t *testing.T) {
+	now := time.Now()
+	c := New[int](time.Minute)
+	c.now = func() time.Time { return now }
+	c.maxEntries = 2
+
+	c.Set("a", 1)
+	now = now.Add(time.Second)
+	c.Set("b", 2)
+	c.Set("c", 3)
+
+	_, ok := c.Get("a")
+	assert.False(t, ok)
+	assert.Len(t, c.items, 2)
+}
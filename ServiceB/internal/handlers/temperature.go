@@ -1,80 +1,160 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
-	"fmt"
-	"go.opentelemetry.io/otel"
-	"go.opentelemetry.io/otel/propagation"
+	"errors"
+	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/trace"
-	"log"
 	"net/http"
 	"regexp"
 	"willianszwy/FC-Cloud-Run/internal/temperature"
 	"willianszwy/FC-Cloud-Run/internal/viacep"
 	"willianszwy/FC-Cloud-Run/internal/weather"
+	"willianszwy/FC-Tracing/pkg/breaker"
+	"willianszwy/FC-Tracing/pkg/deadline"
+	"willianszwy/FC-Tracing/pkg/logging"
+	"willianszwy/FC-Tracing/pkg/server"
+	"willianszwy/FC-Tracing/pkg/tracing"
 )
 
 type TemperatureHandler struct {
 	viaCepClient  *viacep.ViaCep
 	weatherClient *weather.Weather
-	tr            trace.Tracer
+	maxBodyBytes  int64
+	viaCepShare   float64
 }
 
+// Option customizes a TemperatureHandler.
+type Option func(*TemperatureHandler)
+
+// WithMaxBodyBytes rejects request bodies larger than n bytes instead of
+// server.DefaultMaxBodyBytes.
+func WithMaxBodyBytes(n int64) Option {
+	return func(t *TemperatureHandler) {
+		t.maxBodyBytes = n
+	}
+}
+
+// WithViaCEPShare lets the ViaCEP lookup use share, from 0 to 1, of the
+// time left on the request, keeping the rest for WeatherAPI. By default it
+// may use all of it.
+func WithViaCEPShare(share float64) Option {
+	return func(t *TemperatureHandler) {
+		t.viaCepShare = share
+	}
+}
+
+var (
+	errInvalidZipcode = errors.New("invalid zipCode")
+	zipcodeRegex      = regexp.MustCompile("^[0-9]{8}$")
+)
+
+var logger = logging.Package("handlers")
+
 type RequestBody struct {
 	Zipcode string `json:"zipcode"`
 }
 
-func New(viacepClient *viacep.ViaCep, weatherClient *weather.Weather, tr trace.Tracer) *TemperatureHandler {
-	return &TemperatureHandler{
+func New(viacepClient *viacep.ViaCep, weatherClient *weather.Weather, opts ...Option) *TemperatureHandler {
+	t := &TemperatureHandler{
 		viaCepClient:  viacepClient,
 		weatherClient: weatherClient,
-		tr:            tr,
+		maxBodyBytes:  server.DefaultMaxBodyBytes,
 	}
+	for _, opt := range opts {
+		opt(t)
+	}
+	return t
 }
 
 func (t *TemperatureHandler) Handler(writer http.ResponseWriter, request *http.Request) {
-	log.Println(request.Header)
-	carrier := propagation.HeaderCarrier(request.Header)
 	ctx := request.Context()
-	ctx = otel.GetTextMapPropagator().Extract(ctx, carrier)
-	ctx, span := t.tr.Start(ctx, "Service B")
-	defer span.End()
-	log.Println("starting request")
+	span := trace.SpanFromContext(ctx)
+	logger.InfoContext(ctx, "starting request")
 
 	var req RequestBody
-	err := json.NewDecoder(request.Body).Decode(&req)
+	err := server.DecodeJSON(writer, request, t.maxBodyBytes, &req)
 	if err != nil {
-		http.Error(writer, err.Error(), http.StatusBadRequest)
+		tracing.RecordError(span, tracing.Classify(tracing.ErrorValidation, err))
+		http.Error(writer, err.Error(), server.StatusOf(err))
 		return
 	}
-	log.Println(fmt.Sprintf("[zipcode:%s]", req.Zipcode))
+	logger.DebugContext(ctx, "request decoded", "zipcode", req.Zipcode)
+	span.SetAttributes(tracing.PII(tracing.ZipcodeKey, req.Zipcode)...)
 
-	regex := regexp.MustCompile("^[0-9]{8}$")
-	if !regex.MatchString(req.Zipcode) {
-		writer.WriteHeader(http.StatusUnprocessableEntity)
+	if !zipcodeRegex.MatchString(req.Zipcode) {
+		tracing.RecordError(span, tracing.Classify(tracing.ErrorValidation, errInvalidZipcode))
 		http.Error(writer, "invalid zipCode", http.StatusUnprocessableEntity)
 		return
 	}
+	span.AddEvent(tracing.EventValidationPassed)
 
-	city, err := t.viaCepClient.FindByZipCode(ctx, req.Zipcode)
+	hop := deadline.StartHop(ctx, "viacep", t.viaCepShare)
+	city, err := t.viaCepClient.FindByZipCode(hop.Context(), req.Zipcode)
+	hop.End()
+	if errors.Is(err, breaker.ErrOpen) {
+		unavailable(ctx, writer, err)
+		return
+	}
+	if hop.Exhausted(err) {
+		timedOut(ctx, writer, "viacep", err)
+		return
+	}
 	if err != nil {
-		log.Println("error", err.Error())
-		writer.WriteHeader(http.StatusNotFound)
+		logger.WarnContext(ctx, "can not find zipcode", "error", err)
+		tracing.RecordError(span, err)
 		http.Error(writer, "can not find zipcode", http.StatusNotFound)
 		return
 	}
+	span.AddEvent(tracing.EventCityResolved, trace.WithAttributes(
+		tracing.CityNameKey.String(city.Name),
+		tracing.CityStateKey.String(city.State),
+	))
 
-	tempByCity, err := t.weatherClient.FindTempByCity(ctx, city.Name)
+	hop = deadline.StartHop(ctx, "weatherapi", 0)
+	tempByCity, err := t.weatherClient.FindTempByCity(hop.Context(), city.Name)
+	hop.End()
+	if errors.Is(err, breaker.ErrOpen) {
+		unavailable(ctx, writer, err)
+		return
+	}
+	if hop.Exhausted(err) {
+		timedOut(ctx, writer, "weatherapi", err)
+		return
+	}
 	if err != nil {
-		log.Println("error", err.Error())
-		writer.WriteHeader(http.StatusInternalServerError)
-		http.Error(writer, err.Error(), http.StatusInternalServerError)
+		logger.ErrorContext(ctx, "can not fetch weather", "city", city.Name, "error", err)
+		tracing.RecordError(span, err)
+		http.Error(writer, "can not fetch weather", http.StatusInternalServerError)
 		return
 	}
 
 	resp := temperature.New(city.Name, tempByCity.Current.TempC, tempByCity.Current.TempF)
+	temperatureAttrs := []attribute.KeyValue{
+		tracing.TemperatureCelsiusKey.Float64(resp.Celsius),
+		tracing.TemperatureFahrenheitKey.Float64(resp.Fahrenheit),
+		tracing.TemperatureKelvinKey.Float64(resp.Kelvin),
+	}
+	span.AddEvent(tracing.EventWeatherFetched, trace.WithAttributes(temperatureAttrs...))
+	span.SetAttributes(append(temperatureAttrs, tracing.CityNameKey.String(city.Name), tracing.CityStateKey.String(city.State))...)
 	writer.WriteHeader(http.StatusOK)
 	if err := json.NewEncoder(writer).Encode(resp); err != nil {
+		tracing.RecordError(span, err)
 		http.Error(writer, err.Error(), http.StatusInternalServerError)
 	}
 }
+
+// unavailable answers 503 for a dependency whose circuit breaker is open.
+func unavailable(ctx context.Context, writer http.ResponseWriter, err error) {
+	logger.WarnContext(ctx, "failing fast, dependency unavailable", "error", err)
+	tracing.RecordError(trace.SpanFromContext(ctx), err)
+	http.Error(writer, "service unavailable", http.StatusServiceUnavailable)
+}
+
+// timedOut answers 504 for a dependency that ran out of time.
+func timedOut(ctx context.Context, writer http.ResponseWriter, hop string, err error) {
+	logger.WarnContext(ctx, "deadline exceeded", "hop", hop, "error", err)
+	tracing.RecordError(trace.SpanFromContext(ctx), err)
+	http.Error(writer, "deadline exceeded calling "+hop, http.StatusGatewayTimeout)
+}
@@ -2,14 +2,26 @@ package handlers
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace/noop"
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
+	"willianszwy/FC-Cloud-Run/internal/interfaces"
 	"willianszwy/FC-Cloud-Run/internal/viacep"
 	"willianszwy/FC-Cloud-Run/internal/weather"
+	"willianszwy/FC-Tracing/pkg/breaker"
+	"willianszwy/FC-Tracing/pkg/deadline"
+	"willianszwy/FC-Tracing/pkg/tracing"
 )
 
 type ClientMock struct {
@@ -42,11 +54,11 @@ func TestTemperatureHandler_Handler(t *testing.T) {
 		Res: &http.Response{Body: body2, StatusCode: 200},
 	}
 
-	viaCepClient := viacep.New(&client)
-	weatherClient := weather.New(&client2, "")
+	viaCepClient := viacep.New(&client, noop.NewTracerProvider().Tracer(""))
+	weatherClient := weather.New(&client2, "", noop.NewTracerProvider().Tracer(""))
 	temperatureHandler := New(viaCepClient, weatherClient)
 
-	req := httptest.NewRequest("GET", "http://example.com/foo?zipcode=00000000", nil)
+	req := httptest.NewRequest("POST", "http://example.com/temperature", strings.NewReader(`{"zipcode": "00000000"}`))
 	w := httptest.NewRecorder()
 	temperatureHandler.Handler(w, req)
 
@@ -78,11 +90,11 @@ func TestTemperatureHandler_Handler_InvalidZipcode(t *testing.T) {
 		Res: &http.Response{Body: body2, StatusCode: 200},
 	}
 
-	viaCepClient := viacep.New(&client)
-	weatherClient := weather.New(&client2, "")
+	viaCepClient := viacep.New(&client, noop.NewTracerProvider().Tracer(""))
+	weatherClient := weather.New(&client2, "", noop.NewTracerProvider().Tracer(""))
 	temperatureHandler := New(viaCepClient, weatherClient)
 
-	req := httptest.NewRequest("GET", "http://example.com/foo?zipcode=invalidcep", nil)
+	req := httptest.NewRequest("POST", "http://example.com/temperature", strings.NewReader(`{"zipcode": "invalidcep"}`))
 	w := httptest.NewRecorder()
 	temperatureHandler.Handler(w, req)
 
@@ -90,6 +102,8 @@ func TestTemperatureHandler_Handler_InvalidZipcode(t *testing.T) {
 
 	assert.NotNil(t, resp)
 	assert.Equal(t, http.StatusUnprocessableEntity, resp.StatusCode)
+	assert.Equal(t, "text/plain; charset=utf-8", resp.Header.Get("Content-Type"))
+	assert.Equal(t, "nosniff", resp.Header.Get("X-Content-Type-Options"))
 
 }
 
@@ -111,11 +125,11 @@ func TestTemperatureHandler_Handler_ZipcodeNotFound(t *testing.T) {
 		Res: &http.Response{Body: body2, StatusCode: 200},
 	}
 
-	viaCepClient := viacep.New(&client)
-	weatherClient := weather.New(&client2, "")
+	viaCepClient := viacep.New(&client, noop.NewTracerProvider().Tracer(""))
+	weatherClient := weather.New(&client2, "", noop.NewTracerProvider().Tracer(""))
 	temperatureHandler := New(viaCepClient, weatherClient)
 
-	req := httptest.NewRequest("GET", "http://example.com/foo?zipcode=00000000", nil)
+	req := httptest.NewRequest("POST", "http://example.com/temperature", strings.NewReader(`{"zipcode": "00000000"}`))
 	w := httptest.NewRecorder()
 	temperatureHandler.Handler(w, req)
 
@@ -123,6 +137,8 @@ func TestTemperatureHandler_Handler_ZipcodeNotFound(t *testing.T) {
 
 	assert.NotNil(t, resp)
 	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	assert.Equal(t, "text/plain; charset=utf-8", resp.Header.Get("Content-Type"))
+	assert.Equal(t, "nosniff", resp.Header.Get("X-Content-Type-Options"))
 
 }
 
@@ -141,11 +157,11 @@ func TestTemperatureHandler_Handler_WeatherError(t *testing.T) {
 		Err: errors.New("error weather"),
 	}
 
-	viaCepClient := viacep.New(&client)
-	weatherClient := weather.New(&client2, "")
+	viaCepClient := viacep.New(&client, noop.NewTracerProvider().Tracer(""))
+	weatherClient := weather.New(&client2, "", noop.NewTracerProvider().Tracer(""))
 	temperatureHandler := New(viaCepClient, weatherClient)
 
-	req := httptest.NewRequest("GET", "http://example.com/foo?zipcode=00000000", nil)
+	req := httptest.NewRequest("POST", "http://example.com/temperature", strings.NewReader(`{"zipcode": "00000000"}`))
 	w := httptest.NewRecorder()
 	temperatureHandler.Handler(w, req)
 
@@ -153,5 +169,191 @@ func TestTemperatureHandler_Handler_WeatherError(t *testing.T) {
 
 	assert.NotNil(t, resp)
 	assert.Equal(t, http.StatusInternalServerError, resp.StatusCode)
+	resBody, _ := io.ReadAll(resp.Body)
+	assert.Equal(t, "can not fetch weather\n", string(resBody))
 
 }
+
+func TestTemperatureHandler_Handler_RecordsSpanErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		body   string
+		viacep ClientMock
+		status int
+		class  string
+	}{
+		{"invalid body", `{`, ClientMock{}, http.StatusBadRequest, tracing.ErrorValidation},
+		{"invalid zipcode", `{"zipcode": "123"}`, ClientMock{}, http.StatusUnprocessableEntity, tracing.ErrorValidation},
+		{"zipcode not found", `{"zipcode": "00000000"}`, ClientMock{Res: &http.Response{Body: io.NopCloser(strings.NewReader(`{"erro": true}`)), StatusCode: 200}}, http.StatusNotFound, tracing.ErrorNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sr := tracetest.NewSpanRecorder()
+			tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr))
+			viaCepClient := viacep.New(&tt.viacep, tp.Tracer("test"))
+			weatherClient := weather.New(&ClientMock{}, "", tp.Tracer("test"))
+			temperatureHandler := New(viaCepClient, weatherClient)
+
+			ctx, span := tp.Tracer("test").Start(context.TODO(), "POST /temperature")
+			req := httptest.NewRequest("POST", "http://example.com/temperature", strings.NewReader(tt.body)).WithContext(ctx)
+			w := httptest.NewRecorder()
+			temperatureHandler.Handler(w, req)
+			span.End()
+
+			assert.Equal(t, tt.status, w.Result().StatusCode)
+			server := sr.Ended()[len(sr.Ended())-1]
+			assert.Equal(t, "POST /temperature", server.Name())
+			assert.Equal(t, codes.Error, server.Status().Code)
+			assert.Contains(t, server.Attributes(), attribute.String("error.class", tt.class))
+		})
+	}
+}
+
+func TestTemperatureHandler_Handler_RejectsBody(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		status      int
+	}{
+		{"too large", "application/json", `{"zipcode": "` + strings.Repeat("0", 64) + `"}`, http.StatusRequestEntityTooLarge},
+		{"content type", "text/plain", `{"zipcode": "00000000"}`, http.StatusUnsupportedMediaType},
+		{"unknown field", "application/json", `{"zipcode": "00000000", "city": "x"}`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sr := tracetest.NewSpanRecorder()
+			tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr))
+			viaCepClient := viacep.New(&ClientMock{Err: errors.New("should not be called")}, tp.Tracer("test"))
+			weatherClient := weather.New(&ClientMock{}, "", tp.Tracer("test"))
+			temperatureHandler := New(viaCepClient, weatherClient, WithMaxBodyBytes(48))
+
+			ctx, span := tp.Tracer("test").Start(context.TODO(), "POST /temperature")
+			req := httptest.NewRequest("POST", "http://example.com/temperature", strings.NewReader(tt.body)).WithContext(ctx)
+			req.Header.Set("Content-Type", tt.contentType)
+			w := httptest.NewRecorder()
+			temperatureHandler.Handler(w, req)
+			span.End()
+
+			assert.Equal(t, tt.status, w.Result().StatusCode)
+			spans := sr.Ended()
+			assert.Len(t, spans, 1)
+			assert.Equal(t, codes.Error, spans[0].Status().Code)
+			assert.Contains(t, spans[0].Attributes(), attribute.String("error.class", tracing.ErrorValidation))
+		})
+	}
+}
+
+func TestTemperatureHandler_Handler_RecordsDomainEvents(t *testing.T) {
+	tracing.SetPIIMode(tracing.PIIMask)
+	sr := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr))
+	viaCepClient := viacep.New(&ClientMock{Res: &http.Response{Body: io.NopCloser(strings.NewReader(`{"localidade": "São Paulo", "uf": "SP"}`)), StatusCode: 200}}, tp.Tracer("test"))
+	weatherClient := weather.New(&ClientMock{Res: &http.Response{Body: io.NopCloser(strings.NewReader(`{"current": {"temp_c": 20, "temp_f": 68}}`)), StatusCode: 200}}, "", tp.Tracer("test"))
+	temperatureHandler := New(viaCepClient, weatherClient)
+
+	ctx, span := tp.Tracer("test").Start(context.TODO(), "POST /temperature")
+	req := httptest.NewRequest("POST", "http://example.com/temperature", strings.NewReader(`{"zipcode": "01001000"}`)).WithContext(ctx)
+	w := httptest.NewRecorder()
+	temperatureHandler.Handler(w, req)
+	span.End()
+
+	assert.Equal(t, http.StatusOK, w.Result().StatusCode)
+	server := sr.Ended()[len(sr.Ended())-1]
+	assert.Contains(t, server.Attributes(), attribute.String("zipcode", "0100****"))
+	assert.Contains(t, server.Attributes(), attribute.String("city.state", "SP"))
+	assert.Contains(t, server.Attributes(), attribute.Float64("temperature.kelvin", 293))
+	var events []string
+	for _, e := range server.Events() {
+		events = append(events, e.Name)
+	}
+	assert.Equal(t, []string{tracing.EventValidationPassed, tracing.EventCityResolved, tracing.EventWeatherFetched}, events)
+}
+
+func TestTemperatureHandler_Handler_BreakerOpen(t *testing.T) {
+	settings := breaker.DefaultSettings()
+	settings.MinCalls = 1
+	b := breaker.New("viacep", settings)
+	client := ClientMock{Err: errors.New("connection refused")}
+	viaCepClient := viacep.New(&client, noop.NewTracerProvider().Tracer(""), viacep.WithBreaker(b))
+	weatherClient := weather.New(&ClientMock{}, "", noop.NewTracerProvider().Tracer(""))
+	temperatureHandler := New(viaCepClient, weatherClient)
+
+	statuses := []int{}
+	for i := 0; i < 2; i++ {
+		req := httptest.NewRequest("POST", "http://example.com/temperature", strings.NewReader(`{"zipcode": "00000000"}`))
+		w := httptest.NewRecorder()
+		temperatureHandler.Handler(w, req)
+		statuses = append(statuses, w.Code)
+	}
+
+	assert.Equal(t, []int{http.StatusNotFound, http.StatusServiceUnavailable}, statuses)
+	assert.Equal(t, breaker.Open, b.State())
+}
+
+type slowClient struct{}
+
+func (slowClient) Do(req *http.Request) (*http.Response, error) {
+	<-req.Context().Done()
+	return nil, req.Context().Err()
+}
+
+func TestTemperatureHandler_Handler_SlowViaCEPOpensBreaker(t *testing.T) {
+	settings := breaker.DefaultSettings()
+	settings.MinCalls = 2
+	b := breaker.New("viacep", settings)
+	viaCepClient := viacep.New(slowClient{}, noop.NewTracerProvider().Tracer(""), viacep.WithBreaker(b))
+	weatherClient := weather.New(&ClientMock{}, "", noop.NewTracerProvider().Tracer(""))
+	temperatureHandler := New(viaCepClient, weatherClient, WithViaCEPShare(0.5))
+
+	statuses := []int{}
+	for i := 0; i < 3; i++ {
+		ctx, cancel := context.WithTimeout(context.TODO(), 50*time.Millisecond)
+		req := httptest.NewRequest("POST", "http://example.com/temperature", strings.NewReader(`{"zipcode": "00000000"}`)).WithContext(ctx)
+		w := httptest.NewRecorder()
+		temperatureHandler.Handler(w, req)
+		cancel()
+		statuses = append(statuses, w.Code)
+	}
+
+	assert.Equal(t, []int{http.StatusGatewayTimeout, http.StatusGatewayTimeout, http.StatusServiceUnavailable}, statuses)
+	assert.Equal(t, breaker.Open, b.State())
+}
+
+func TestTemperatureHandler_Handler_DeadlineExceeded(t *testing.T) {
+	tests := []struct {
+		name    string
+		viacep  interfaces.HTTPClient
+		weather interfaces.HTTPClient
+		hop     string
+		by      string
+	}{
+		{"viacep share", slowClient{}, &ClientMock{}, "viacep", deadline.ExhaustedShare},
+		{"weatherapi budget", &ClientMock{Res: &http.Response{Body: io.NopCloser(strings.NewReader(`{"localidade": "São Paulo"}`)), StatusCode: 200}}, slowClient{}, "weatherapi", deadline.ExhaustedBudget},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sr := tracetest.NewSpanRecorder()
+			tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr))
+			viaCepClient := viacep.New(tt.viacep, tp.Tracer("test"))
+			weatherClient := weather.New(tt.weather, "", tp.Tracer("test"))
+			temperatureHandler := New(viaCepClient, weatherClient, WithViaCEPShare(0.5))
+
+			ctx, span := tp.Tracer("test").Start(context.TODO(), "POST /temperature")
+			ctx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+			defer cancel()
+			req := httptest.NewRequest("POST", "http://example.com/temperature", strings.NewReader(`{"zipcode": "00000000"}`)).WithContext(ctx)
+			w := httptest.NewRecorder()
+			temperatureHandler.Handler(w, req)
+			span.End()
+
+			assert.Equal(t, http.StatusGatewayTimeout, w.Code)
+			assert.Equal(t, "deadline exceeded calling "+tt.hop+"\n", w.Body.String())
+			server := sr.Ended()[len(sr.Ended())-1]
+			assert.Equal(t, "POST /temperature", server.Name())
+			assert.Contains(t, server.Attributes(), deadline.ExhaustedHopKey.String(tt.hop))
+			assert.Contains(t, server.Attributes(), deadline.ExhaustedByKey.String(tt.by))
+			assert.Contains(t, server.Attributes(), attribute.String("error.class", tracing.ErrorUpstreamTimeout))
+		})
+	}
+}
@@ -0,0 +1,229 @@
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"time"
+	"willianszwy/FC-Tracing/pkg/logging"
+)
+
+const redacted = "REDACTED"
+
+var logger = logging.Package("secrets")
+
+// Secret is a sensitive string. It prints, logs and marshals as REDACTED,
+// Reveal returns the value.
+type Secret string
+
+// Reveal returns the secret value.
+func (s Secret) Reveal() string {
+	return string(s)
+}
+
+func (s Secret) String() string {
+	return redacted
+}
+
+func (s Secret) GoString() string {
+	return redacted
+}
+
+func (s Secret) LogValue() slog.Value {
+	return slog.StringValue(redacted)
+}
+
+func (s Secret) MarshalJSON() ([]byte, error) {
+	return json.Marshal(redacted)
+}
+
+// Provider resolves the part of a secret reference after its scheme.
+type Provider interface {
+	Resolve(ctx context.Context, name string) (Secret, error)
+}
+
+// ProviderFunc adapts a function to Provider.
+type ProviderFunc func(ctx context.Context, name string) (Secret, error)
+
+func (f ProviderFunc) Resolve(ctx context.Context, name string) (Secret, error) {
+	return f(ctx, name)
+}
+
+// Resolver turns secret references into secrets using the provider
+// registered for their scheme:
+//
+//	file:///run/secrets/weather_key  the trimmed content of the file
+//	env:WEATHER_KEY                  the value of an environment variable
+//
+// A value without a known scheme is the secret itself.
+type Resolver struct {
+	mu        sync.RWMutex
+	providers map[string]Provider
+}
+
+// NewResolver returns a resolver knowing the file and env schemes.
+func NewResolver() *Resolver {
+	r := &Resolver{providers: map[string]Provider{}}
+	r.Register("file", ProviderFunc(fromFile))
+	r.Register("env", ProviderFunc(fromEnv))
+	return r
+}
+
+// Register resolves the references with scheme through p.
+func (r *Resolver) Register(scheme string, p Provider) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.providers[scheme] = p
+}
+
+// Resolve returns the secret ref refers to. Errors never carry the value.
+func (r *Resolver) Resolve(ctx context.Context, ref Secret) (Secret, error) {
+	scheme, name, ok := strings.Cut(ref.Reveal(), ":")
+	if !ok {
+		return ref, nil
+	}
+	r.mu.RLock()
+	p, known := r.providers[scheme]
+	r.mu.RUnlock()
+	switch {
+	case known:
+		secret, err := p.Resolve(ctx, strings.TrimPrefix(name, "//"))
+		if err != nil {
+			return "", fmt.Errorf("secrets: %s: %w", scheme, err)
+		}
+		if secret == "" {
+			return "", fmt.Errorf("secrets: %s: empty secret", scheme)
+		}
+		return secret, nil
+	case strings.HasPrefix(name, "//"):
+		return "", fmt.Errorf("secrets: unknown provider %q", scheme)
+	}
+	return ref, nil
+}
+
+// Validate checks the syntax of ref without resolving it.
+func (r *Resolver) Validate(ref Secret) error {
+	if ref == "" {
+		return errors.New("secrets: empty reference")
+	}
+	scheme, name, ok := strings.Cut(ref.Reveal(), ":")
+	if !ok {
+		return nil
+	}
+	r.mu.RLock()
+	_, known := r.providers[scheme]
+	r.mu.RUnlock()
+	switch {
+	case known && strings.TrimPrefix(name, "//") == "":
+		return fmt.Errorf("secrets: %s reference without a name", scheme)
+	case !known && strings.HasPrefix(name, "//"):
+		return fmt.Errorf("secrets: unknown provider %q, expected file:// or env:", scheme)
+	}
+	return nil
+}
+
+func fromFile(_ context.Context, path string) (Secret, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return Secret(strings.TrimSpace(string(b))), nil
+}
+
+func fromEnv(_ context.Context, name string) (Secret, error) {
+	value, ok := os.LookupEnv(name)
+	if !ok {
+		return "", fmt.Errorf("%s is not set", name)
+	}
+	return Secret(value), nil
+}
+
+// Refresher keeps a secret up to date with its reference, handing each new
+// value to apply.
+type Refresher struct {
+	resolver *Resolver
+	apply    func(Secret)
+
+	mu      sync.Mutex
+	ref     Secret
+	current Secret
+	err     error
+}
+
+// NewRefresher resolves ref and hands the secret to apply.
+func NewRefresher(ctx context.Context, r *Resolver, ref Secret, apply func(Secret)) (*Refresher, error) {
+	f := &Refresher{resolver: r, apply: apply}
+	if err := f.SetRef(ctx, ref); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// SetRef resolves ref and, when it succeeds, refreshes from it from now on.
+// A failure keeps the current reference and is only returned, Err still
+// reports on the current one.
+func (f *Refresher) SetRef(ctx context.Context, ref Secret) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	secret, err := f.resolver.Resolve(ctx, ref)
+	if err != nil {
+		return err
+	}
+	f.ref, f.err = ref, nil
+	f.update(secret)
+	return nil
+}
+
+// Refresh resolves the reference again, keeping the current secret when
+// that fails.
+func (f *Refresher) Refresh(ctx context.Context) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	secret, err := f.resolver.Resolve(ctx, f.ref)
+	f.err = err
+	if err != nil {
+		return err
+	}
+	f.update(secret)
+	return nil
+}
+
+// Err returns the error of the last resolution of the current reference, nil
+// when it succeeded.
+func (f *Refresher) Err() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.err
+}
+
+func (f *Refresher) update(secret Secret) {
+	if secret != f.current {
+		f.current = secret
+		f.apply(secret)
+	}
+}
+
+// Run refreshes the secret every interval until ctx is done. A zero
+// interval disables refreshing.
+func (f *Refresher) Run(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := f.Refresh(ctx); err != nil {
+				logger.WarnContext(ctx, "secret refresh failed, keeping the current value", "error", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package secrets
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSecret_NeverPrinted(t *testing.T) {
+	s := Secret("hunter2")
+	var buf bytes.Buffer
+	slog.New(slog.NewJSONHandler(&buf, nil)).Info("key", "key", s)
+	b, err := json.Marshal(map[string]Secret{"key": s})
+
+	assert.Nil(t, err)
+	assert.Equal(t, "hunter2", s.Reveal())
+	for _, out := range []string{fmt.Sprint(s), fmt.Sprintf("%q %v %#v", s, s, s), buf.String(), string(b)} {
+		assert.NotContains(t, out, "hunter2")
+		assert.Contains(t, out, "REDACTED")
+	}
+}
+
+func TestResolver_Resolve(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "weather_key")
+	assert.Nil(t, os.WriteFile(path, []byte("from-file\n"), 0o600))
+	t.Setenv("TEST_WEATHER_KEY", "from-env")
+	r := NewResolver()
+
+	for ref, want := range map[Secret]string{
+		"file://" + Secret(path): "from-file",
+		"env:TEST_WEATHER_KEY":   "from-env",
+		"plain-key":              "plain-key",
+		"a:b":                    "a:b",
+	} {
+		secret, err := r.Resolve(context.TODO(), ref)
+		assert.Nil(t, err)
+		assert.Equal(t, want, secret.Reveal())
+	}
+}
+
+func TestResolver_Errors(t *testing.T) {
+	t.Setenv("TEST_EMPTY_KEY", "")
+	r := NewResolver()
+
+	for ref, want := range map[Secret]string{
+		"file:///does/not/exist": "secrets: file: open /does/not/exist",
+		"env:TEST_MISSING_KEY":   "secrets: env: TEST_MISSING_KEY is not set",
+		"env:TEST_EMPTY_KEY":     "secrets: env: empty secret",
+		"vault://weather":        `secrets: unknown provider "vault"`,
+	} {
+		_, err := r.Resolve(context.TODO(), ref)
+		assert.ErrorContains(t, err, want)
+	}
+	assert.NotNil(t, r.Validate("vault://weather"))
+	assert.NotNil(t, r.Validate("env:"))
+	assert.Nil(t, r.Validate("file:///run/secrets/weather_key"))
+}
+
+func TestResolver_Register(t *testing.T) {
+	r := NewResolver()
+	r.Register("vault", ProviderFunc(func(_ context.Context, name string) (Secret, error) {
+		return Secret("vault-" + name), nil
+	}))
+
+	secret, err := r.Resolve(context.TODO(), "vault://weather")
+
+	assert.Nil(t, err)
+	assert.Equal(t, "vault-weather", secret.Reveal())
+}
+
+func TestRefresher(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "weather_key")
+	assert.Nil(t, os.WriteFile(path, []byte("first"), 0o600))
+	var applied []string
+	f, err := NewRefresher(context.TODO(), NewResolver(), "file://"+Secret(path), func(s Secret) {
+		applied = append(applied, s.Reveal())
+	})
+	assert.Nil(t, err)
+
+	assert.Nil(t, f.Refresh(context.TODO()))
+	assert.NotNil(t, f.SetRef(context.TODO(), "env:TEST_MISSING_KEY"))
+	assert.Nil(t, f.Err())
+	assert.Nil(t, os.WriteFile(path, []byte("second"), 0o600))
+	assert.Nil(t, f.Refresh(context.TODO()))
+	assert.Nil(t, os.Remove(path))
+	assert.NotNil(t, f.Refresh(context.TODO()))
+	assert.NotNil(t, f.Err())
+	assert.NotNil(t, f.SetRef(context.TODO(), "env:TEST_MISSING_KEY"))
+	assert.Nil(t, f.SetRef(context.TODO(), "third"))
+	assert.Nil(t, f.Err())
+
+	assert.Equal(t, []string{"first", "second", "third"}, applied)
+}
@@ -3,47 +3,161 @@ package viacep
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"go.opentelemetry.io/otel/trace"
 	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+	"willianszwy/FC-Cloud-Run/internal/cache"
 	"willianszwy/FC-Cloud-Run/internal/interfaces"
+	"willianszwy/FC-Tracing/pkg/breaker"
+	"willianszwy/FC-Tracing/pkg/logging"
+	"willianszwy/FC-Tracing/pkg/tracing"
 )
 
+var ErrCityNotFound = errors.New("error city notfound")
+
+const provider = "viacep"
+
+// DefaultBaseURL is the ViaCEP web service root.
+const DefaultBaseURL = "https://viacep.com.br/ws"
+
+var logger = logging.Package("viacep")
+
 type City struct {
-	Name string `json:"localidade"`
+	Name  string `json:"localidade"`
+	State string `json:"uf"`
 }
 
 type ViaCep struct {
-	client interfaces.HTTPClient
-	tr     trace.Tracer
+	client  interfaces.HTTPClient
+	tr      trace.Tracer
+	cache   *cache.Cache[City]
+	metrics *tracing.UpstreamMetrics
+	breaker *breaker.Breaker
+	baseURL string
+	timeout atomic.Int64
+}
+
+// Option customizes a ViaCep client.
+type Option func(*ViaCep)
+
+// WithMetrics records the upstream calls on m instead of the instruments of
+// the global meter provider.
+func WithMetrics(m *tracing.UpstreamMetrics) Option {
+	return func(vc *ViaCep) {
+		vc.metrics = m
+	}
 }
 
-func New(client interfaces.HTTPClient, tr trace.Tracer) *ViaCep {
-	return &ViaCep{
-		client: client,
-		tr:     tr,
+// WithCache keeps resolved cities in c, keyed by zipcode.
+func WithCache(c *cache.Cache[City]) Option {
+	return func(vc *ViaCep) {
+		vc.cache = c
 	}
 }
 
-func (vc *ViaCep) FindByZipCode(ctx context.Context, zipCode string) (City, error) {
-	ctx, span := vc.tr.Start(ctx, "Viacep")
-	defer span.End()
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "https://viacep.com.br/ws/"+zipCode+"/json", nil)
+// WithBreaker fails the lookups fast while b is open.
+func WithBreaker(b *breaker.Breaker) Option {
+	return func(vc *ViaCep) {
+		vc.breaker = b
+	}
+}
+
+// WithBaseURL sends the lookups to baseURL instead of DefaultBaseURL.
+func WithBaseURL(baseURL string) Option {
+	return func(vc *ViaCep) {
+		vc.baseURL = strings.TrimRight(baseURL, "/")
+	}
+}
+
+// WithTimeout bounds each lookup sent upstream, zero means no bound.
+func WithTimeout(timeout time.Duration) Option {
+	return func(vc *ViaCep) {
+		vc.SetTimeout(timeout)
+	}
+}
+
+func New(client interfaces.HTTPClient, tr trace.Tracer, opts ...Option) *ViaCep {
+	vc := &ViaCep{
+		client:  client,
+		tr:      tr,
+		metrics: tracing.NewUpstreamMetrics(),
+		baseURL: DefaultBaseURL,
+	}
+	for _, opt := range opts {
+		opt(vc)
+	}
+	return vc
+}
+
+// SetTimeout replaces the bound of the following lookups, zero means no
+// bound.
+func (vc *ViaCep) SetTimeout(timeout time.Duration) {
+	vc.timeout.Store(int64(timeout))
+}
+
+func (vc *ViaCep) FindByZipCode(ctx context.Context, zipCode string) (city City, err error) {
+	ctx, span := vc.tr.Start(ctx, "Viacep", trace.WithAttributes(tracing.PII(tracing.ZipcodeKey, zipCode)...))
+	span.SetAttributes(tracing.UpstreamProviderKey.String(provider))
+	defer func() {
+		if err == nil {
+			span.SetAttributes(tracing.CityNameKey.String(city.Name), tracing.CityStateKey.String(city.State))
+		}
+		if err != nil {
+			logger.WarnContext(ctx, "viacep lookup failed", "error", err, string(tracing.ErrorClassKey), tracing.ErrorClass(err))
+		}
+		tracing.RecordError(span, err)
+		span.End()
+	}()
+	if cached, ok := vc.cache.Get(zipCode); ok {
+		span.SetAttributes(tracing.CacheHitKey.Bool(true))
+		return cached, nil
+	}
+	span.SetAttributes(tracing.CacheHitKey.Bool(false))
+	defer func(start time.Time) {
+		vc.metrics.Record(ctx, provider, start, err)
+	}(time.Now())
+	err = vc.breaker.Execute(ctx, func(ctx context.Context) (err error) {
+		city, err = vc.fetch(ctx, span, zipCode)
+		return err
+	})
 	if err != nil {
-		return City{}, fmt.Errorf("error creating request %w", err)
+		return City{}, err
+	}
+	vc.cache.Set(zipCode, city)
+	return city, nil
+}
+
+// fetch asks ViaCEP for zipCode.
+func (vc *ViaCep) fetch(ctx context.Context, span trace.Span, zipCode string) (city City, err error) {
+	reqCtx := ctx
+	if timeout := time.Duration(vc.timeout.Load()); timeout > 0 {
+		var cancel context.CancelFunc
+		reqCtx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	req, err := http.NewRequestWithContext(reqCtx, http.MethodGet, vc.baseURL+"/"+zipCode+"/json", nil)
+	if err != nil {
+		return City{}, tracing.Classify(tracing.ErrorValidation, fmt.Errorf("error creating request %w", err))
 	}
 	resp, err := vc.client.Do(req)
 	if err != nil {
-		return City{}, fmt.Errorf("error doing request %w", err)
+		return City{}, tracing.ClassifyUpstream(fmt.Errorf("error doing request %w", err))
 	}
 	defer resp.Body.Close()
-	var city City
+	span.SetAttributes(tracing.UpstreamStatusCodeKey.Int(resp.StatusCode))
+	if resp.StatusCode != http.StatusOK {
+		return City{}, tracing.ClassifyStatus(resp.StatusCode, fmt.Errorf("error unexpected status %d", resp.StatusCode))
+	}
 	err = json.NewDecoder(resp.Body).Decode(&city)
 	if err != nil {
-		return City{}, fmt.Errorf("error deconding request %w", err)
+		return City{}, tracing.Classify(tracing.ErrorUpstreamBadResponse, fmt.Errorf("error deconding request %w", err))
 	}
 	if city.Name == "" {
-		return City{}, fmt.Errorf("error city notfound")
+		return City{}, tracing.Classify(tracing.ErrorNotFound, ErrCityNotFound)
 	}
 	return city, nil
 }
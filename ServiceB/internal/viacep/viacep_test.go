@@ -5,17 +5,30 @@ import (
 	"context"
 	"errors"
 	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace/noop"
 	"io"
+	"log/slog"
 	"net/http"
+	"strings"
 	"testing"
+	"time"
+	"willianszwy/FC-Cloud-Run/internal/cache"
+	"willianszwy/FC-Tracing/pkg/logging"
+	"willianszwy/FC-Tracing/pkg/tracing"
 )
 
 type ClientMock struct {
 	Res *http.Response
 	Err error
+	Req *http.Request
 }
 
 func (c *ClientMock) Do(req *http.Request) (*http.Response, error) {
+	c.Req = req
 	return c.Res, c.Err
 }
 
@@ -36,7 +49,7 @@ func TestFindByZipCode(t *testing.T) {
 	client := ClientMock{
 		Res: &http.Response{Body: body, StatusCode: 200},
 	}
-	viaCep := New(&client)
+	viaCep := New(&client, noop.NewTracerProvider().Tracer(""))
 	assert.NotNil(t, viaCep)
 
 	city, err := viaCep.FindByZipCode(context.TODO(), "00000-000")
@@ -65,7 +78,7 @@ func TestFindByZipCode_NewRequestError(t *testing.T) {
 	client := ClientMock{
 		Res: &http.Response{Body: body, StatusCode: 200},
 	}
-	viaCep := New(&client)
+	viaCep := New(&client, noop.NewTracerProvider().Tracer(""))
 	assert.NotNil(t, viaCep)
 
 	city, err := viaCep.FindByZipCode(context.TODO(), "$%ˆ&$%")
@@ -81,7 +94,7 @@ func TestFindByZipCode_DoError(t *testing.T) {
 		Res: nil,
 		Err: errors.New("error"),
 	}
-	viaCep := New(&client)
+	viaCep := New(&client, noop.NewTracerProvider().Tracer(""))
 	assert.NotNil(t, viaCep)
 
 	city, err := viaCep.FindByZipCode(context.TODO(), "00000-000")
@@ -101,7 +114,7 @@ func TestFindByZipCode_UnMarshallError(t *testing.T) {
 	client := ClientMock{
 		Res: &http.Response{Body: body, StatusCode: 200},
 	}
-	viaCep := New(&client)
+	viaCep := New(&client, noop.NewTracerProvider().Tracer(""))
 	assert.NotNil(t, viaCep)
 
 	city, err := viaCep.FindByZipCode(context.TODO(), "00000-000")
@@ -121,7 +134,7 @@ func TestFindByZipCode_EmptyCityError(t *testing.T) {
 	client := ClientMock{
 		Res: &http.Response{Body: body, StatusCode: 200},
 	}
-	viaCep := New(&client)
+	viaCep := New(&client, noop.NewTracerProvider().Tracer(""))
 	assert.NotNil(t, viaCep)
 
 	city, err := viaCep.FindByZipCode(context.TODO(), "00000-000")
@@ -131,3 +144,97 @@ func TestFindByZipCode_EmptyCityError(t *testing.T) {
 	assert.NotNil(t, err)
 	assert.Equal(t, expectedError, err.Error())
 }
+
+func TestFindByZipCode_RecordsSpanError(t *testing.T) {
+	tests := []struct {
+		name   string
+		client ClientMock
+		class  string
+	}{
+		{"not found", ClientMock{Res: &http.Response{Body: io.NopCloser(strings.NewReader(`{"erro": true}`)), StatusCode: 200}}, tracing.ErrorNotFound},
+		{"bad response", ClientMock{Res: &http.Response{Body: io.NopCloser(strings.NewReader(`<html>`)), StatusCode: 200}}, tracing.ErrorUpstreamBadResponse},
+		{"bad status", ClientMock{Res: &http.Response{Body: io.NopCloser(strings.NewReader(``)), StatusCode: 503}}, tracing.ErrorUpstreamBadResponse},
+		{"rejected zipcode", ClientMock{Res: &http.Response{Body: io.NopCloser(strings.NewReader(``)), StatusCode: 400}}, tracing.ErrorValidation},
+		{"timeout", ClientMock{Err: context.DeadlineExceeded}, tracing.ErrorUpstreamTimeout},
+		{"unavailable", ClientMock{Err: errors.New("connection refused")}, tracing.ErrorUpstreamUnavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sr := tracetest.NewSpanRecorder()
+			tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr))
+			viaCep := New(&tt.client, tp.Tracer("test"))
+
+			_, err := viaCep.FindByZipCode(context.TODO(), "00000000")
+
+			assert.NotNil(t, err)
+			spans := sr.Ended()
+			assert.Len(t, spans, 1)
+			assert.Equal(t, "Viacep", spans[0].Name())
+			assert.Equal(t, codes.Error, spans[0].Status().Code)
+			assert.Contains(t, spans[0].Attributes(), attribute.String("error.class", tt.class))
+			assert.Equal(t, "exception", spans[0].Events()[len(spans[0].Events())-1].Name)
+		})
+	}
+}
+
+func TestFindByZipCode_SpanOk(t *testing.T) {
+	sr := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr))
+	client := ClientMock{Res: &http.Response{Body: io.NopCloser(strings.NewReader(`{"localidade": "São Paulo"}`)), StatusCode: 200}}
+
+	_, err := New(&client, tp.Tracer("test")).FindByZipCode(context.TODO(), "00000000")
+
+	assert.Nil(t, err)
+	assert.Equal(t, codes.Unset, sr.Ended()[0].Status().Code)
+}
+
+func TestFindByZipCode_Cache(t *testing.T) {
+	sr := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr))
+	client := ClientMock{Res: &http.Response{Body: io.NopCloser(strings.NewReader(`{"localidade": "São Paulo", "uf": "SP"}`)), StatusCode: 200}}
+	viaCep := New(&client, tp.Tracer("test"), WithCache(cache.New[City](time.Minute)))
+
+	_, err := viaCep.FindByZipCode(context.TODO(), "01001000")
+	assert.Nil(t, err)
+	client.Res = nil
+	client.Err = errors.New("should not be called")
+	city, err := viaCep.FindByZipCode(context.TODO(), "01001000")
+
+	assert.Nil(t, err)
+	assert.Equal(t, City{Name: "São Paulo", State: "SP"}, city)
+	spans := sr.Ended()
+	assert.Contains(t, spans[0].Attributes(), attribute.Bool("cache.hit", false))
+	assert.Contains(t, spans[0].Attributes(), attribute.Int("upstream.http.status_code", 200))
+	assert.Contains(t, spans[0].Attributes(), attribute.String("upstream.provider", "viacep"))
+	assert.Contains(t, spans[1].Attributes(), attribute.Bool("cache.hit", true))
+	assert.Contains(t, spans[1].Attributes(), attribute.String("city.name", "São Paulo"))
+}
+
+func TestFindByZipCode_LogsOnSpan(t *testing.T) {
+	_, err := logging.Setup(io.Discard, logging.Config{SpanEvents: true, SpanEventLevel: slog.LevelWarn})
+	assert.Nil(t, err)
+	sr := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr))
+	client := ClientMock{Res: &http.Response{Body: io.NopCloser(strings.NewReader(`{"erro": true}`)), StatusCode: 200}}
+
+	_, err = New(&client, tp.Tracer("test")).FindByZipCode(context.TODO(), "00000000")
+
+	assert.NotNil(t, err)
+	events := sr.Ended()[0].Events()
+	assert.Equal(t, "viacep lookup failed", events[0].Name)
+	assert.Contains(t, events[0].Attributes, attribute.String("error", "error city notfound"))
+	assert.Contains(t, events[0].Attributes, attribute.String("package", "viacep"))
+}
+
+func TestFindByZipCode_BaseURLAndTimeout(t *testing.T) {
+	client := ClientMock{Res: &http.Response{Body: io.NopCloser(strings.NewReader(`{"localidade": "São Paulo"}`)), StatusCode: 200}}
+	viaCep := New(&client, noop.NewTracerProvider().Tracer(""), WithBaseURL("http://viacep.local/ws/"), WithTimeout(time.Second))
+
+	_, err := viaCep.FindByZipCode(context.TODO(), "01001000")
+
+	assert.Nil(t, err)
+	assert.Equal(t, "http://viacep.local/ws/01001000/json", client.Req.URL.String())
+	deadline, ok := client.Req.Context().Deadline()
+	assert.True(t, ok)
+	assert.WithinDuration(t, time.Now().Add(time.Second), deadline, time.Second)
+}
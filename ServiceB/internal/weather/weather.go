@@ -3,14 +3,29 @@ package weather
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"go.opentelemetry.io/otel/trace"
-	"log"
 	"net/http"
 	"net/url"
+	"strings"
+	"sync/atomic"
+	"time"
+	"willianszwy/FC-Cloud-Run/internal/cache"
 	"willianszwy/FC-Cloud-Run/internal/interfaces"
+	"willianszwy/FC-Cloud-Run/internal/secrets"
+	"willianszwy/FC-Tracing/pkg/breaker"
+	"willianszwy/FC-Tracing/pkg/logging"
+	"willianszwy/FC-Tracing/pkg/tracing"
 )
 
+const provider = "weatherapi"
+
+// DefaultBaseURL is the WeatherAPI root.
+const DefaultBaseURL = "https://api.weatherapi.com/v1"
+
+var logger = logging.Package("weather")
+
 type Response struct {
 	Current struct {
 		TempC float64 `json:"temp_c"`
@@ -19,35 +34,148 @@ type Response struct {
 }
 
 type Weather struct {
-	client interfaces.HTTPClient
-	Apikey string
-	tr     trace.Tracer
+	client  interfaces.HTTPClient
+	apiKey  atomic.Pointer[secrets.Secret]
+	tr      trace.Tracer
+	cache   *cache.Cache[Response]
+	metrics *tracing.UpstreamMetrics
+	breaker *breaker.Breaker
+	baseURL string
+	timeout atomic.Int64
+}
+
+// Option customizes a Weather client.
+type Option func(*Weather)
+
+// WithMetrics records the upstream calls on m instead of the instruments of
+// the global meter provider.
+func WithMetrics(m *tracing.UpstreamMetrics) Option {
+	return func(w *Weather) {
+		w.metrics = m
+	}
+}
+
+// WithCache keeps current conditions in c, keyed by city.
+func WithCache(c *cache.Cache[Response]) Option {
+	return func(w *Weather) {
+		w.cache = c
+	}
+}
+
+// WithBreaker fails the requests fast while b is open.
+func WithBreaker(b *breaker.Breaker) Option {
+	return func(w *Weather) {
+		w.breaker = b
+	}
+}
+
+// WithBaseURL sends the requests to baseURL instead of DefaultBaseURL.
+func WithBaseURL(baseURL string) Option {
+	return func(w *Weather) {
+		w.baseURL = strings.TrimRight(baseURL, "/")
+	}
 }
 
-func New(client interfaces.HTTPClient, apikey string, tr trace.Tracer) *Weather {
-	return &Weather{client: client, Apikey: apikey, tr: tr}
+// WithTimeout bounds each request sent upstream, zero means no bound.
+func WithTimeout(timeout time.Duration) Option {
+	return func(w *Weather) {
+		w.SetTimeout(timeout)
+	}
+}
+
+func New(client interfaces.HTTPClient, apikey secrets.Secret, tr trace.Tracer, opts ...Option) *Weather {
+	w := &Weather{client: client, tr: tr, metrics: tracing.NewUpstreamMetrics(), baseURL: DefaultBaseURL}
+	w.SetAPIKey(apikey)
+	for _, opt := range opts {
+		opt(w)
+	}
+	return w
+}
+
+// SetAPIKey replaces the key sent on the following requests.
+func (w *Weather) SetAPIKey(apikey secrets.Secret) {
+	w.apiKey.Store(&apikey)
+}
+
+// SetTimeout replaces the bound of the following requests, zero means no
+// bound.
+func (w *Weather) SetTimeout(timeout time.Duration) {
+	w.timeout.Store(int64(timeout))
 }
 
-func (w *Weather) FindTempByCity(ctx context.Context, city string) (Response, error) {
-	ctx, span := w.tr.Start(ctx, "WeatherAPI")
-	defer span.End()
-	log.Println("city:", city)
-	url := fmt.Sprintf("https://api.weatherapi.com/v1/current.json?key=%s&q=%s", w.Apikey, url.QueryEscape(city))
-	log.Println("find temp by city url", url)
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+func (w *Weather) FindTempByCity(ctx context.Context, city string) (weatherResponse Response, err error) {
+	ctx, span := w.tr.Start(ctx, "WeatherAPI", trace.WithAttributes(
+		tracing.CityNameKey.String(city),
+		tracing.UpstreamProviderKey.String(provider),
+	))
+	defer func() {
+		if err == nil {
+			span.SetAttributes(
+				tracing.TemperatureCelsiusKey.Float64(weatherResponse.Current.TempC),
+				tracing.TemperatureFahrenheitKey.Float64(weatherResponse.Current.TempF),
+			)
+		}
+		if err != nil {
+			logger.WarnContext(ctx, "weather lookup failed", "error", err, string(tracing.ErrorClassKey), tracing.ErrorClass(err))
+		}
+		tracing.RecordError(span, err)
+		span.End()
+	}()
+	if cached, ok := w.cache.Get(city); ok {
+		span.SetAttributes(tracing.CacheHitKey.Bool(true))
+		return cached, nil
+	}
+	span.SetAttributes(tracing.CacheHitKey.Bool(false))
+	defer func(start time.Time) {
+		w.metrics.Record(ctx, provider, start, err)
+	}(time.Now())
+	err = w.breaker.Execute(ctx, func(ctx context.Context) (err error) {
+		weatherResponse, err = w.fetch(ctx, span, city)
+		return err
+	})
+	if err != nil {
+		return Response{}, err
+	}
+	w.cache.Set(city, weatherResponse)
+	return weatherResponse, nil
+}
+
+// fetch asks WeatherAPI for the current conditions of city.
+func (w *Weather) fetch(ctx context.Context, span trace.Span, city string) (weatherResponse Response, err error) {
+	logger.DebugContext(ctx, "fetching weather", "city", city)
+	endpoint := fmt.Sprintf("%s/current.json?q=%s", w.baseURL, url.QueryEscape(city))
+	reqCtx := ctx
+	if timeout := time.Duration(w.timeout.Load()); timeout > 0 {
+		var cancel context.CancelFunc
+		reqCtx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	req, err := http.NewRequestWithContext(reqCtx, http.MethodGet, endpoint, nil)
 	if err != nil {
 		return Response{}, fmt.Errorf("FindTempByCity : error creating request %w", err)
 	}
+	// The key is only added to the built request, so the URL of a parse error
+	// never carries it. The errors of Do are redacted below.
+	query := req.URL.Query()
+	query.Set("key", w.apiKey.Load().Reveal())
+	req.URL.RawQuery = query.Encode()
 	resp, err := w.client.Do(req)
 	if err != nil {
-		return Response{}, fmt.Errorf("FindTempByCity: error doing request %w", err)
+		// The request URL carries the API key, keep it out of the message.
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			urlErr.URL = tracing.RedactURL(req.URL)
+		}
+		return Response{}, tracing.ClassifyUpstream(fmt.Errorf("FindTempByCity: error doing request %w", err))
 	}
 	defer resp.Body.Close()
-	var weatherResponse Response
+	span.SetAttributes(tracing.UpstreamStatusCodeKey.Int(resp.StatusCode))
+	if resp.StatusCode != http.StatusOK {
+		return Response{}, tracing.ClassifyStatus(resp.StatusCode, fmt.Errorf("FindTempByCity: unexpected status %d", resp.StatusCode))
+	}
 	err = json.NewDecoder(resp.Body).Decode(&weatherResponse)
 	if err != nil {
-		log.Println("error aqui", err.Error())
-		return Response{}, fmt.Errorf("FindTempByCity: error deconding request %w", err)
+		return Response{}, tracing.Classify(tracing.ErrorUpstreamBadResponse, fmt.Errorf("FindTempByCity: error deconding request %w", err))
 	}
 	return weatherResponse, nil
 }
@@ -4,18 +4,33 @@ import (
 	"bytes"
 	"context"
 	"errors"
+	"fmt"
 	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace/noop"
 	"io"
 	"net/http"
+	"net/url"
 	"testing"
+	"time"
+	"willianszwy/FC-Tracing/pkg/breaker"
+	"willianszwy/FC-Tracing/pkg/retry"
+	"willianszwy/FC-Tracing/pkg/tracing"
 )
 
 type ClientMock struct {
 	Res *http.Response
 	Err error
+	Req *http.Request
 }
 
 func (c *ClientMock) Do(req *http.Request) (*http.Response, error) {
+	c.Req = req
 	return c.Res, c.Err
 }
 
@@ -65,7 +80,7 @@ func TestFindTempByCity(t *testing.T) {
 	client := ClientMock{
 		Res: &http.Response{Body: body, StatusCode: 200},
 	}
-	weatherApi := New(&client, "asdfasfasf")
+	weatherApi := New(&client, "asdfasfasf", noop.NewTracerProvider().Tracer(""))
 	assert.NotNil(t, weatherApi)
 
 	temp, err := weatherApi.FindTempByCity(context.TODO(), "Cidade")
@@ -76,25 +91,28 @@ func TestFindTempByCity(t *testing.T) {
 }
 
 func TestFindTempByCity_NewRequestError(t *testing.T) {
-	const expectedError = "FindTempByCity : error creating request net/http: nil Context"
-	json := ` {
-    "current": {
-        "temp_c": 18.0,
-        "temp_f": 64.4        
-    }
-}`
-	body := io.NopCloser(bytes.NewReader([]byte(json)))
-	client := ClientMock{
-		Res: &http.Response{Body: body, StatusCode: 200},
-	}
-	weatherApi := New(&client, "asdfasdfasd")
+	const expectedError = "FindTempByCity : error creating request parse \"http://weather\\x7f/current.json?q=\": net/url: invalid control character in URL"
+	client := ClientMock{Err: errors.New("should not be called")}
+	weatherApi := New(&client, "asdfasdfasd", noop.NewTracerProvider().Tracer(""), WithBaseURL("http://weather\x7f"))
 	assert.NotNil(t, weatherApi)
 
-	temp, err := weatherApi.FindTempByCity(nil, "")
+	temp, err := weatherApi.FindTempByCity(context.TODO(), "")
 
 	assert.Equal(t, Response{}, temp)
-	assert.NotNil(t, err)
 	assert.Equal(t, expectedError, err.Error())
+	assert.NotContains(t, err.Error(), "asdfasdfasd")
+	assert.Nil(t, client.Req)
+}
+
+func TestFindTempByCity_KeyIsEncoded(t *testing.T) {
+	client := ClientMock{Err: errors.New("error")}
+	weatherApi := New(&client, "\x7f&q=x", noop.NewTracerProvider().Tracer(""))
+
+	_, err := weatherApi.FindTempByCity(context.TODO(), "Cidade")
+
+	assert.Equal(t, "FindTempByCity: error doing request error", err.Error())
+	assert.Equal(t, "\x7f&q=x", client.Req.URL.Query().Get("key"))
+	assert.Equal(t, "Cidade", client.Req.URL.Query().Get("q"))
 }
 
 func TestFindTempByCity_DoError(t *testing.T) {
@@ -102,7 +120,7 @@ func TestFindTempByCity_DoError(t *testing.T) {
 		Res: nil,
 		Err: errors.New("error"),
 	}
-	weatherApi := New(&client, "asdfasdfasd")
+	weatherApi := New(&client, "asdfasdfasd", noop.NewTracerProvider().Tracer(""))
 	assert.NotNil(t, weatherApi)
 
 	temp, err := weatherApi.FindTempByCity(context.TODO(), "")
@@ -113,7 +131,7 @@ func TestFindTempByCity_DoError(t *testing.T) {
 }
 
 func TestFindTempByCity_UnMarshallError(t *testing.T) {
-	const expectedError = "FindTempByCity: error deconding request json: cannot unmarshal string into Go struct field .current.temp_c of type float64"
+	const expectedError = "FindTempByCity: error deconding request json: cannot unmarshal string into Go struct field"
 	json := ` {
     "current": {
         "temp_c": "teste",
@@ -124,12 +142,159 @@ func TestFindTempByCity_UnMarshallError(t *testing.T) {
 	client := ClientMock{
 		Res: &http.Response{Body: body, StatusCode: 200},
 	}
-	weatherApi := New(&client, "asdfasdfasd")
+	weatherApi := New(&client, "asdfasdfasd", noop.NewTracerProvider().Tracer(""))
 	assert.NotNil(t, weatherApi)
 
 	temp, err := weatherApi.FindTempByCity(context.TODO(), "")
 
 	assert.Equal(t, Response{}, temp)
 	assert.NotNil(t, err)
-	assert.Equal(t, expectedError, err.Error())
+	assert.ErrorContains(t, err, expectedError)
+}
+
+func TestFindTempByCity_RecordsSpanError(t *testing.T) {
+	tests := []struct {
+		status int
+		body   string
+		class  string
+	}{
+		{400, `{"error":{"code":1006,"message":"No matching location found."}}`, tracing.ErrorValidation},
+		{429, `{"error":{"code":2007,"message":"API key has exceeded calls per month quota."}}`, tracing.ErrorUpstreamBadResponse},
+		{500, `{"error":{"code":9999,"message":"Internal application error."}}`, tracing.ErrorUpstreamBadResponse},
+	}
+	for _, tt := range tests {
+		sr := tracetest.NewSpanRecorder()
+		tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr))
+		client := ClientMock{
+			Res: &http.Response{Body: io.NopCloser(bytes.NewReader([]byte(tt.body))), StatusCode: tt.status},
+		}
+		weatherApi := New(&client, "asdfasdfasd", tp.Tracer("test"))
+
+		_, err := weatherApi.FindTempByCity(context.TODO(), "Cidade")
+
+		assert.EqualError(t, err, fmt.Sprintf("FindTempByCity: unexpected status %d", tt.status))
+		span := sr.Ended()[0]
+		assert.Equal(t, "WeatherAPI", span.Name())
+		assert.Equal(t, codes.Error, span.Status().Code)
+		assert.Contains(t, span.Attributes(), attribute.String("error.class", tt.class))
+	}
+}
+
+func TestFindTempByCity_RecordsTimeout(t *testing.T) {
+	sr := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr))
+	client := ClientMock{Err: context.DeadlineExceeded}
+	weatherApi := New(&client, "asdfasdfasd", tp.Tracer("test"))
+
+	_, err := weatherApi.FindTempByCity(context.TODO(), "Cidade")
+
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Contains(t, sr.Ended()[0].Attributes(), attribute.String("error.class", tracing.ErrorUpstreamTimeout))
+}
+
+func TestFindTempByCity_RecordsMetrics(t *testing.T) {
+	reader := sdkmetric.NewManualReader()
+	metrics := tracing.NewUpstreamMetrics(tracing.WithMeterProvider(sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))))
+	client := ClientMock{Err: context.DeadlineExceeded}
+	weatherApi := New(&client, "asdfasdfasd", noop.NewTracerProvider().Tracer(""), WithMetrics(metrics))
+
+	_, err := weatherApi.FindTempByCity(context.TODO(), "Cidade")
+
+	assert.NotNil(t, err)
+	var rm metricdata.ResourceMetrics
+	assert.Nil(t, reader.Collect(context.TODO(), &rm))
+	requests := rm.ScopeMetrics[0].Metrics[0]
+	assert.Equal(t, "upstream.requests", requests.Name)
+	point := requests.Data.(metricdata.Sum[int64]).DataPoints[0]
+	assert.Equal(t, int64(1), point.Value)
+	assert.Equal(t, attribute.NewSet(
+		tracing.UpstreamProviderKey.String("weatherapi"),
+		tracing.OutcomeKey.String(tracing.ErrorUpstreamTimeout),
+	), point.Attributes)
+}
+
+func TestFindTempByCity_DoErrorHidesApiKey(t *testing.T) {
+	client := ClientMock{Err: &url.Error{
+		Op:  "Get",
+		URL: "https://api.weatherapi.com/v1/current.json?key=asdfasdfasd&q=Cidade",
+		Err: errors.New("dial tcp: i/o timeout"),
+	}}
+	weatherApi := New(&client, "asdfasdfasd", noop.NewTracerProvider().Tracer(""))
+
+	_, err := weatherApi.FindTempByCity(context.TODO(), "Cidade")
+
+	assert.EqualError(t, err, `FindTempByCity: error doing request Get "https://api.weatherapi.com/v1/current.json?key=REDACTED&q=Cidade": dial tcp: i/o timeout`)
+}
+
+func TestFindTempByCity_SetAPIKey(t *testing.T) {
+	client := ClientMock{Err: errors.New("error")}
+	weatherApi := New(&client, "old", noop.NewTracerProvider().Tracer(""))
+
+	weatherApi.SetAPIKey("new")
+	_, err := weatherApi.FindTempByCity(context.TODO(), "Cidade")
+
+	assert.NotNil(t, err)
+	assert.Equal(t, "new", client.Req.URL.Query().Get("key"))
+}
+
+func TestFindTempByCity_Breaker(t *testing.T) {
+	sr := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr))
+	settings := breaker.DefaultSettings()
+	settings.MinCalls = 1
+	client := ClientMock{Res: &http.Response{Body: io.NopCloser(bytes.NewReader(nil)), StatusCode: 500}}
+	w := New(&client, "key", tp.Tracer("test"), WithBreaker(breaker.New("weatherapi", settings)))
+
+	_, err := w.FindTempByCity(context.TODO(), "São Paulo")
+	assert.NotNil(t, err)
+	client.Req = nil
+	_, err = w.FindTempByCity(context.TODO(), "São Paulo")
+
+	assert.ErrorIs(t, err, breaker.ErrOpen)
+	assert.Nil(t, client.Req)
+	spans := sr.Ended()
+	assert.Equal(t, breaker.EventStateChange, spans[0].Events()[0].Name)
+	assert.Contains(t, spans[1].Attributes(), attribute.String("error.class", "circuit_open"))
+}
+
+func TestFindTempByCity_UnknownCityKeepsBreakerClosed(t *testing.T) {
+	settings := breaker.DefaultSettings()
+	settings.MinCalls = 1
+	b := breaker.New("weatherapi", settings)
+	client := ClientMock{Res: &http.Response{Body: io.NopCloser(bytes.NewReader(nil)), StatusCode: 400}}
+	w := New(&client, "key", noop.NewTracerProvider().Tracer(""), WithBreaker(b))
+
+	for i := 0; i < 3; i++ {
+		_, err := w.FindTempByCity(context.TODO(), "Nowhere")
+		assert.Equal(t, tracing.ErrorValidation, tracing.ErrorClass(err))
+	}
+
+	assert.Equal(t, breaker.Closed, b.State())
+}
+
+func TestFindTempByCity_SpansHideApiKey(t *testing.T) {
+	const secret = "s3cr3t-key"
+	sr := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr))
+	client := retry.NewClient(tracing.NewClient(tracing.WithTracerProvider(tp)),
+		retry.Policy{MaxAttempts: 2, InitialBackoff: time.Millisecond, MaxBackoff: time.Millisecond},
+		retry.WithTracerProvider(tp))
+	weatherApi := New(client, secret, tp.Tracer("test"), WithBaseURL("http://127.0.0.1:1"))
+
+	_, err := weatherApi.FindTempByCity(context.TODO(), "Cidade")
+
+	assert.NotNil(t, err)
+	assert.NotContains(t, err.Error(), secret)
+	assert.NotEmpty(t, sr.Ended())
+	for _, span := range sr.Ended() {
+		assert.NotContains(t, span.Status().Description, secret, span.Name())
+		for _, attr := range span.Attributes() {
+			assert.NotContains(t, attr.Value.Emit(), secret, span.Name())
+		}
+		for _, event := range span.Events() {
+			for _, attr := range event.Attributes {
+				assert.NotContains(t, attr.Value.Emit(), secret, span.Name())
+			}
+		}
+	}
 }
@@ -0,0 +1,371 @@
+// Package breaker stops calling a failing upstream dependency for a while,
+// failing fast instead, and probes it before closing again.
+package breaker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+	"net/http"
+	"sync"
+	"time"
+	"willianszwy/FC-Tracing/pkg/deadline"
+	"willianszwy/FC-Tracing/pkg/logging"
+	"willianszwy/FC-Tracing/pkg/tracing"
+)
+
+const instrumentationName = "willianszwy/FC-Tracing/pkg/breaker"
+
+// EventStateChange is the span event added by the call that moved a
+// breaker to another state.
+const EventStateChange = "circuit_breaker.state_change"
+
+// Attributes of the state change events and of the metrics.
+const (
+	NameKey         = attribute.Key("circuit_breaker.name")
+	StateKey        = attribute.Key("circuit_breaker.state")
+	FromStateKey    = attribute.Key("circuit_breaker.state.from")
+	FailureRateKey  = attribute.Key("circuit_breaker.failure_rate")
+	SlowCallRateKey = attribute.Key("circuit_breaker.slow_call_rate")
+)
+
+// ErrOpen is returned, wrapped and classified as tracing.ErrorCircuitOpen,
+// for the calls rejected without reaching the dependency.
+var ErrOpen = errors.New("circuit breaker is open")
+
+var logger = logging.Package("breaker")
+
+// State is the state of a breaker, reported by the circuit_breaker.state
+// gauge as its number.
+type State int
+
+const (
+	// Closed lets every call through.
+	Closed State = iota
+	// HalfOpen lets a few trial calls through to decide whether to close.
+	HalfOpen
+	// Open rejects every call until Settings.OpenTimeout elapsed.
+	Open
+)
+
+func (s State) String() string {
+	switch s {
+	case Closed:
+		return "closed"
+	case HalfOpen:
+		return "half_open"
+	case Open:
+		return "open"
+	}
+	return fmt.Sprintf("State(%d)", int(s))
+}
+
+// Settings tune when a breaker opens and closes.
+type Settings struct {
+	// WindowSize is the number of latest calls the rates are computed on.
+	WindowSize int
+	// MinCalls is the number of calls needed in the window before the
+	// breaker may open.
+	MinCalls int
+	// FailureRate, from 0 to 1, opens the breaker when reached.
+	FailureRate float64
+	// SlowCallDuration is the duration from which a call is slow.
+	SlowCallDuration time.Duration
+	// SlowCallRate, from 0 to 1, opens the breaker when reached.
+	SlowCallRate float64
+	// OpenTimeout is how long the breaker stays open before half-opening.
+	OpenTimeout time.Duration
+	// HalfOpenCalls is the number of trial calls of the half-open state.
+	HalfOpenCalls int
+	// IsFailure tells the errors counted as failures, DefaultIsFailure when
+	// nil.
+	IsFailure func(error) bool
+}
+
+// DefaultSettings opens on half of the 20 latest calls failing, or 80% of
+// them taking 2s or more, and probes again after 30s with 3 calls.
+func DefaultSettings() Settings {
+	return Settings{
+		WindowSize:       20,
+		MinCalls:         10,
+		FailureRate:      0.5,
+		SlowCallDuration: 2 * time.Second,
+		SlowCallRate:     0.8,
+		OpenTimeout:      30 * time.Second,
+		HalfOpenCalls:    3,
+	}
+}
+
+// DefaultIsFailure counts upstream timeouts, unavailability and bad
+// responses as failures; a lookup that found nothing or a rejected input is
+// a healthy answer. Only timeouts of the call's own limit or of its share of
+// the request budget count: Execute ignores calls whose request context,
+// see deadline.RequestContext, is done, and a call refused for lack of
+// budget is not a failure.
+func DefaultIsFailure(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, deadline.ErrExhausted) {
+		return false
+	}
+	switch tracing.ErrorClass(err) {
+	case tracing.ErrorUpstreamTimeout, tracing.ErrorUpstreamUnavailable, tracing.ErrorUpstreamBadResponse:
+		return true
+	}
+	return false
+}
+
+type outcome struct {
+	failed, slow bool
+}
+
+// Breaker guards the calls to one dependency. A nil Breaker lets every call
+// through.
+type Breaker struct {
+	name     string
+	settings Settings
+	now      func() time.Time
+
+	mu       sync.Mutex
+	state    State
+	openedAt time.Time
+	// generation changes with the state, so calls started before a
+	// transition are not counted after it.
+	generation uint64
+	window     []outcome
+	next       int
+	trials     int
+
+	transitions metric.Int64Counter
+}
+
+// Option customizes a Breaker.
+type Option func(*options)
+
+type options struct {
+	mp metric.MeterProvider
+}
+
+// WithMeterProvider uses mp instead of the global meter provider.
+func WithMeterProvider(mp metric.MeterProvider) Option {
+	return func(o *options) {
+		o.mp = mp
+	}
+}
+
+// New returns a closed breaker named after the dependency it guards.
+func New(name string, settings Settings, opts ...Option) *Breaker {
+	o := options{mp: otel.GetMeterProvider()}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	settings.WindowSize = max(settings.WindowSize, 1)
+	settings.MinCalls = max(settings.MinCalls, 1)
+	settings.HalfOpenCalls = max(settings.HalfOpenCalls, 1)
+	if settings.IsFailure == nil {
+		settings.IsFailure = DefaultIsFailure
+	}
+	b := &Breaker{name: name, settings: settings, now: time.Now}
+
+	meter := o.mp.Meter(instrumentationName)
+	b.transitions, _ = meter.Int64Counter("circuit_breaker.transitions",
+		metric.WithDescription("Number of circuit breaker state changes."),
+		metric.WithUnit("{transition}"))
+	state, _ := meter.Int64ObservableGauge("circuit_breaker.state",
+		metric.WithDescription("State of the circuit breaker: 0 closed, 1 half-open, 2 open."))
+	meter.RegisterCallback(func(_ context.Context, o metric.Observer) error {
+		o.ObserveInt64(state, int64(b.State()), metric.WithAttributes(NameKey.String(b.name)))
+		return nil
+	}, state)
+	return b
+}
+
+// Name is the name of the guarded dependency.
+func (b *Breaker) Name() string {
+	return b.name
+}
+
+// State returns the current state, half-open once the open timeout elapsed.
+func (b *Breaker) State() State {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == Open && !b.now().Before(b.openedAt.Add(b.settings.OpenTimeout)) {
+		return HalfOpen
+	}
+	return b.state
+}
+
+// Execute runs fn unless the breaker is open, and counts its outcome. A call
+// outliving ctx, a hop of deadline.StartHop, counts as slow; one outliving
+// the request of ctx is not counted. The state changes caused by the call
+// are added to the span of ctx.
+func (b *Breaker) Execute(ctx context.Context, fn func(ctx context.Context) error) error {
+	if b == nil {
+		return fn(ctx)
+	}
+	generation, err := b.allow(ctx)
+	if err != nil {
+		return err
+	}
+	start := b.now()
+	err = fn(ctx)
+	if deadline.RequestContext(ctx).Err() != nil {
+		// The request was cancelled or ran out of its budget, which says
+		// nothing about the dependency.
+		b.release(generation)
+		return err
+	}
+	b.record(ctx, generation, outcome{
+		failed: err != nil && b.settings.IsFailure(err),
+		// Using up the share of the budget given to the call is slow.
+		slow: ctx.Err() != nil || b.now().Sub(start) >= b.settings.SlowCallDuration,
+	})
+	return err
+}
+
+// Check is a health.Check failing while the breaker is not closed.
+func (b *Breaker) Check(context.Context) error {
+	if state := b.State(); state != Closed {
+		return fmt.Errorf("circuit breaker %s", state)
+	}
+	return nil
+}
+
+func (b *Breaker) allow(ctx context.Context) (uint64, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == Open && !b.now().Before(b.openedAt.Add(b.settings.OpenTimeout)) {
+		b.transition(ctx, HalfOpen, 0, 0)
+	}
+	switch {
+	case b.state == Open:
+	case b.state == HalfOpen && b.trials >= b.settings.HalfOpenCalls:
+	default:
+		if b.state == HalfOpen {
+			b.trials++
+		}
+		return b.generation, nil
+	}
+	return 0, tracing.Classify(tracing.ErrorCircuitOpen, fmt.Errorf("%s: %w", b.name, ErrOpen))
+}
+
+// release gives back the half-open trial of a call whose outcome is not
+// recorded.
+func (b *Breaker) release(generation uint64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if generation == b.generation && b.state == HalfOpen {
+		b.trials--
+	}
+}
+
+func (b *Breaker) record(ctx context.Context, generation uint64, o outcome) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if generation != b.generation {
+		return
+	}
+	if len(b.window) < b.settings.WindowSize {
+		b.window = append(b.window, o)
+	} else {
+		b.window[b.next] = o
+		b.next = (b.next + 1) % len(b.window)
+	}
+
+	minCalls := b.settings.MinCalls
+	if b.state == HalfOpen {
+		minCalls = b.settings.HalfOpenCalls
+	}
+	if len(b.window) < minCalls {
+		return
+	}
+	failureRate, slowCallRate := b.rates()
+	tripped := failureRate >= b.settings.FailureRate || slowCallRate >= b.settings.SlowCallRate
+	switch {
+	case tripped:
+		b.transition(ctx, Open, failureRate, slowCallRate)
+	case b.state == HalfOpen:
+		b.transition(ctx, Closed, failureRate, slowCallRate)
+	}
+}
+
+func (b *Breaker) rates() (failureRate, slowCallRate float64) {
+	var failed, slow int
+	for _, o := range b.window {
+		if o.failed {
+			failed++
+		}
+		if o.slow {
+			slow++
+		}
+	}
+	n := float64(len(b.window))
+	return float64(failed) / n, float64(slow) / n
+}
+
+// transition moves the breaker to state, starting a new window.
+func (b *Breaker) transition(ctx context.Context, state State, failureRate, slowCallRate float64) {
+	from := b.state
+	b.state = state
+	b.generation++
+	b.window, b.next, b.trials = b.window[:0], 0, 0
+	if state == Open {
+		b.openedAt = b.now()
+	}
+
+	attrs := []attribute.KeyValue{
+		NameKey.String(b.name),
+		FromStateKey.String(from.String()),
+		StateKey.String(state.String()),
+		FailureRateKey.Float64(failureRate),
+		SlowCallRateKey.Float64(slowCallRate),
+	}
+	trace.SpanFromContext(ctx).AddEvent(EventStateChange, trace.WithAttributes(attrs...))
+	b.transitions.Add(ctx, 1, metric.WithAttributes(attrs[:3]...))
+	level := logger.InfoContext
+	if state == Open {
+		level = logger.WarnContext
+	}
+	level(ctx, "circuit breaker state changed", "breaker", b.name, "from", from.String(), "to", state.String(),
+		"failure_rate", failureRate, "slow_call_rate", slowCallRate)
+}
+
+// HTTPClient sends a request, as http.Client does.
+type HTTPClient interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
+// Client guards the requests of a wrapped HTTPClient with a Breaker,
+// counting transport errors, 5xx and 429 answers as failures.
+type Client struct {
+	client  HTTPClient
+	breaker *Breaker
+}
+
+// NewClient wraps client with b.
+func NewClient(client HTTPClient, b *Breaker) *Client {
+	return &Client{client: client, breaker: b}
+}
+
+// Do sends req, returning an error wrapping ErrOpen when the breaker
+// rejects it.
+func (c *Client) Do(req *http.Request) (*http.Response, error) {
+	var resp *http.Response
+	var doErr error
+	err := c.breaker.Execute(req.Context(), func(context.Context) error {
+		resp, doErr = c.client.Do(req)
+		if doErr != nil {
+			return tracing.ClassifyUpstream(doErr)
+		}
+		if resp.StatusCode >= http.StatusInternalServerError || resp.StatusCode == http.StatusTooManyRequests {
+			return tracing.Classify(tracing.ErrorUpstreamBadResponse, fmt.Errorf("unexpected status %d", resp.StatusCode))
+		}
+		return nil
+	})
+	if errors.Is(err, ErrOpen) && resp == nil && doErr == nil {
+		return nil, err
+	}
+	return resp, doErr
+}
@@ -0,0 +1,249 @@
+package breaker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+	"willianszwy/FC-Tracing/pkg/deadline"
+	"willianszwy/FC-Tracing/pkg/tracing"
+)
+
+var (
+	errUnavailable = tracing.Classify(tracing.ErrorUpstreamUnavailable, errors.New("connection refused"))
+	errNotFound    = tracing.Classify(tracing.ErrorNotFound, errors.New("city not found"))
+)
+
+type clock struct {
+	now time.Time
+}
+
+func (c *clock) Now() time.Time {
+	return c.now
+}
+
+func newBreaker(settings Settings) (*Breaker, *clock, *sdkmetric.ManualReader) {
+	reader := sdkmetric.NewManualReader()
+	b := New("weatherapi", settings, WithMeterProvider(sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))))
+	c := &clock{now: time.Unix(0, 0)}
+	b.now = c.Now
+	return b, c, reader
+}
+
+var settings = Settings{WindowSize: 4, MinCalls: 4, FailureRate: 0.5, SlowCallDuration: time.Second, SlowCallRate: 0.75, OpenTimeout: 10 * time.Second, HalfOpenCalls: 2}
+
+func call(b *Breaker, err error) error {
+	return b.Execute(context.Background(), func(context.Context) error { return err })
+}
+
+func TestBreaker_OpensOnFailureRate(t *testing.T) {
+	b, _, _ := newBreaker(settings)
+
+	assert.Nil(t, call(b, nil))
+	assert.Equal(t, errNotFound, call(b, errNotFound))
+	assert.Equal(t, errUnavailable, call(b, errUnavailable))
+	assert.Equal(t, Closed, b.State())
+	assert.Equal(t, errUnavailable, call(b, errUnavailable))
+
+	assert.Equal(t, Open, b.State())
+	called := false
+	err := b.Execute(context.Background(), func(context.Context) error {
+		called = true
+		return nil
+	})
+	assert.False(t, called)
+	assert.ErrorIs(t, err, ErrOpen)
+	assert.Equal(t, tracing.ErrorCircuitOpen, tracing.ErrorClass(err))
+	assert.EqualError(t, b.Check(context.Background()), "circuit breaker open")
+}
+
+func TestBreaker_OpensOnSlowCalls(t *testing.T) {
+	b, c, _ := newBreaker(settings)
+	slow := func(context.Context) error {
+		c.now = c.now.Add(2 * time.Second)
+		return nil
+	}
+
+	for i := 0; i < 3; i++ {
+		assert.Nil(t, b.Execute(context.Background(), slow))
+	}
+	assert.Nil(t, call(b, nil))
+
+	assert.Equal(t, Open, b.State())
+}
+
+func TestBreaker_HalfOpen(t *testing.T) {
+	b, c, _ := newBreaker(settings)
+	for i := 0; i < 4; i++ {
+		call(b, errUnavailable)
+	}
+	c.now = c.now.Add(10 * time.Second)
+	assert.Equal(t, HalfOpen, b.State())
+
+	assert.Equal(t, errUnavailable, call(b, errUnavailable))
+	assert.Equal(t, errUnavailable, call(b, errUnavailable))
+	assert.Equal(t, Open, b.State())
+
+	c.now = c.now.Add(10 * time.Second)
+	started, release := make(chan struct{}), make(chan struct{})
+	done := make(chan error)
+	for i := 0; i < 2; i++ {
+		go func() {
+			done <- b.Execute(context.Background(), func(context.Context) error {
+				started <- struct{}{}
+				<-release
+				return nil
+			})
+		}()
+	}
+	<-started
+	<-started
+	assert.ErrorIs(t, call(b, nil), ErrOpen)
+	close(release)
+	assert.Nil(t, <-done)
+	assert.Nil(t, <-done)
+
+	assert.Equal(t, Closed, b.State())
+	assert.Nil(t, b.Check(context.Background()))
+}
+
+func TestBreaker_IgnoresCallerDeadline(t *testing.T) {
+	b, c, _ := newBreaker(settings)
+	errTimeout := tracing.Classify(tracing.ErrorUpstreamTimeout, context.DeadlineExceeded)
+	expired, cancel := context.WithDeadline(context.Background(), time.Unix(0, 0))
+	defer cancel()
+	callerTimeout := func(context.Context) error { return errTimeout }
+
+	for i := 0; i < 10; i++ {
+		assert.Equal(t, errTimeout, b.Execute(expired, callerTimeout))
+	}
+	assert.Equal(t, Closed, b.State())
+	errExhausted := tracing.ClassifyUpstream(fmt.Errorf("%w: %w", deadline.ErrExhausted, context.DeadlineExceeded))
+	for i := 0; i < 10; i++ {
+		call(b, errExhausted)
+	}
+	assert.Equal(t, Closed, b.State())
+
+	// Timeouts of the call's own limit, under a live caller context, count.
+	for i := 0; i < 4; i++ {
+		call(b, errTimeout)
+	}
+	assert.Equal(t, Open, b.State())
+
+	// An ignored trial does not use up the half-open calls.
+	c.now = c.now.Add(10 * time.Second)
+	assert.Equal(t, HalfOpen, b.State())
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, errTimeout, b.Execute(expired, callerTimeout))
+	}
+	assert.Nil(t, call(b, nil))
+	assert.Nil(t, call(b, nil))
+	assert.Equal(t, Closed, b.State())
+}
+
+func TestBreaker_CountsHopShare(t *testing.T) {
+	b, _, _ := newBreaker(settings)
+	request, cancel := context.WithTimeout(context.Background(), time.Hour)
+	defer cancel()
+	hung := func(ctx context.Context) error {
+		<-ctx.Done()
+		return tracing.ClassifyUpstream(ctx.Err())
+	}
+
+	for i := 0; i < 4; i++ {
+		hop := deadline.StartHop(request, "viacep", 1e-9)
+		assert.ErrorIs(t, b.Execute(hop.Context(), hung), context.DeadlineExceeded)
+		hop.End()
+	}
+
+	assert.Equal(t, Open, b.State())
+}
+
+func TestBreaker_StateChangeEvents(t *testing.T) {
+	sr := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr))
+	b, _, reader := newBreaker(settings)
+	ctx, span := tp.Tracer("test").Start(context.Background(), "call")
+
+	for i := 0; i < 4; i++ {
+		b.Execute(ctx, func(context.Context) error { return errUnavailable })
+	}
+	span.End()
+
+	events := sr.Ended()[0].Events()
+	assert.Len(t, events, 1)
+	assert.Equal(t, EventStateChange, events[0].Name)
+	assert.Contains(t, events[0].Attributes, attribute.String("circuit_breaker.name", "weatherapi"))
+	assert.Contains(t, events[0].Attributes, attribute.String("circuit_breaker.state.from", "closed"))
+	assert.Contains(t, events[0].Attributes, attribute.String("circuit_breaker.state", "open"))
+	assert.Contains(t, events[0].Attributes, attribute.Float64("circuit_breaker.failure_rate", 1))
+
+	var rm metricdata.ResourceMetrics
+	assert.Nil(t, reader.Collect(context.Background(), &rm))
+	metrics := map[string]metricdata.Aggregation{}
+	for _, m := range rm.ScopeMetrics[0].Metrics {
+		metrics[m.Name] = m.Data
+	}
+	state := metrics["circuit_breaker.state"].(metricdata.Gauge[int64])
+	assert.Equal(t, int64(Open), state.DataPoints[0].Value)
+	transitions := metrics["circuit_breaker.transitions"].(metricdata.Sum[int64])
+	assert.Equal(t, int64(1), transitions.DataPoints[0].Value)
+}
+
+func TestBreaker_Nil(t *testing.T) {
+	var b *Breaker
+
+	assert.Equal(t, errUnavailable, call(b, errUnavailable))
+}
+
+type ClientMock struct {
+	Status int
+	Err    error
+	Calls  int
+}
+
+func (c *ClientMock) Do(req *http.Request) (*http.Response, error) {
+	c.Calls++
+	if c.Err != nil {
+		return nil, c.Err
+	}
+	return &http.Response{StatusCode: c.Status, Body: io.NopCloser(strings.NewReader("body"))}, nil
+}
+
+func TestClient(t *testing.T) {
+	for _, status := range []int{http.StatusBadGateway, http.StatusTooManyRequests} {
+		b, _, _ := newBreaker(settings)
+		mock := &ClientMock{Status: status}
+		client := NewClient(mock, b)
+		req, _ := http.NewRequest(http.MethodPost, "http://service-b/temperature", nil)
+
+		for i := 0; i < 4; i++ {
+			resp, err := client.Do(req)
+			assert.Nil(t, err)
+			assert.Equal(t, status, resp.StatusCode)
+		}
+		resp, err := client.Do(req)
+
+		assert.Nil(t, resp)
+		assert.ErrorIs(t, err, ErrOpen)
+		assert.Equal(t, 4, mock.Calls)
+	}
+
+	b, _, _ := newBreaker(settings)
+	client := NewClient(&ClientMock{Status: http.StatusUnprocessableEntity}, b)
+	req, _ := http.NewRequest(http.MethodPost, "http://service-b/temperature", nil)
+	for i := 0; i < 4; i++ {
+		client.Do(req)
+	}
+	assert.Equal(t, Closed, b.State())
+}
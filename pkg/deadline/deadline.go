@@ -0,0 +1,244 @@
+// Package deadline bounds a request with a time budget, propagates what is
+// left of it to the next service and shares it among the dependencies
+// called.
+package deadline
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"net/http"
+	"strconv"
+	"time"
+	"willianszwy/FC-Tracing/pkg/tracing"
+)
+
+// Header carries the time left to answer, in the grpc-timeout format: at
+// most 8 digits followed by a unit, H, M, S, m, u or n, e.g. 1500m.
+const Header = "X-Request-Timeout"
+
+// Sources of the budget of a request.
+const (
+	SourceHeader  = "header"
+	SourceDefault = "default"
+)
+
+// Span attributes describing the budget and the hop that exhausted it.
+const (
+	BudgetKey       = attribute.Key("deadline.budget_ms")
+	SourceKey       = attribute.Key("deadline.source")
+	ExhaustedHopKey = attribute.Key("deadline.exhausted_hop")
+	ExhaustedByKey  = attribute.Key("deadline.exhausted_by")
+	HopBudgetKey    = attribute.Key("deadline.hop_budget_ms")
+	RemainingKey    = attribute.Key("deadline.remaining_ms")
+	HopElapsedKey   = attribute.Key("deadline.hop_elapsed_ms")
+)
+
+// What ran out of time, recorded as deadline.exhausted_by: the whole
+// request budget, the share of it given to the hop, or the timeout of the
+// dependency client.
+const (
+	ExhaustedBudget  = "budget"
+	ExhaustedShare   = "share"
+	ExhaustedTimeout = "timeout"
+)
+
+// MinBudget is the least time worth handling a request or calling the next
+// service with: below it the request is answered 504 at once.
+const MinBudget = 10 * time.Millisecond
+
+// ErrExhausted is returned by Transport when too little of the budget is
+// left to call the next service. It wraps context.DeadlineExceeded.
+var ErrExhausted = errors.New("deadline: budget exhausted")
+
+// HopRequest is the exhausted hop recorded when a request arrives with less
+// than MinBudget left.
+const HopRequest = "request"
+
+var units = []struct {
+	unit byte
+	d    time.Duration
+}{
+	{'n', time.Nanosecond},
+	{'u', time.Microsecond},
+	{'m', time.Millisecond},
+	{'S', time.Second},
+	{'M', time.Minute},
+	{'H', time.Hour},
+}
+
+const maxDigits = 1e8
+
+// Format encodes d with the finest unit that fits in 8 digits, rounding
+// up.
+func Format(d time.Duration) string {
+	if d <= 0 {
+		return "0n"
+	}
+	for _, u := range units {
+		if v := (d + u.d - 1) / u.d; v < maxDigits {
+			return strconv.FormatInt(int64(v), 10) + string(u.unit)
+		}
+	}
+	return strconv.FormatInt(maxDigits-1, 10) + "H"
+}
+
+// Parse decodes a value written by Format, rejecting zero.
+func Parse(s string) (time.Duration, error) {
+	if len(s) < 2 || len(s) > 9 {
+		return 0, fmt.Errorf("deadline: invalid timeout %q", s)
+	}
+	v, err := strconv.ParseUint(s[:len(s)-1], 10, 64)
+	if err != nil || v == 0 {
+		return 0, fmt.Errorf("deadline: invalid timeout %q", s)
+	}
+	for _, u := range units {
+		if u.unit == s[len(s)-1] {
+			return time.Duration(v) * u.d, nil
+		}
+	}
+	return 0, fmt.Errorf("deadline: invalid timeout unit in %q", s)
+}
+
+// Middleware bounds each request by the budget received in Header, capped
+// by budget, or by budget when the header is missing. The budget is recorded
+// on the server span. A received budget below MinBudget, zero or invalid, is
+// answered 504 without calling next.
+func Middleware(budget time.Duration) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			timeout, source := budget, SourceDefault
+			if values := r.Header.Values(Header); len(values) > 0 {
+				// An invalid value leaves no budget: the caller may have
+				// had none left to send.
+				received, _ := Parse(values[0])
+				timeout, source = min(received, budget), SourceHeader
+			}
+			span := trace.SpanFromContext(r.Context())
+			span.SetAttributes(
+				BudgetKey.Int64(timeout.Milliseconds()),
+				SourceKey.String(source),
+			)
+			if timeout < MinBudget {
+				span.SetAttributes(
+					ExhaustedHopKey.String(HopRequest),
+					ExhaustedByKey.String(ExhaustedBudget),
+				)
+				http.Error(w, "deadline exceeded", http.StatusGatewayTimeout)
+				return
+			}
+			ctx, cancel := context.WithTimeout(r.Context(), timeout)
+			defer cancel()
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// Transport returns a RoundTripper sending in Header the time left on the
+// request context less margin, kept to carry the answer back, through base,
+// http.DefaultTransport when nil. With less than MinBudget to send, it
+// fails with ErrExhausted without calling base.
+func Transport(base http.RoundTripper, margin time.Duration) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &transport{base: base, margin: margin}
+}
+
+type transport struct {
+	base   http.RoundTripper
+	margin time.Duration
+}
+
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	deadline, ok := req.Context().Deadline()
+	if !ok {
+		return t.base.RoundTrip(req)
+	}
+	left := time.Until(deadline) - t.margin
+	if left < MinBudget {
+		return nil, fmt.Errorf("%w, %s left below %s: %w", ErrExhausted, left.Round(time.Millisecond), MinBudget, context.DeadlineExceeded)
+	}
+	r := req.Clone(req.Context())
+	r.Header.Set(Header, Format(left))
+	return t.base.RoundTrip(r)
+}
+
+// Hop is a call to one dependency within the request budget.
+type Hop struct {
+	name   string
+	parent context.Context
+	ctx    context.Context
+	cancel context.CancelFunc
+	start  time.Time
+	budget time.Duration
+}
+
+// StartHop bounds the call to the dependency name by share, from 0 to 1, of
+// the time left on ctx, so the following hops keep the rest. A share of 0
+// or 1 gives the hop all of it. Call End once the call is done.
+func StartHop(ctx context.Context, name string, share float64) *Hop {
+	h := &Hop{name: name, parent: ctx, ctx: ctx, cancel: func() {}, start: time.Now(), budget: -1}
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return h
+	}
+	h.budget = time.Until(deadline)
+	if share > 0 && share < 1 {
+		h.budget = time.Duration(float64(h.budget) * share)
+		h.ctx, h.cancel = context.WithTimeout(context.WithValue(ctx, requestKey{}, RequestContext(ctx)), h.budget)
+	}
+	return h
+}
+
+type requestKey struct{}
+
+// RequestContext returns the context of the request a hop context was
+// started from, or ctx itself outside of a hop with its own share.
+func RequestContext(ctx context.Context) context.Context {
+	if request, ok := ctx.Value(requestKey{}).(context.Context); ok {
+		return request
+	}
+	return ctx
+}
+
+// Context is the context of the call.
+func (h *Hop) Context() context.Context {
+	return h.ctx
+}
+
+// End releases the resources of the hop.
+func (h *Hop) End() {
+	h.cancel()
+}
+
+// Exhausted reports whether err is the hop running out of time. It then
+// records on the span of the request which hop ran out and whether the
+// request budget, the hop share or the dependency timeout was exhausted.
+func (h *Hop) Exhausted(err error) bool {
+	if !errors.Is(err, context.DeadlineExceeded) && tracing.ErrorClass(err) != tracing.ErrorUpstreamTimeout {
+		return false
+	}
+	by := ExhaustedTimeout
+	switch {
+	case h.parent.Err() != nil, errors.Is(err, ErrExhausted):
+		by = ExhaustedBudget
+	case h.ctx.Err() != nil:
+		by = ExhaustedShare
+	}
+	attrs := []attribute.KeyValue{
+		ExhaustedHopKey.String(h.name),
+		ExhaustedByKey.String(by),
+		HopElapsedKey.Int64(time.Since(h.start).Milliseconds()),
+	}
+	if h.budget >= 0 {
+		attrs = append(attrs, HopBudgetKey.Int64(h.budget.Milliseconds()))
+	}
+	if deadline, ok := h.parent.Deadline(); ok {
+		attrs = append(attrs, RemainingKey.Int64(max(time.Until(deadline), 0).Milliseconds()))
+	}
+	trace.SpanFromContext(h.parent).SetAttributes(attrs...)
+	return true
+}
@@ -0,0 +1,193 @@
+package deadline
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+	"willianszwy/FC-Tracing/pkg/tracing"
+)
+
+func TestFormatAndParse(t *testing.T) {
+	tests := []struct {
+		d    time.Duration
+		text string
+	}{
+		{1500 * time.Millisecond, "1500000u"},
+		{99 * time.Millisecond, "99000000n"},
+		{3 * time.Minute, "180000m"},
+		{30 * time.Hour, "108000S"},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.text, Format(tt.d))
+		d, err := Parse(tt.text)
+		assert.Nil(t, err)
+		assert.Equal(t, tt.d, d)
+	}
+	assert.Equal(t, "100001u", Format(100000001*time.Nanosecond))
+	assert.Equal(t, "0n", Format(-time.Second))
+
+	for _, text := range []string{"", "5", "5s", "-1m", "123456789m", "1.5S", "0n", "0S"} {
+		_, err := Parse(text)
+		assert.NotNil(t, err, text)
+	}
+}
+
+type RoundTripperMock struct {
+	Req *http.Request
+}
+
+func (m *RoundTripperMock) RoundTrip(req *http.Request) (*http.Response, error) {
+	m.Req = req
+	return &http.Response{StatusCode: 200, Body: http.NoBody}, nil
+}
+
+func TestTransport(t *testing.T) {
+	base := &RoundTripperMock{}
+	client := &http.Client{Transport: Transport(base, 100*time.Millisecond)}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodPost, "http://service-b/temperature", nil)
+
+	_, err := client.Do(req)
+
+	assert.Nil(t, err)
+	sent, err := Parse(base.Req.Header.Get(Header))
+	assert.Nil(t, err)
+	assert.InDelta(t, 900*time.Millisecond, sent, float64(50*time.Millisecond))
+	assert.Empty(t, req.Header.Get(Header))
+
+	req, _ = http.NewRequest(http.MethodPost, "http://service-b/temperature", nil)
+	client.Do(req)
+	assert.Empty(t, base.Req.Header.Get(Header))
+
+	base.Req = nil
+	ctx, cancel = context.WithTimeout(context.Background(), 105*time.Millisecond)
+	defer cancel()
+	req, _ = http.NewRequestWithContext(ctx, http.MethodPost, "http://service-b/temperature", nil)
+	_, err = client.Do(req)
+	assert.ErrorIs(t, err, ErrExhausted)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Nil(t, base.Req)
+}
+
+func TestMiddleware(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string
+		budget time.Duration
+		source string
+	}{
+		{"default", "", 5 * time.Second, SourceDefault},
+		{"header", "1500m", 1500 * time.Millisecond, SourceHeader},
+		{"capped", "10S", 5 * time.Second, SourceHeader},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sr := tracetest.NewSpanRecorder()
+			tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr))
+			ctx, span := tp.Tracer("test").Start(context.Background(), "POST /temperature")
+			req := httptest.NewRequest(http.MethodPost, "/temperature", nil).WithContext(ctx)
+			if tt.header != "" {
+				req.Header.Set(Header, tt.header)
+			}
+			var left time.Duration
+			h := Middleware(5 * time.Second)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				deadline, ok := r.Context().Deadline()
+				assert.True(t, ok)
+				left = time.Until(deadline)
+			}))
+
+			h.ServeHTTP(httptest.NewRecorder(), req)
+			span.End()
+
+			assert.InDelta(t, tt.budget, left, float64(50*time.Millisecond))
+			attrs := sr.Ended()[0].Attributes()
+			assert.Contains(t, attrs, attribute.Int64("deadline.budget_ms", tt.budget.Milliseconds()))
+			assert.Contains(t, attrs, attribute.String("deadline.source", tt.source))
+		})
+	}
+}
+
+func TestMiddleware_BelowMinBudget(t *testing.T) {
+	for _, header := range []string{"1n", "0n", "9m", "soon", ""} {
+		t.Run(header, func(t *testing.T) {
+			sr := tracetest.NewSpanRecorder()
+			tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr))
+			ctx, span := tp.Tracer("test").Start(context.Background(), "POST /temperature")
+			req := httptest.NewRequest(http.MethodPost, "/temperature", nil).WithContext(ctx)
+			req.Header[Header] = []string{header}
+			called := false
+			h := Middleware(5 * time.Second)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				called = true
+			}))
+			w := httptest.NewRecorder()
+
+			h.ServeHTTP(w, req)
+			span.End()
+
+			attrs := sr.Ended()[0].Attributes()
+			assert.False(t, called)
+			assert.Equal(t, http.StatusGatewayTimeout, w.Code)
+			assert.Contains(t, attrs, SourceKey.String(SourceHeader))
+			assert.Contains(t, attrs, ExhaustedHopKey.String(HopRequest))
+			assert.Contains(t, attrs, ExhaustedByKey.String(ExhaustedBudget))
+		})
+	}
+}
+
+func TestHop(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	hop := StartHop(ctx, "viacep", 0.4)
+	defer hop.End()
+	deadline, _ := hop.Context().Deadline()
+	assert.InDelta(t, 400*time.Millisecond, time.Until(deadline), float64(50*time.Millisecond))
+
+	assert.Equal(t, ctx, RequestContext(hop.Context()))
+	nested := StartHop(hop.Context(), "nested", 0.5)
+	defer nested.End()
+	assert.Equal(t, ctx, RequestContext(nested.Context()))
+
+	whole := StartHop(ctx, "weatherapi", 0)
+	defer whole.End()
+	assert.Equal(t, ctx, whole.Context())
+	assert.Equal(t, ctx, RequestContext(whole.Context()))
+}
+
+func TestHop_Exhausted(t *testing.T) {
+	sr := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr))
+	ctx, span := tp.Tracer("test").Start(context.Background(), "POST /temperature")
+	ctx, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+	hop := StartHop(ctx, "viacep", 0.01)
+	defer hop.End()
+
+	<-hop.Context().Done()
+	assert.False(t, hop.Exhausted(errors.New("connection refused")))
+	assert.True(t, hop.Exhausted(tracing.ClassifyUpstream(hop.Context().Err())))
+	span.End()
+
+	attrs := sr.Ended()[0].Attributes()
+	assert.Contains(t, attrs, attribute.String("deadline.exhausted_hop", "viacep"))
+	assert.Contains(t, attrs, attribute.String("deadline.exhausted_by", "share"))
+	keys := map[attribute.Key]bool{}
+	for _, a := range attrs {
+		keys[a.Key] = true
+	}
+	assert.True(t, keys["deadline.hop_budget_ms"])
+	assert.True(t, keys["deadline.remaining_ms"])
+
+	other := StartHop(ctx, "weatherapi", 0)
+	assert.True(t, other.Exhausted(tracing.Classify(tracing.ErrorUpstreamTimeout, errors.New("i/o timeout"))))
+	cancel()
+	assert.True(t, other.Exhausted(context.DeadlineExceeded))
+}
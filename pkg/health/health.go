@@ -0,0 +1,199 @@
+// Package health serves liveness and readiness endpoints reporting the
+// state of each dependency as JSON.
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Routes of the endpoints, ignored by the tracing middleware.
+const (
+	LivenessRoute  = "/healthz"
+	ReadinessRoute = "/readyz"
+)
+
+const (
+	StatusUp   = "up"
+	StatusDown = "down"
+	// StatusDegraded is the readiness status when only non critical checks
+	// fail.
+	StatusDegraded = "degraded"
+)
+
+// DefaultTimeout bounds the readiness checks when no timeout is given.
+const DefaultTimeout = 2 * time.Second
+
+// Check reports whether a dependency can be used.
+type Check func(ctx context.Context) error
+
+// Report is the body of both endpoints.
+type Report struct {
+	Status string                 `json:"status"`
+	Checks map[string]CheckResult `json:"checks,omitempty"`
+}
+
+// CheckResult is the outcome of one check.
+type CheckResult struct {
+	Status    string  `json:"status"`
+	LatencyMS float64 `json:"latency_ms"`
+	Error     string  `json:"error,omitempty"`
+}
+
+// Liveness answers 200 as long as the process serves requests.
+func Liveness() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		write(w, http.StatusOK, Report{Status: StatusUp})
+	})
+}
+
+// Readiness runs its checks concurrently on each request and answers 200
+// when all of its critical checks pass, 503 otherwise.
+type Readiness struct {
+	timeout     time.Duration
+	names       []string
+	checks      map[string]Check
+	nonCritical map[string]bool
+}
+
+// NewReadiness returns a readiness handler whose checks get timeout to
+// finish, DefaultTimeout when zero.
+func NewReadiness(timeout time.Duration) *Readiness {
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	return &Readiness{timeout: timeout, checks: map[string]Check{}, nonCritical: map[string]bool{}}
+}
+
+// Add registers check under name.
+func (rd *Readiness) Add(name string, check Check) *Readiness {
+	if _, ok := rd.checks[name]; !ok {
+		rd.names = append(rd.names, name)
+		sort.Strings(rd.names)
+	}
+	rd.checks[name] = check
+	delete(rd.nonCritical, name)
+	return rd
+}
+
+// AddNonCritical registers check under name, reporting its failures
+// without failing readiness: the status becomes StatusDegraded.
+func (rd *Readiness) AddNonCritical(name string, check Check) *Readiness {
+	rd.Add(name, check)
+	rd.nonCritical[name] = true
+	return rd
+}
+
+// Check runs every check and returns the report.
+func (rd *Readiness) Check(ctx context.Context) Report {
+	ctx, cancel := context.WithTimeout(ctx, rd.timeout)
+	defer cancel()
+	results := make([]CheckResult, len(rd.names))
+	var wg sync.WaitGroup
+	for i, name := range rd.names {
+		wg.Add(1)
+		go func(i int, check Check) {
+			defer wg.Done()
+			results[i] = run(ctx, check)
+		}(i, rd.checks[name])
+	}
+	wg.Wait()
+
+	report := Report{Status: StatusUp, Checks: map[string]CheckResult{}}
+	for i, name := range rd.names {
+		report.Checks[name] = results[i]
+		switch {
+		case results[i].Status == StatusUp:
+		case !rd.nonCritical[name]:
+			report.Status = StatusDown
+		case report.Status == StatusUp:
+			report.Status = StatusDegraded
+		}
+	}
+	return report
+}
+
+func (rd *Readiness) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	report := rd.Check(r.Context())
+	status := http.StatusOK
+	if report.Status == StatusDown {
+		status = http.StatusServiceUnavailable
+	}
+	write(w, status, report)
+}
+
+func run(ctx context.Context, check Check) CheckResult {
+	start := time.Now()
+	errc := make(chan error, 1)
+	go func() {
+		errc <- check(ctx)
+	}()
+	var err error
+	select {
+	case err = <-errc:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	result := CheckResult{Status: StatusUp, LatencyMS: float64(time.Since(start).Microseconds()) / 1000}
+	if err != nil {
+		result.Status, result.Error = StatusDown, err.Error()
+	}
+	return result
+}
+
+func write(w http.ResponseWriter, status int, report Report) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(report)
+}
+
+// Cached runs check at most once per ttl, answering with the last result
+// in between, so probing a rate limited upstream stays cheap.
+func Cached(check Check, ttl time.Duration) Check {
+	var mu sync.Mutex
+	var last error
+	var expires time.Time
+	return func(ctx context.Context) error {
+		mu.Lock()
+		defer mu.Unlock()
+		if time.Now().Before(expires) {
+			return last
+		}
+		last = check(ctx)
+		expires = time.Now().Add(ttl)
+		return last
+	}
+}
+
+// HTTPGet returns a check that GETs target with client and fails on
+// transport errors and 5xx answers. Any other status means the upstream is
+// reachable. Errors leave the URL out.
+func HTTPGet(client *http.Client, target string) Check {
+	return func(ctx context.Context) error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+		if err != nil {
+			return errors.New("invalid probe URL")
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			var urlErr *url.Error
+			if errors.As(err, &urlErr) {
+				return urlErr.Err
+			}
+			return err
+		}
+		resp.Body.Close()
+		if resp.StatusCode >= http.StatusInternalServerError {
+			return fmt.Errorf("unexpected status %d", resp.StatusCode)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,108 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func serve(t *testing.T, h http.Handler) (int, Report) {
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, ReadinessRoute, nil))
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+	var report Report
+	assert.Nil(t, json.NewDecoder(w.Body).Decode(&report))
+	return w.Code, report
+}
+
+func TestLiveness(t *testing.T) {
+	status, report := serve(t, Liveness())
+
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, Report{Status: StatusUp}, report)
+}
+
+func TestReadiness(t *testing.T) {
+	rd := NewReadiness(time.Second).
+		Add("config", func(context.Context) error { return nil }).
+		Add("service-b", func(context.Context) error { return nil })
+
+	status, report := serve(t, rd)
+
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, StatusUp, report.Status)
+	assert.Len(t, report.Checks, 2)
+	assert.Equal(t, StatusUp, report.Checks["service-b"].Status)
+}
+
+func TestReadiness_Down(t *testing.T) {
+	rd := NewReadiness(50*time.Millisecond).
+		Add("config", func(context.Context) error { return nil }).
+		Add("failing", func(context.Context) error { return errors.New("connection refused") }).
+		Add("hanging", func(ctx context.Context) error {
+			time.Sleep(time.Second)
+			return nil
+		})
+
+	start := time.Now()
+	status, report := serve(t, rd)
+
+	assert.Less(t, time.Since(start), time.Second)
+	assert.Equal(t, http.StatusServiceUnavailable, status)
+	assert.Equal(t, StatusDown, report.Status)
+	assert.Equal(t, StatusUp, report.Checks["config"].Status)
+	assert.Equal(t, CheckResult{Status: StatusDown, Error: "connection refused", LatencyMS: report.Checks["failing"].LatencyMS}, report.Checks["failing"])
+	assert.Equal(t, "context deadline exceeded", report.Checks["hanging"].Error)
+	assert.GreaterOrEqual(t, report.Checks["hanging"].LatencyMS, 50.0)
+}
+
+func TestReadiness_Degraded(t *testing.T) {
+	rd := NewReadiness(time.Second).
+		Add("config", func(context.Context) error { return nil }).
+		AddNonCritical("breaker.viacep", func(context.Context) error { return errors.New("circuit breaker open") })
+
+	status, report := serve(t, rd)
+
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, StatusDegraded, report.Status)
+	assert.Equal(t, "circuit breaker open", report.Checks["breaker.viacep"].Error)
+
+	rd.Add("config", func(context.Context) error { return errors.New("invalid") })
+	status, report = serve(t, rd)
+	assert.Equal(t, http.StatusServiceUnavailable, status)
+	assert.Equal(t, StatusDown, report.Status)
+}
+
+func TestCached(t *testing.T) {
+	calls := 0
+	check := Cached(func(context.Context) error {
+		calls++
+		return errors.New("down")
+	}, time.Minute)
+
+	assert.NotNil(t, check(context.TODO()))
+	assert.NotNil(t, check(context.TODO()))
+	assert.Equal(t, 1, calls)
+}
+
+func TestHTTPGet(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/down" {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer upstream.Close()
+
+	assert.Nil(t, HTTPGet(upstream.Client(), upstream.URL+"/missing")(context.TODO()))
+	assert.EqualError(t, HTTPGet(upstream.Client(), upstream.URL+"/down")(context.TODO()), "unexpected status 502")
+	err := HTTPGet(upstream.Client(), "http://127.0.0.1:1/?key=secret")(context.TODO())
+	assert.NotNil(t, err)
+	assert.NotContains(t, err.Error(), "secret")
+}
@@ -0,0 +1,330 @@
+package logging
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+const (
+	FormatJSON = "json"
+	FormatText = "text"
+)
+
+// PackageKey is the attribute naming the package a log record comes from.
+const PackageKey = "package"
+
+// Config controls the logger installed by Setup.
+type Config struct {
+	// Format is json or text.
+	Format string
+	// Level is the minimum level of packages without their own level.
+	Level slog.Level
+	// Levels overrides Level per package.
+	Levels Levels
+	// RedactKeys are attribute keys and URL query parameters whose values
+	// are hidden, on top of the default secret names.
+	RedactKeys []string
+	// SpanEvents records entries at or above SpanEventLevel as events on
+	// the active span.
+	SpanEvents     bool
+	SpanEventLevel slog.Level
+}
+
+// Levels maps a package name to its minimum level. As a flag it is written
+// as a comma separated list of package=level pairs, e.g. "viacep=debug".
+type Levels map[string]slog.Level
+
+func (l Levels) String() string {
+	pairs := make([]string, 0, len(l))
+	for pkg, level := range l {
+		pairs = append(pairs, pkg+"="+strings.ToLower(level.String()))
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+func (l Levels) Set(value string) error {
+	for _, pair := range strings.Split(value, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		pkg, name, ok := strings.Cut(pair, "=")
+		if !ok || strings.TrimSpace(pkg) == "" {
+			return fmt.Errorf("invalid package level %q, expected package=level", pair)
+		}
+		level, err := ParseLevel(name)
+		if err != nil {
+			return err
+		}
+		l[strings.TrimSpace(pkg)] = level
+	}
+	return nil
+}
+
+// ParseLevel parses debug, info, warn or error.
+func ParseLevel(value string) (slog.Level, error) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(strings.TrimSpace(value))); err != nil {
+		return 0, fmt.Errorf("invalid log level %q, expected debug, info, warn or error", value)
+	}
+	return level, nil
+}
+
+// ConfigFromEnv reads LOG_FORMAT, LOG_LEVEL, LOG_LEVELS, LOG_REDACT_KEYS,
+// LOG_SPAN_EVENTS and LOG_SPAN_EVENTS_LEVEL.
+func ConfigFromEnv() (Config, error) {
+	cfg := Config{Format: FormatJSON, Levels: Levels{}, SpanEvents: true, SpanEventLevel: slog.LevelWarn}
+	if v := os.Getenv("LOG_FORMAT"); v != "" {
+		cfg.Format = v
+	}
+	if v := os.Getenv("LOG_LEVEL"); v != "" {
+		level, err := ParseLevel(v)
+		if err != nil {
+			return Config{}, fmt.Errorf("LOG_LEVEL: %w", err)
+		}
+		cfg.Level = level
+	}
+	if err := cfg.Levels.Set(os.Getenv("LOG_LEVELS")); err != nil {
+		return Config{}, fmt.Errorf("LOG_LEVELS: %w", err)
+	}
+	if v := os.Getenv("LOG_SPAN_EVENTS"); v != "" {
+		enabled, err := strconv.ParseBool(v)
+		if err != nil {
+			return Config{}, fmt.Errorf("LOG_SPAN_EVENTS: %w", err)
+		}
+		cfg.SpanEvents = enabled
+	}
+	if v := os.Getenv("LOG_SPAN_EVENTS_LEVEL"); v != "" {
+		level, err := ParseLevel(v)
+		if err != nil {
+			return Config{}, fmt.Errorf("LOG_SPAN_EVENTS_LEVEL: %w", err)
+		}
+		cfg.SpanEventLevel = level
+	}
+	for _, k := range strings.Split(os.Getenv("LOG_REDACT_KEYS"), ",") {
+		if k = strings.TrimSpace(k); k != "" {
+			cfg.RedactKeys = append(cfg.RedactKeys, k)
+		}
+	}
+	return cfg, cfg.Validate()
+}
+
+// RegisterFlags binds the config fields to fs, using the current values as
+// defaults so flags take precedence over the environment.
+func (c *Config) RegisterFlags(fs *flag.FlagSet) {
+	fs.StringVar(&c.Format, "log-format", c.Format, "log format: json or text")
+	fs.TextVar(&c.Level, "log-level", c.Level, "minimum log level: debug, info, warn or error")
+	if c.Levels == nil {
+		c.Levels = Levels{}
+	}
+	fs.Var(c.Levels, "log-levels", "per package log levels as package=level pairs separated by commas")
+	fs.BoolVar(&c.SpanEvents, "log-span-events", c.SpanEvents, "record log entries as events on the active span")
+	fs.TextVar(&c.SpanEventLevel, "log-span-events-level", c.SpanEventLevel, "minimum level of log entries recorded as span events")
+}
+
+// Validate reports a format Setup does not know.
+func (c *Config) Validate() error {
+	switch c.Format {
+	case "", FormatJSON, FormatText:
+		return nil
+	}
+	return fmt.Errorf("logging: unknown format %q", c.Format)
+}
+
+// levels holds the current minimum levels so they can change at runtime.
+type levels struct {
+	mu         sync.RWMutex
+	root       slog.LevelVar
+	spanEvents slog.LevelVar
+	packages   map[string]slog.Level
+}
+
+func (l *levels) of(pkg string) slog.Level {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	if level, ok := l.packages[pkg]; ok {
+		return level
+	}
+	return l.root.Level()
+}
+
+var current = &levels{packages: map[string]slog.Level{}}
+
+// SetLevel changes the minimum level of packages without their own level.
+func SetLevel(level slog.Level) {
+	current.root.Set(level)
+}
+
+// SetLevels replaces the minimum level of packages without their own level
+// and every per package level.
+func SetLevels(level slog.Level, levels Levels) {
+	current.root.Set(level)
+	current.mu.Lock()
+	defer current.mu.Unlock()
+	current.packages = map[string]slog.Level{}
+	for pkg, level := range levels {
+		current.packages[pkg] = level
+	}
+}
+
+// SetPackageLevel changes the minimum level of pkg.
+func SetPackageLevel(pkg string, level slog.Level) {
+	current.mu.Lock()
+	defer current.mu.Unlock()
+	current.packages[pkg] = level
+}
+
+var (
+	mu         sync.Mutex
+	primary    slog.Handler
+	sink       slog.Handler
+	spanEvents bool
+	redact     = newRedactor(nil)
+	root       atomic.Value
+)
+
+// Setup builds the logger described by cfg, writing to w, and installs it
+// as the slog default and as the target of Package loggers.
+func Setup(w io.Writer, cfg Config) (*slog.Logger, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	SetLevels(cfg.Level, cfg.Levels)
+	current.spanEvents.Set(cfg.SpanEventLevel)
+
+	mu.Lock()
+	primary = newFormatHandler(w, cfg)
+	spanEvents = cfg.SpanEvents
+	redact = newRedactor(cfg.RedactKeys)
+	storeRoot()
+	mu.Unlock()
+
+	logger := slog.New(&packageHandler{})
+	slog.SetDefault(logger)
+	return logger, nil
+}
+
+// SetSink sends every record to h too, after redaction, e.g. to the
+// OpenTelemetry logs bridge. A nil h removes the sink.
+func SetSink(h slog.Handler) {
+	mu.Lock()
+	defer mu.Unlock()
+	sink = h
+	storeRoot()
+}
+
+func storeRoot() {
+	var handlers fanout
+	if primary != nil {
+		handlers = append(handlers, primary)
+	}
+	if sink != nil {
+		handlers = append(handlers, sink)
+	}
+	var next slog.Handler = handlers
+	if spanEvents {
+		next = NewSpanEventHandler(handlers, &current.spanEvents)
+	}
+	root.Store(slog.Handler(redactHandler{next: next, redactor: redact}))
+}
+
+// newFormatHandler returns the JSON or text handler described by cfg with
+// trace_id, span_id and request_id added from the context.
+func newFormatHandler(w io.Writer, cfg Config) slog.Handler {
+	opts := &slog.HandlerOptions{Level: &current.root}
+	var h slog.Handler
+	if cfg.Format == FormatText {
+		h = slog.NewTextHandler(w, opts)
+	} else {
+		h = slog.NewJSONHandler(w, opts)
+	}
+	return contextHandler{h}
+}
+
+// fanout hands every record to all of its handlers. Levels are checked by
+// packageHandler before a record gets here.
+type fanout []slog.Handler
+
+func (f fanout) Enabled(context.Context, slog.Level) bool {
+	return true
+}
+
+func (f fanout) Handle(ctx context.Context, r slog.Record) error {
+	var errs []error
+	for _, h := range f {
+		errs = append(errs, h.Handle(ctx, r.Clone()))
+	}
+	return errors.Join(errs...)
+}
+
+func (f fanout) WithAttrs(attrs []slog.Attr) slog.Handler {
+	out := make(fanout, len(f))
+	for i, h := range f {
+		out[i] = h.WithAttrs(attrs)
+	}
+	return out
+}
+
+func (f fanout) WithGroup(name string) slog.Handler {
+	out := make(fanout, len(f))
+	for i, h := range f {
+		out[i] = h.WithGroup(name)
+	}
+	return out
+}
+
+// Package returns a logger for pkg. Its records carry the package attribute
+// and are filtered by the level of pkg. It can be created before Setup and
+// always writes through the handlers installed by the latest Setup and
+// SetSink.
+func Package(pkg string) *slog.Logger {
+	return slog.New(&packageHandler{pkg: pkg})
+}
+
+type packageHandler struct {
+	pkg  string
+	with []func(slog.Handler) slog.Handler
+}
+
+func (h *packageHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= current.of(h.pkg)
+}
+
+func (h *packageHandler) Handle(ctx context.Context, r slog.Record) error {
+	target, _ := root.Load().(slog.Handler)
+	if target == nil {
+		target = slog.Default().Handler()
+	}
+	if h.pkg != "" {
+		target = target.WithAttrs([]slog.Attr{slog.String(PackageKey, h.pkg)})
+	}
+	for _, with := range h.with {
+		target = with(target)
+	}
+	return target.Handle(ctx, r)
+}
+
+func (h *packageHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return h.chain(func(next slog.Handler) slog.Handler { return next.WithAttrs(attrs) })
+}
+
+func (h *packageHandler) WithGroup(name string) slog.Handler {
+	return h.chain(func(next slog.Handler) slog.Handler { return next.WithGroup(name) })
+}
+
+func (h *packageHandler) chain(with func(slog.Handler) slog.Handler) slog.Handler {
+	c := &packageHandler{pkg: h.pkg, with: make([]func(slog.Handler) slog.Handler, len(h.with), len(h.with)+1)}
+	copy(c.with, h.with)
+	c.with = append(c.with, with)
+	return c
+}
@@ -0,0 +1,169 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/stretchr/testify/assert"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// records decodes the JSON lines written to buf.
+func records(t *testing.T, buf *bytes.Buffer) []map[string]any {
+	var out []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		var m map[string]any
+		assert.Nil(t, json.Unmarshal([]byte(line), &m))
+		out = append(out, m)
+	}
+	return out
+}
+
+func TestConfigFromEnv(t *testing.T) {
+	t.Setenv("LOG_FORMAT", FormatText)
+	t.Setenv("LOG_LEVEL", "warn")
+	t.Setenv("LOG_LEVELS", "viacep=debug, weather=error")
+	t.Setenv("LOG_REDACT_KEYS", "x-tenant-secret")
+
+	cfg, err := ConfigFromEnv()
+
+	assert.Nil(t, err)
+	assert.Equal(t, Config{
+		Format:         FormatText,
+		Level:          slog.LevelWarn,
+		Levels:         Levels{"viacep": slog.LevelDebug, "weather": slog.LevelError},
+		RedactKeys:     []string{"x-tenant-secret"},
+		SpanEvents:     true,
+		SpanEventLevel: slog.LevelWarn,
+	}, cfg)
+}
+
+func TestConfigFromEnv_Invalid(t *testing.T) {
+	t.Setenv("LOG_LEVELS", "viacep=loud")
+
+	_, err := ConfigFromEnv()
+
+	assert.EqualError(t, err, `LOG_LEVELS: invalid log level "loud", expected debug, info, warn or error`)
+}
+
+func TestRegisterFlags(t *testing.T) {
+	cfg := Config{Format: FormatJSON}
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	cfg.RegisterFlags(fs)
+
+	err := fs.Parse([]string{"-log-format", "text", "-log-level", "debug", "-log-levels", "handlers=warn"})
+
+	assert.Nil(t, err)
+	assert.Equal(t, FormatText, cfg.Format)
+	assert.Equal(t, slog.LevelDebug, cfg.Level)
+	assert.Equal(t, Levels{"handlers": slog.LevelWarn}, cfg.Levels)
+}
+
+func TestSetup_TraceAndRequestID(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := Setup(&buf, Config{Format: FormatJSON})
+	assert.Nil(t, err)
+
+	ctx, span := sdktrace.NewTracerProvider().Tracer("test").Start(context.TODO(), "test")
+	defer span.End()
+	ctx = context.WithValue(ctx, middleware.RequestIDKey, "host/abc-000001")
+	logger.InfoContext(ctx, "starting request")
+
+	rec := records(t, &buf)[0]
+	assert.Equal(t, "starting request", rec["msg"])
+	assert.Equal(t, span.SpanContext().TraceID().String(), rec[TraceIDKey])
+	assert.Equal(t, span.SpanContext().SpanID().String(), rec[SpanIDKey])
+	assert.Equal(t, "host/abc-000001", rec[RequestIDKey])
+}
+
+func TestPackage_Levels(t *testing.T) {
+	viacep := Package("viacep")
+	weather := Package("weather").With("provider", "weatherapi")
+
+	var buf bytes.Buffer
+	_, err := Setup(&buf, Config{Format: FormatJSON, Level: slog.LevelInfo, Levels: Levels{"viacep": slog.LevelDebug}})
+	assert.Nil(t, err)
+
+	viacep.Debug("resolving city")
+	weather.Debug("fetching weather")
+	weather.Info("weather fetched")
+
+	recs := records(t, &buf)
+	assert.Len(t, recs, 2)
+	assert.Equal(t, "viacep", recs[0][PackageKey])
+	assert.Equal(t, "weather fetched", recs[1]["msg"])
+	assert.Equal(t, "weatherapi", recs[1]["provider"])
+
+	SetPackageLevel("weather", slog.LevelDebug)
+	weather.Debug("fetching weather")
+	assert.Len(t, records(t, &buf), 3)
+}
+
+func TestSetLevels(t *testing.T) {
+	viacep := Package("viacep")
+	var buf bytes.Buffer
+	_, err := Setup(&buf, Config{Format: FormatJSON, Level: slog.LevelInfo, Levels: Levels{"viacep": slog.LevelDebug}})
+	assert.Nil(t, err)
+
+	SetLevels(slog.LevelWarn, nil)
+	viacep.Debug("resolving city")
+	viacep.Info("city resolved")
+	viacep.Warn("city not found")
+
+	recs := records(t, &buf)
+	assert.Len(t, recs, 1)
+	assert.Equal(t, "city not found", recs[0]["msg"])
+}
+
+func TestSetup_Text(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := Setup(&buf, Config{Format: FormatText})
+	assert.Nil(t, err)
+
+	logger.Info("starting request", "zipcode", "06835100")
+
+	assert.Contains(t, buf.String(), `msg="starting request"`)
+}
+
+func TestMiddleware(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := Setup(&buf, Config{Format: FormatJSON})
+	assert.Nil(t, err)
+	handler := Middleware(logger)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/temperature", nil))
+
+	rec := records(t, &buf)[0]
+	assert.Equal(t, "ERROR", rec["level"])
+	assert.Equal(t, float64(http.StatusBadGateway), rec["status"])
+	assert.Equal(t, "/temperature", rec["path"])
+}
+
+func TestSetSink(t *testing.T) {
+	var buf, sinkBuf bytes.Buffer
+	logger, err := Setup(&buf, Config{Format: FormatJSON})
+	assert.Nil(t, err)
+	SetSink(slog.NewJSONHandler(&sinkBuf, nil))
+	defer SetSink(nil)
+
+	logger.Info("weather fetched", "token", "secret")
+	Package("weather").Info("weather fetched")
+
+	assert.Len(t, records(t, &buf), 2)
+	recs := records(t, &sinkBuf)
+	assert.Len(t, recs, 2)
+	assert.Equal(t, "REDACTED", recs[0]["token"])
+	assert.Equal(t, "weather", recs[1][PackageKey])
+}
@@ -0,0 +1,123 @@
+package logging
+
+import (
+	"context"
+	"log/slog"
+	"net/url"
+	"regexp"
+	"strings"
+	"willianszwy/FC-Tracing/pkg/tracing"
+)
+
+const redacted = "REDACTED"
+
+// defaultRedactKeys are attribute keys whose values are never logged.
+var defaultRedactKeys = []string{"authorization", "cookie", "set-cookie", "x-api-key"}
+
+// urlPattern finds URLs inside free text such as error messages.
+var urlPattern = regexp.MustCompile(`https?://[^\s"'<>]+`)
+
+type redactor struct {
+	keys  map[string]bool
+	extra []string
+}
+
+func newRedactor(extra []string) redactor {
+	r := redactor{keys: map[string]bool{}, extra: extra}
+	for _, k := range tracing.DefaultRedactedParams {
+		r.keys[k] = true
+	}
+	for _, k := range defaultRedactKeys {
+		r.keys[k] = true
+	}
+	for _, k := range extra {
+		r.keys[strings.ToLower(k)] = true
+	}
+	return r
+}
+
+// redactHandler applies the redactor to the message and attributes of every
+// record before handing it to next.
+type redactHandler struct {
+	next     slog.Handler
+	redactor redactor
+}
+
+func (h redactHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.next.Enabled(ctx, level)
+}
+
+func (h redactHandler) Handle(ctx context.Context, r slog.Record) error {
+	out := slog.NewRecord(r.Time, r.Level, h.redactor.redactText(r.Message), r.PC)
+	r.Attrs(func(a slog.Attr) bool {
+		if a = h.redactor.replace(a); a.Key != "" {
+			out.AddAttrs(a)
+		}
+		return true
+	})
+	return h.next.Handle(ctx, out)
+}
+
+func (h redactHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return redactHandler{next: h.next.WithAttrs(h.redactor.replaceAll(attrs)), redactor: h.redactor}
+}
+
+func (h redactHandler) WithGroup(name string) slog.Handler {
+	return redactHandler{next: h.next.WithGroup(name), redactor: h.redactor}
+}
+
+func (r redactor) replaceAll(attrs []slog.Attr) []slog.Attr {
+	out := make([]slog.Attr, 0, len(attrs))
+	for _, a := range attrs {
+		if a = r.replace(a); a.Key != "" {
+			out = append(out, a)
+		}
+	}
+	return out
+}
+
+// replace hides secrets, applies the PII mode to zipcodes and redacts query
+// parameters of URLs found in values. It returns an empty attribute when
+// the value must be dropped.
+func (r redactor) replace(a slog.Attr) slog.Attr {
+	key := strings.ToLower(a.Key)
+	if r.keys[key] {
+		return slog.String(a.Key, redacted)
+	}
+	if key == string(tracing.ZipcodeKey) {
+		v, ok := tracing.PIIValue(a.Value.String())
+		if !ok {
+			return slog.Attr{}
+		}
+		return slog.String(a.Key, v)
+	}
+	switch a.Value.Kind() {
+	case slog.KindGroup:
+		return slog.Attr{Key: a.Key, Value: slog.GroupValue(r.replaceAll(a.Value.Group())...)}
+	case slog.KindLogValuer:
+		return r.replace(slog.Attr{Key: a.Key, Value: a.Value.Resolve()})
+	case slog.KindString:
+		return slog.String(a.Key, r.redactText(a.Value.String()))
+	case slog.KindAny:
+		switch v := a.Value.Any().(type) {
+		case *url.URL:
+			return slog.String(a.Key, tracing.RedactURL(v, r.extra...))
+		case error:
+			return slog.String(a.Key, r.redactText(v.Error()))
+		}
+	}
+	return a
+}
+
+func (r redactor) redactText(s string) string {
+	if !strings.Contains(s, "://") {
+		return s
+	}
+	return urlPattern.ReplaceAllStringFunc(s, func(raw string) string {
+		u, err := url.Parse(raw)
+		if err != nil {
+			return raw
+		}
+		return tracing.RedactURL(u, r.extra...)
+	})
+}
@@ -0,0 +1,47 @@
+package logging
+
+import (
+	"bytes"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"net/url"
+	"testing"
+	"willianszwy/FC-Tracing/pkg/tracing"
+)
+
+func TestRedact(t *testing.T) {
+	tracing.SetPIIMode(tracing.PIIMask)
+	var buf bytes.Buffer
+	logger, err := Setup(&buf, Config{Format: FormatJSON, RedactKeys: []string{"q"}})
+	assert.Nil(t, err)
+	u, _ := url.Parse("https://api.weatherapi.com/v1/current.json?key=secret&q=city")
+
+	logger.Info("calling https://api.weatherapi.com/v1/current.json?key=secret",
+		"api_key", "secret",
+		"Authorization", "Bearer secret",
+		"url", u,
+		"error", errors.New(`Get "https://api.weatherapi.com/v1/current.json?key=secret&q=city": dial tcp: i/o timeout`),
+		"zipcode", "06835100",
+	)
+
+	rec := records(t, &buf)[0]
+	assert.NotContains(t, buf.String(), "secret")
+	assert.Equal(t, "calling https://api.weatherapi.com/v1/current.json?key=REDACTED", rec["msg"])
+	assert.Equal(t, "REDACTED", rec["api_key"])
+	assert.Equal(t, "REDACTED", rec["Authorization"])
+	assert.Equal(t, "https://api.weatherapi.com/v1/current.json?key=REDACTED&q=REDACTED", rec["url"])
+	assert.Equal(t, `Get "https://api.weatherapi.com/v1/current.json?key=REDACTED&q=REDACTED": dial tcp: i/o timeout`, rec["error"])
+	assert.Equal(t, "0683****", rec["zipcode"])
+}
+
+func TestRedact_DropZipcode(t *testing.T) {
+	tracing.SetPIIMode(tracing.PIIDrop)
+	defer tracing.SetPIIMode(tracing.PIIMask)
+	var buf bytes.Buffer
+	logger, err := Setup(&buf, Config{Format: FormatJSON})
+	assert.Nil(t, err)
+
+	logger.Info("starting request", "zipcode", "06835100")
+
+	assert.NotContains(t, records(t, &buf)[0], "zipcode")
+}
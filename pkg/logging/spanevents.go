@@ -0,0 +1,116 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"log/slog"
+	"time"
+)
+
+// SeverityKey is the span event attribute holding the level of the record.
+const SeverityKey = attribute.Key("log.severity")
+
+// SpanEventHandler records every log entry at or above level as an event
+// on the span found in the context of the record, then hands the record to
+// next. The event is named after the message and carries the record
+// attributes.
+type SpanEventHandler struct {
+	next   slog.Handler
+	level  slog.Leveler
+	attrs  []attribute.KeyValue
+	prefix string
+}
+
+// NewSpanEventHandler wraps next. A nil next only records span events.
+func NewSpanEventHandler(next slog.Handler, level slog.Leveler) *SpanEventHandler {
+	return &SpanEventHandler{next: next, level: level}
+}
+
+func (h *SpanEventHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	if h.next == nil {
+		return level >= h.level.Level()
+	}
+	return h.next.Enabled(ctx, level) || level >= h.level.Level()
+}
+
+func (h *SpanEventHandler) Handle(ctx context.Context, r slog.Record) error {
+	if r.Level >= h.level.Level() && ctx != nil {
+		if span := trace.SpanFromContext(ctx); span.IsRecording() {
+			attrs := make([]attribute.KeyValue, 0, len(h.attrs)+r.NumAttrs()+1)
+			attrs = append(attrs, SeverityKey.String(r.Level.String()))
+			attrs = append(attrs, h.attrs...)
+			r.Attrs(func(a slog.Attr) bool {
+				attrs = appendAttr(attrs, h.prefix, a)
+				return true
+			})
+			span.AddEvent(r.Message, trace.WithTimestamp(r.Time), trace.WithAttributes(attrs...))
+		}
+	}
+	if h.next == nil {
+		return nil
+	}
+	return h.next.Handle(ctx, r)
+}
+
+func (h *SpanEventHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	c := h.clone()
+	for _, a := range attrs {
+		c.attrs = appendAttr(c.attrs, h.prefix, a)
+	}
+	if h.next != nil {
+		c.next = h.next.WithAttrs(attrs)
+	}
+	return c
+}
+
+func (h *SpanEventHandler) WithGroup(name string) slog.Handler {
+	c := h.clone()
+	c.prefix = h.prefix + name + "."
+	if h.next != nil {
+		c.next = h.next.WithGroup(name)
+	}
+	return c
+}
+
+func (h *SpanEventHandler) clone() *SpanEventHandler {
+	c := *h
+	c.attrs = append([]attribute.KeyValue(nil), h.attrs...)
+	return &c
+}
+
+// appendAttr converts a, flattening groups into dotted keys.
+func appendAttr(attrs []attribute.KeyValue, prefix string, a slog.Attr) []attribute.KeyValue {
+	v := a.Value.Resolve()
+	key := prefix + a.Key
+	switch v.Kind() {
+	case slog.KindGroup:
+		if a.Key != "" {
+			prefix = key + "."
+		}
+		for _, ga := range v.Group() {
+			attrs = appendAttr(attrs, prefix, ga)
+		}
+		return attrs
+	case slog.KindString:
+		return append(attrs, attribute.String(key, v.String()))
+	case slog.KindInt64:
+		return append(attrs, attribute.Int64(key, v.Int64()))
+	case slog.KindUint64:
+		return append(attrs, attribute.Int64(key, int64(v.Uint64())))
+	case slog.KindFloat64:
+		return append(attrs, attribute.Float64(key, v.Float64()))
+	case slog.KindBool:
+		return append(attrs, attribute.Bool(key, v.Bool()))
+	case slog.KindDuration:
+		return append(attrs, attribute.String(key, v.Duration().String()))
+	case slog.KindTime:
+		return append(attrs, attribute.String(key, v.Time().Format(time.RFC3339Nano)))
+	default:
+		if a.Key == "" {
+			return attrs
+		}
+		return append(attrs, attribute.String(key, fmt.Sprint(v.Any())))
+	}
+}
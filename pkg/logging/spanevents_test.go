@@ -0,0 +1,52 @@
+package logging
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"io"
+	"log/slog"
+	"testing"
+)
+
+func TestSpanEventHandler(t *testing.T) {
+	sr := tracetest.NewSpanRecorder()
+	ctx, span := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr)).Tracer("test").Start(context.TODO(), "Viacep")
+	logger := slog.New(NewSpanEventHandler(nil, slog.LevelWarn)).With("package", "viacep").WithGroup("upstream")
+
+	logger.InfoContext(ctx, "calling viacep")
+	logger.WarnContext(ctx, "error city notfound", "status", 200, slog.Group("city", "state", "SP"))
+	logger.Warn("no span in context")
+	span.End()
+
+	events := sr.Ended()[0].Events()
+	assert.Len(t, events, 1)
+	assert.Equal(t, "error city notfound", events[0].Name)
+	assert.Equal(t, []attribute.KeyValue{
+		SeverityKey.String("WARN"),
+		attribute.String("package", "viacep"),
+		attribute.Int64("upstream.status", 200),
+		attribute.String("upstream.city.state", "SP"),
+	}, events[0].Attributes)
+}
+
+func TestSetup_SpanEvents(t *testing.T) {
+	sr := tracetest.NewSpanRecorder()
+	ctx, span := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr)).Tracer("test").Start(context.TODO(), "WeatherAPI")
+	_, err := Setup(io.Discard, Config{Format: FormatJSON, SpanEvents: true, SpanEventLevel: slog.LevelError})
+	assert.Nil(t, err)
+
+	Package("weather").WarnContext(ctx, "slow upstream")
+	Package("weather").ErrorContext(ctx, "can not fetch weather", "api_key", "secret", "error", errors.New("timeout"))
+	span.End()
+
+	events := sr.Ended()[0].Events()
+	assert.Len(t, events, 1)
+	assert.Equal(t, "can not fetch weather", events[0].Name)
+	assert.Contains(t, events[0].Attributes, attribute.String("package", "weather"))
+	assert.Contains(t, events[0].Attributes, attribute.String("api_key", "REDACTED"))
+	assert.Contains(t, events[0].Attributes, attribute.String("error", "timeout"))
+}
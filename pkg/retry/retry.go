@@ -0,0 +1,283 @@
+// Package retry resends failed upstream HTTP calls with exponential backoff
+// and jitter, recording each attempt as a span.
+package retry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+	"io"
+	"math"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+	"willianszwy/FC-Tracing/pkg/logging"
+	"willianszwy/FC-Tracing/pkg/tracing"
+)
+
+const instrumentationName = "willianszwy/FC-Tracing/pkg/retry"
+
+// IdempotencyKeyHeader marks a request with a non idempotent method as safe
+// to resend.
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// Span attributes of an attempt.
+const (
+	AttemptKey     = attribute.Key("retry.attempt")
+	MaxAttemptsKey = attribute.Key("retry.max_attempts")
+	BackoffKey     = attribute.Key("retry.backoff_ms")
+)
+
+// DefaultStatuses are the response statuses retried when Policy.Statuses is
+// empty.
+var DefaultStatuses = []int{
+	http.StatusTooManyRequests,
+	http.StatusBadGateway,
+	http.StatusServiceUnavailable,
+	http.StatusGatewayTimeout,
+}
+
+var logger = logging.Package("retry")
+
+// Policy decides how often and when a failed call is resent.
+type Policy struct {
+	// MaxAttempts counts the first call, 1 disables retries.
+	MaxAttempts int
+	// InitialBackoff is the wait before the first retry, doubled for each
+	// following one up to MaxBackoff.
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	// Jitter is the fraction, from 0 to 1, of each wait that is randomized.
+	Jitter float64
+	// Statuses are the retried response statuses, DefaultStatuses when empty.
+	Statuses []int
+	// AttemptTimeout bounds each attempt, zero means only the request
+	// context bounds it.
+	AttemptTimeout time.Duration
+}
+
+// DefaultPolicy makes 3 attempts waiting about 100ms then 200ms.
+func DefaultPolicy() Policy {
+	return Policy{MaxAttempts: 3, InitialBackoff: 100 * time.Millisecond, MaxBackoff: time.Second, Jitter: 0.2}
+}
+
+// Backoff is the wait before the retry following attempt, starting at 1.
+func (p Policy) Backoff(attempt int) time.Duration {
+	backoff := float64(p.InitialBackoff) * math.Pow(2, float64(attempt-1))
+	if p.MaxBackoff > 0 && backoff > float64(p.MaxBackoff) {
+		backoff = float64(p.MaxBackoff)
+	}
+	jitter := math.Min(math.Max(p.Jitter, 0), 1)
+	return time.Duration(backoff * (1 - jitter*rand.Float64()))
+}
+
+func (p Policy) retryableStatus(status int) bool {
+	statuses := p.Statuses
+	if len(statuses) == 0 {
+		statuses = DefaultStatuses
+	}
+	for _, s := range statuses {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
+
+// HTTPClient sends a request, as http.Client does.
+type HTTPClient interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
+// Client resends the requests of a wrapped HTTPClient following a Policy.
+type Client struct {
+	client HTTPClient
+	policy Policy
+	tracer trace.Tracer
+}
+
+// Option customizes a Client.
+type Option func(*Client)
+
+// WithTracerProvider uses tp instead of the global tracer provider.
+func WithTracerProvider(tp trace.TracerProvider) Option {
+	return func(c *Client) {
+		c.tracer = tp.Tracer(instrumentationName)
+	}
+}
+
+// NewClient wraps client with policy.
+func NewClient(client HTTPClient, policy Policy, opts ...Option) *Client {
+	if policy.MaxAttempts < 1 {
+		policy.MaxAttempts = 1
+	}
+	c := &Client{client: client, policy: policy, tracer: otel.GetTracerProvider().Tracer(instrumentationName)}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// Do sends req, resending it while the failure is retryable, attempts are
+// left and the wait fits before the context deadline. Only idempotent
+// methods, or requests carrying IdempotencyKeyHeader, with a replayable body
+// are resent. The last response or error is returned.
+func (c *Client) Do(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	maxAttempts := c.policy.MaxAttempts
+	if !resendable(req) {
+		maxAttempts = 1
+	}
+	for attempt := 1; ; attempt++ {
+		r, err := c.prepare(req, attempt)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := c.attempt(r, attempt, maxAttempts)
+		if attempt >= maxAttempts || !c.retryable(ctx, resp, err) {
+			return resp, err
+		}
+
+		wait := c.policy.Backoff(attempt)
+		if after, ok := retryAfter(resp); ok && after > wait {
+			wait = min(after, max(c.policy.MaxBackoff, wait))
+		}
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) <= wait {
+			logger.DebugContext(ctx, "not retrying, the wait exceeds the deadline", "attempt", attempt, "backoff", wait)
+			return resp, err
+		}
+		logger.DebugContext(ctx, "retrying request", "attempt", attempt, "backoff", wait, "error", err)
+		trace.SpanFromContext(ctx).AddEvent("retry", trace.WithAttributes(
+			AttemptKey.Int(attempt+1),
+			BackoffKey.Int64(wait.Milliseconds()),
+		))
+		if resp != nil {
+			io.Copy(io.Discard, io.LimitReader(resp.Body, 4<<10))
+			resp.Body.Close()
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// prepare clones req for attempt, rewinding its body.
+func (c *Client) prepare(req *http.Request, attempt int) (*http.Request, error) {
+	if attempt == 1 {
+		return req, nil
+	}
+	r := req.Clone(req.Context())
+	if req.Body != nil && req.Body != http.NoBody {
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, fmt.Errorf("retry: rewinding the request body: %w", err)
+		}
+		r.Body = body
+	}
+	return r, nil
+}
+
+// attempt sends r under a span numbered attempt, bounded by the attempt
+// timeout until its response body is closed.
+func (c *Client) attempt(r *http.Request, attempt, maxAttempts int) (*http.Response, error) {
+	ctx, span := c.tracer.Start(r.Context(), "attempt "+strconv.Itoa(attempt), trace.WithAttributes(
+		AttemptKey.Int(attempt),
+		MaxAttemptsKey.Int(maxAttempts),
+		semconv.HTTPRequestResendCount(attempt-1),
+	))
+	defer span.End()
+	cancel := context.CancelFunc(func() {})
+	if c.policy.AttemptTimeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, c.policy.AttemptTimeout)
+	}
+
+	resp, err := c.client.Do(r.WithContext(ctx))
+	if err != nil {
+		cancel()
+		redact(err, r.URL)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+	span.SetAttributes(semconv.HTTPResponseStatusCode(resp.StatusCode))
+	if c.policy.retryableStatus(resp.StatusCode) {
+		span.SetStatus(codes.Error, http.StatusText(resp.StatusCode))
+	}
+	resp.Body = &cancelBody{ReadCloser: resp.Body, cancel: cancel}
+	return resp, nil
+}
+
+// redact replaces the URL of err, which may carry credentials such as an
+// API key, by its redacted form before err is recorded or logged.
+func redact(err error, fallback *url.URL) {
+	var urlErr *url.Error
+	if !errors.As(err, &urlErr) {
+		return
+	}
+	u, perr := url.Parse(urlErr.URL)
+	if perr != nil {
+		u = fallback
+	}
+	urlErr.URL = tracing.RedactURL(u)
+}
+
+// retryable reports whether the outcome of an attempt is worth resending,
+// which a done request context never is.
+func (c *Client) retryable(ctx context.Context, resp *http.Response, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	if err != nil {
+		return !errors.Is(err, context.Canceled)
+	}
+	return c.policy.retryableStatus(resp.StatusCode)
+}
+
+// resendable reports whether req may be sent more than once.
+func resendable(req *http.Request) bool {
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		return false
+	}
+	switch req.Method {
+	case "", http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return req.Header.Get(IdempotencyKeyHeader) != ""
+}
+
+// retryAfter reads the Retry-After header of resp given in seconds.
+func retryAfter(resp *http.Response) (time.Duration, bool) {
+	if resp == nil {
+		return 0, false
+	}
+	seconds, err := strconv.Atoi(resp.Header.Get("Retry-After"))
+	if err != nil || seconds < 0 {
+		return 0, false
+	}
+	return time.Duration(seconds) * time.Second, true
+}
+
+// cancelBody releases the attempt context once the body is closed.
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+	once   sync.Once
+}
+
+func (b *cancelBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(b.cancel)
+	return err
+}
@@ -0,0 +1,223 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// ClientMock answers each call with the next of Results.
+type ClientMock struct {
+	Results []result
+	Bodies  []string
+	Calls   int
+}
+
+type result struct {
+	status int
+	err    error
+}
+
+func (c *ClientMock) Do(req *http.Request) (*http.Response, error) {
+	r := c.Results[min(c.Calls, len(c.Results)-1)]
+	c.Calls++
+	if req.Body != nil {
+		body, _ := io.ReadAll(req.Body)
+		c.Bodies = append(c.Bodies, string(body))
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+	return &http.Response{StatusCode: r.status, Header: http.Header{}, Body: io.NopCloser(strings.NewReader("body"))}, nil
+}
+
+func newClient(mock *ClientMock, policy Policy) (*Client, *tracetest.SpanRecorder) {
+	sr := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr))
+	return NewClient(mock, policy, WithTracerProvider(tp)), sr
+}
+
+var fast = Policy{MaxAttempts: 3, InitialBackoff: time.Millisecond, MaxBackoff: 5 * time.Millisecond}
+
+func TestDo_RetriesUntilSuccess(t *testing.T) {
+	mock := &ClientMock{Results: []result{{err: errors.New("connection refused")}, {status: 503}, {status: 200}}}
+	client, sr := newClient(mock, fast)
+	req, _ := http.NewRequest(http.MethodGet, "http://viacep/ws/01001000/json", nil)
+
+	resp, err := client.Do(req)
+
+	assert.Nil(t, err)
+	assert.Equal(t, 200, resp.StatusCode)
+	assert.Equal(t, 3, mock.Calls)
+	spans := sr.Ended()
+	assert.Len(t, spans, 3)
+	for i, span := range spans {
+		assert.Equal(t, fmt.Sprintf("attempt %d", i+1), span.Name())
+		assert.Contains(t, span.Attributes(), attribute.Int("retry.attempt", i+1))
+		assert.Contains(t, span.Attributes(), attribute.Int("http.request.resend_count", i))
+	}
+	assert.Equal(t, codes.Error, spans[0].Status().Code)
+	assert.Equal(t, codes.Error, spans[1].Status().Code)
+	assert.Equal(t, codes.Unset, spans[2].Status().Code)
+}
+
+func TestDo_ReturnsLastResult(t *testing.T) {
+	mock := &ClientMock{Results: []result{{status: 502}}}
+	client, _ := newClient(mock, fast)
+	req, _ := http.NewRequest(http.MethodGet, "http://viacep/ws/01001000/json", nil)
+
+	resp, err := client.Do(req)
+
+	assert.Nil(t, err)
+	assert.Equal(t, 502, resp.StatusCode)
+	assert.Equal(t, 3, mock.Calls)
+	body, _ := io.ReadAll(resp.Body)
+	assert.Equal(t, "body", string(body))
+}
+
+func TestDo_DoesNotRetry(t *testing.T) {
+	post := func(key string) *http.Request {
+		req, _ := http.NewRequest(http.MethodPost, "http://service-b/temperature", strings.NewReader(`{"zipcode":"01001000"}`))
+		if key != "" {
+			req.Header.Set(IdempotencyKeyHeader, key)
+		}
+		return req
+	}
+	get, _ := http.NewRequest(http.MethodGet, "http://viacep/ws/01001000/json", nil)
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	tests := []struct {
+		name    string
+		req     *http.Request
+		results []result
+	}{
+		{"non retryable status", get, []result{{status: 404}, {status: 200}}},
+		{"non idempotent", post(""), []result{{status: 503}, {status: 200}}},
+		{"canceled", get.WithContext(canceled), []result{{err: context.Canceled}, {status: 200}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := &ClientMock{Results: tt.results}
+			client, _ := newClient(mock, fast)
+
+			client.Do(tt.req)
+
+			assert.Equal(t, 1, mock.Calls)
+		})
+	}
+
+	mock := &ClientMock{Results: []result{{status: 503}, {status: 200}}}
+	client, _ := newClient(mock, fast)
+	resp, err := client.Do(post("req-1"))
+	assert.Nil(t, err)
+	assert.Equal(t, 200, resp.StatusCode)
+	assert.Equal(t, []string{`{"zipcode":"01001000"}`, `{"zipcode":"01001000"}`}, mock.Bodies)
+}
+
+func TestDo_RespectsDeadline(t *testing.T) {
+	mock := &ClientMock{Results: []result{{status: 503}, {status: 200}}}
+	client, _ := newClient(mock, Policy{MaxAttempts: 3, InitialBackoff: time.Second, MaxBackoff: time.Second})
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, "http://viacep/ws/01001000/json", nil)
+
+	start := time.Now()
+	resp, err := client.Do(req)
+
+	assert.Nil(t, err)
+	assert.Equal(t, 503, resp.StatusCode)
+	assert.Equal(t, 1, mock.Calls)
+	assert.Less(t, time.Since(start), 100*time.Millisecond)
+}
+
+func TestDo_AttemptTimeout(t *testing.T) {
+	var deadlines []bool
+	mock := HTTPClientFunc(func(req *http.Request) (*http.Response, error) {
+		_, ok := req.Context().Deadline()
+		deadlines = append(deadlines, ok)
+		if len(deadlines) == 1 {
+			return nil, context.DeadlineExceeded
+		}
+		return &http.Response{StatusCode: 200, Body: http.NoBody}, nil
+	})
+	policy := fast
+	policy.AttemptTimeout = time.Second
+	req, _ := http.NewRequest(http.MethodGet, "http://viacep/ws/01001000/json", nil)
+
+	resp, err := NewClient(mock, policy).Do(req)
+
+	assert.Nil(t, err)
+	assert.Equal(t, 200, resp.StatusCode)
+	assert.Equal(t, []bool{true, true}, deadlines)
+}
+
+type HTTPClientFunc func(req *http.Request) (*http.Response, error)
+
+func (f HTTPClientFunc) Do(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestPolicy_Backoff(t *testing.T) {
+	p := Policy{InitialBackoff: 100 * time.Millisecond, MaxBackoff: 300 * time.Millisecond}
+
+	assert.Equal(t, 100*time.Millisecond, p.Backoff(1))
+	assert.Equal(t, 200*time.Millisecond, p.Backoff(2))
+	assert.Equal(t, 300*time.Millisecond, p.Backoff(3))
+
+	p.Jitter = 0.5
+	for i := 0; i < 20; i++ {
+		b := p.Backoff(2)
+		assert.GreaterOrEqual(t, b, 100*time.Millisecond)
+		assert.LessOrEqual(t, b, 200*time.Millisecond)
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	resp := &http.Response{Header: http.Header{"Retry-After": []string{"2"}}}
+
+	after, ok := retryAfter(resp)
+
+	assert.True(t, ok)
+	assert.Equal(t, 2*time.Second, after)
+	_, ok = retryAfter(&http.Response{Header: http.Header{}})
+	assert.False(t, ok)
+}
+
+func TestDo_RedactsURLErrors(t *testing.T) {
+	const secret = "s3cr3t-key"
+	mock := &ClientMock{Results: []result{{err: &url.Error{
+		Op:  "Get",
+		URL: "https://api.weatherapi.com/v1/current.json?key=" + secret + "&q=Cidade",
+		Err: errors.New("dial tcp 127.0.0.1:1: connect: connection refused"),
+	}}}}
+	client, sr := newClient(mock, fast)
+	req, _ := http.NewRequest(http.MethodGet, "https://api.weatherapi.com/v1/current.json?key="+secret+"&q=Cidade", nil)
+
+	_, err := client.Do(req)
+
+	assert.NotContains(t, err.Error(), secret)
+	assert.Contains(t, err.Error(), "key=REDACTED")
+	assert.Len(t, sr.Ended(), fast.MaxAttempts)
+	for _, span := range sr.Ended() {
+		assert.NotContains(t, span.Status().Description, secret)
+		for _, attr := range span.Attributes() {
+			assert.NotContains(t, attr.Value.Emit(), secret)
+		}
+		for _, event := range span.Events() {
+			for _, attr := range event.Attributes {
+				assert.NotContains(t, attr.Value.Emit(), secret)
+			}
+		}
+	}
+}
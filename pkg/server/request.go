@@ -0,0 +1,71 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+)
+
+// DefaultMaxBodyBytes bounds request bodies when no limit is configured.
+const DefaultMaxBodyBytes = 4 << 10
+
+// RequestError is a request the client has to fix, answered with Status.
+type RequestError struct {
+	Status int
+	Err    error
+}
+
+func (e *RequestError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *RequestError) Unwrap() error {
+	return e.Err
+}
+
+// StatusOf returns the status of a RequestError in err's chain, or 400.
+func StatusOf(err error) int {
+	var reqErr *RequestError
+	if errors.As(err, &reqErr) {
+		return reqErr.Status
+	}
+	return http.StatusBadRequest
+}
+
+// DecodeJSON decodes the body of r, a single JSON object of at most
+// maxBytes, into v. A request without a Content-Type is taken as JSON. The
+// error is a *RequestError answering 415 for another content type, 413 for
+// a larger body and 400 for unknown fields, trailing data or bad JSON.
+func DecodeJSON(w http.ResponseWriter, r *http.Request, maxBytes int64, v any) error {
+	if ct := r.Header.Get("Content-Type"); ct != "" {
+		mediaType, _, err := mime.ParseMediaType(ct)
+		if err != nil || mediaType != "application/json" {
+			return &RequestError{http.StatusUnsupportedMediaType, fmt.Errorf("unsupported content type %q, expected application/json", ct)}
+		}
+	}
+	if maxBytes <= 0 {
+		maxBytes = DefaultMaxBodyBytes
+	}
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBytes))
+	dec.DisallowUnknownFields()
+	err := dec.Decode(v)
+	if err == nil {
+		if err = dec.Decode(&struct{}{}); errors.Is(err, io.EOF) {
+			return nil
+		}
+		if _, ok := err.(*http.MaxBytesError); !ok {
+			err = errors.New("body must contain a single JSON object")
+		}
+	}
+	var tooLarge *http.MaxBytesError
+	switch {
+	case errors.As(err, &tooLarge):
+		return &RequestError{http.StatusRequestEntityTooLarge, fmt.Errorf("body larger than %d bytes", tooLarge.Limit)}
+	case errors.Is(err, io.EOF):
+		return &RequestError{http.StatusBadRequest, errors.New("empty body")}
+	}
+	return &RequestError{http.StatusBadRequest, err}
+}
@@ -0,0 +1,58 @@
+package server
+
+import (
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type body struct {
+	Zipcode string `json:"zipcode"`
+}
+
+func TestDecodeJSON(t *testing.T) {
+	for _, ct := range []string{"", "application/json", "application/json; charset=utf-8"} {
+		r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"zipcode": "01001000"}`))
+		if ct != "" {
+			r.Header.Set("Content-Type", ct)
+		}
+		var b body
+
+		err := DecodeJSON(httptest.NewRecorder(), r, 0, &b)
+
+		assert.Nil(t, err, ct)
+		assert.Equal(t, "01001000", b.Zipcode)
+	}
+}
+
+func TestDecodeJSON_Errors(t *testing.T) {
+	tests := []struct {
+		name   string
+		ct     string
+		body   string
+		status int
+		err    string
+	}{
+		{"content type", "text/plain", `{"zipcode": "01001000"}`, http.StatusUnsupportedMediaType, `unsupported content type "text/plain"`},
+		{"too large", "application/json", `{"zipcode": "` + strings.Repeat("0", 64) + `"}`, http.StatusRequestEntityTooLarge, "body larger than 32 bytes"},
+		{"trailing too large", "application/json", `{"zipcode": "0"}` + strings.Repeat(" ", 64), http.StatusRequestEntityTooLarge, "body larger than 32 bytes"},
+		{"unknown field", "application/json", `{"zip": "01001000"}`, http.StatusBadRequest, `unknown field "zip"`},
+		{"two objects", "application/json", `{"zipcode": "1"}{}`, http.StatusBadRequest, "single JSON object"},
+		{"empty", "", ``, http.StatusBadRequest, "empty body"},
+		{"syntax", "", `{"zipcode": }`, http.StatusBadRequest, "invalid character"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(tt.body))
+			r.Header.Set("Content-Type", tt.ct)
+			var b body
+
+			err := DecodeJSON(httptest.NewRecorder(), r, 32, &b)
+
+			assert.ErrorContains(t, err, tt.err)
+			assert.Equal(t, tt.status, StatusOf(err))
+		})
+	}
+}
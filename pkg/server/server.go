@@ -0,0 +1,69 @@
+// Package server runs an HTTP server until the process is asked to stop,
+// then drains it and flushes telemetry.
+package server
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"time"
+	"willianszwy/FC-Tracing/pkg/logging"
+)
+
+var logger = logging.Package("server")
+
+// ShutdownFunc releases a resource once the server is drained, e.g. the
+// telemetry.Shutdown flushing spans and metrics.
+type ShutdownFunc func(context.Context) error
+
+// Run listens on srv.Addr and serves until ctx is done, see Serve.
+func Run(ctx context.Context, srv *http.Server, drain time.Duration, shutdowns ...ShutdownFunc) error {
+	ln, err := net.Listen("tcp", srv.Addr)
+	if err != nil {
+		return errors.Join(err, flush(drain, shutdowns))
+	}
+	return Serve(ctx, srv, ln, drain, shutdowns...)
+}
+
+// Serve serves on ln until ctx is done. It then stops accepting
+// connections, waits up to drain for in-flight requests, closes the ones
+// still running, and calls shutdowns in order with a fresh drain deadline.
+// A server that fails to serve is shut down the same way.
+func Serve(ctx context.Context, srv *http.Server, ln net.Listener, drain time.Duration, shutdowns ...ShutdownFunc) error {
+	errc := make(chan error, 1)
+	go func() {
+		errc <- srv.Serve(ln)
+	}()
+	logger.Info("server started", "addr", ln.Addr().String())
+
+	var serveErr error
+	select {
+	case serveErr = <-errc:
+		logger.Error("server failed", "error", serveErr)
+	case <-ctx.Done():
+		logger.Info("shutting down, draining in-flight requests", "deadline", drain.String())
+		drainCtx, cancel := context.WithTimeout(context.Background(), drain)
+		defer cancel()
+		if err := srv.Shutdown(drainCtx); err != nil {
+			logger.Warn("drain deadline exceeded, closing remaining connections", "error", err)
+			srv.Close()
+		}
+		if err := <-errc; !errors.Is(err, http.ErrServerClosed) {
+			serveErr = err
+		}
+	}
+	err := errors.Join(serveErr, flush(drain, shutdowns))
+	logger.Info("server stopped")
+	return err
+}
+
+func flush(timeout time.Duration, shutdowns []ShutdownFunc) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	var errs []error
+	for _, shutdown := range shutdowns {
+		errs = append(errs, shutdown(ctx))
+	}
+	return errors.Join(errs...)
+}
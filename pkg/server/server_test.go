@@ -0,0 +1,121 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+	"willianszwy/FC-Tracing/pkg/tracing"
+)
+
+// keptExporter keeps its spans on shutdown so they can be checked after
+// the provider is flushed.
+type keptExporter struct {
+	*tracetest.InMemoryExporter
+}
+
+func (keptExporter) Shutdown(context.Context) error {
+	return nil
+}
+
+// newServer returns a server whose handler blocks until release is closed,
+// traced by a provider that only exports spans when flushed.
+func newServer(t *testing.T) (*http.Server, net.Listener, *tracetest.InMemoryExporter, *sdktrace.TracerProvider, chan struct{}, chan struct{}) {
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithBatcher(keptExporter{exporter}, sdktrace.WithBatchTimeout(time.Hour)))
+	started, release := make(chan struct{}), make(chan struct{})
+	r := chi.NewRouter()
+	r.Use(tracing.Middleware(r, tracing.WithTracerProvider(tp)))
+	r.Get("/slow", func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+		w.Write([]byte("done"))
+	})
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	return &http.Server{Handler: r}, ln, exporter, tp, started, release
+}
+
+func TestServe_DrainsInFlightRequests(t *testing.T) {
+	srv, ln, exporter, tp, started, release := newServer(t)
+	ctx, stop := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- Serve(ctx, srv, ln, 5*time.Second, tp.Shutdown)
+	}()
+	type result struct {
+		body string
+		err  error
+	}
+	res := make(chan result, 1)
+	go func() {
+		resp, err := http.Get("http://" + ln.Addr().String() + "/slow")
+		if err != nil {
+			res <- result{err: err}
+			return
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		res <- result{string(body), err}
+	}()
+
+	<-started
+	stop()
+	time.Sleep(50 * time.Millisecond)
+	_, err := net.Dial("tcp", ln.Addr().String())
+	assert.NotNil(t, err, "new connections are refused while draining")
+	assert.Empty(t, exporter.GetSpans())
+	close(release)
+
+	r := <-res
+	assert.Nil(t, r.err)
+	assert.Equal(t, "done", r.body)
+	assert.Nil(t, <-done)
+	spans := exporter.GetSpans()
+	assert.Len(t, spans, 1)
+	assert.Equal(t, "GET /slow", spans[0].Name)
+}
+
+func TestServe_DrainDeadline(t *testing.T) {
+	srv, ln, exporter, tp, started, release := newServer(t)
+	defer close(release)
+	ctx, stop := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- Serve(ctx, srv, ln, 50*time.Millisecond, tp.Shutdown)
+	}()
+	go http.Get("http://" + ln.Addr().String() + "/slow")
+
+	<-started
+	stop()
+
+	select {
+	case err := <-done:
+		assert.Nil(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("server did not stop at the drain deadline")
+	}
+	assert.Empty(t, exporter.GetSpans())
+}
+
+func TestServe_Failure(t *testing.T) {
+	srv, ln, _, _, _, _ := newServer(t)
+	ln.Close()
+	flushed := false
+
+	err := Serve(context.Background(), srv, ln, time.Second, func(context.Context) error {
+		flushed = true
+		return errors.New("flush failed")
+	})
+
+	assert.ErrorContains(t, err, "use of closed network connection")
+	assert.ErrorContains(t, err, "flush failed")
+	assert.True(t, flushed)
+}
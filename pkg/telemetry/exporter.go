@@ -0,0 +1,172 @@
+package telemetry
+
+import (
+	"context"
+	"fmt"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/exporters/zipkin"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"log/slog"
+	"net/url"
+	"sort"
+	"strings"
+	"willianszwy/FC-Tracing/pkg/logging"
+)
+
+const (
+	ExporterZipkin   = "zipkin"
+	ExporterOTLPGRPC = "otlp-grpc"
+	ExporterOTLPHTTP = "otlp-http"
+	ExporterStdout   = "stdout"
+	ExporterNone     = "none"
+)
+
+const (
+	CompressionNone = "none"
+	CompressionGzip = "gzip"
+)
+
+// ExporterConfig selects the span exporter and holds the options shared by
+// the OTLP exporters.
+type ExporterConfig struct {
+	Name        string
+	Endpoint    string
+	Headers     Headers
+	Compression string
+	Insecure    bool
+}
+
+// Headers is a set of extra headers sent with every OTLP export. As a flag
+// it is written as a comma separated list of key=value pairs.
+type Headers map[string]string
+
+func (h Headers) String() string {
+	pairs := make([]string, 0, len(h))
+	for k, v := range h {
+		pairs = append(pairs, k+"="+v)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+func (h Headers) Set(value string) error {
+	for _, pair := range strings.Split(value, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		k, v, ok := strings.Cut(pair, "=")
+		if !ok || strings.TrimSpace(k) == "" {
+			return fmt.Errorf("invalid header %q, expected key=value", pair)
+		}
+		h[strings.TrimSpace(k)] = strings.TrimSpace(v)
+	}
+	return nil
+}
+
+// ParseHeaders parses a comma separated key=value list as used by
+// OTEL_EXPORTER_OTLP_HEADERS.
+func ParseHeaders(value string) (Headers, error) {
+	h := Headers{}
+	if err := h.Set(value); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+func newSpanExporter(ctx context.Context, cfg Config) (sdktrace.SpanExporter, error) {
+	exp := cfg.Exporter
+	switch exp.Name {
+	case ExporterZipkin:
+		logger := slog.NewLogLogger(logging.Package("zipkin").Handler(), slog.LevelError)
+		return zipkin.New(cfg.ZipkinURL, zipkin.WithLogger(logger))
+	case ExporterOTLPGRPC:
+		return otlptracegrpc.New(ctx, otlpOptions[otlptracegrpc.Option]{
+			endpoint:    otlptracegrpc.WithEndpoint,
+			endpointURL: otlptracegrpc.WithEndpointURL,
+			headers:     otlptracegrpc.WithHeaders,
+			gzip:        otlptracegrpc.WithCompressor(CompressionGzip),
+			insecure:    otlptracegrpc.WithInsecure(),
+		}.build(exp, "")...)
+	case ExporterOTLPHTTP:
+		return otlptracehttp.New(ctx, otlpOptions[otlptracehttp.Option]{
+			endpoint:    otlptracehttp.WithEndpoint,
+			endpointURL: otlptracehttp.WithEndpointURL,
+			headers:     otlptracehttp.WithHeaders,
+			gzip:        otlptracehttp.WithCompression(otlptracehttp.GzipCompression),
+			insecure:    otlptracehttp.WithInsecure(),
+		}.build(exp, "/v1/traces")...)
+	case ExporterStdout:
+		return stdouttrace.New(stdouttrace.WithPrettyPrint())
+	case ExporterNone:
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("telemetry: unknown exporter %q", exp.Name)
+	}
+}
+
+// otlpOptions builds the options of the OTLP exporter of one signal from an
+// ExporterConfig, with the option constructors of its package.
+type otlpOptions[O any] struct {
+	endpoint    func(string) O
+	endpointURL func(string) O
+	headers     func(map[string]string) O
+	gzip        O
+	insecure    O
+}
+
+// build returns the options for exp. A signal path, empty for gRPC, is set
+// on endpoint URLs with signalURL.
+func (o otlpOptions[O]) build(exp ExporterConfig, path string) []O {
+	var opts []O
+	switch {
+	case exp.Endpoint == "":
+	case strings.Contains(exp.Endpoint, "://") && path != "":
+		opts = append(opts, o.endpointURL(signalURL(exp.Endpoint, path)))
+	case strings.Contains(exp.Endpoint, "://"):
+		opts = append(opts, o.endpointURL(exp.Endpoint))
+	default:
+		opts = append(opts, o.endpoint(exp.Endpoint))
+	}
+	if len(exp.Headers) > 0 {
+		opts = append(opts, o.headers(exp.Headers))
+	}
+	if exp.Compression == CompressionGzip {
+		opts = append(opts, o.gzip)
+	}
+	if exp.Insecure {
+		opts = append(opts, o.insecure)
+	}
+	return opts
+}
+
+// signalPaths are the default OTLP/HTTP paths of each signal.
+var signalPaths = []string{"/v1/traces", "/v1/metrics", "/v1/logs"}
+
+// signalURL appends the default signal path to a base endpoint URL, as the
+// OTLP/HTTP exporters do not, and swaps the path of another signal for it so
+// the exporters can share one endpoint. Other paths are kept.
+func signalURL(endpoint, path string) string {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return endpoint
+	}
+	base := strings.TrimRight(u.Path, "/")
+	swapped := false
+	for _, signal := range signalPaths {
+		if strings.HasSuffix(base, signal) {
+			base, swapped = strings.TrimSuffix(base, signal), true
+			break
+		}
+	}
+	if base != "" && !swapped {
+		return endpoint
+	}
+	u.Path = base + path
+	return u.String()
+}
+
+func validCompression(c string) bool {
+	return c == "" || c == CompressionNone || c == CompressionGzip
+}
@@ -0,0 +1,183 @@
+package telemetry
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/proto"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+// otlpReceiver is a stand-in for an OpenTelemetry Collector that keeps the
+// span names and headers of everything exported to it.
+type otlpReceiver struct {
+	coltracepb.UnimplementedTraceServiceServer
+	mu      sync.Mutex
+	spans   []string
+	headers map[string]string
+}
+
+func (r *otlpReceiver) record(req *coltracepb.ExportTraceServiceRequest, headers map[string]string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, rs := range req.ResourceSpans {
+		for _, ss := range rs.ScopeSpans {
+			for _, span := range ss.Spans {
+				r.spans = append(r.spans, span.Name)
+			}
+		}
+	}
+	r.headers = headers
+}
+
+func (r *otlpReceiver) Export(ctx context.Context, req *coltracepb.ExportTraceServiceRequest) (*coltracepb.ExportTraceServiceResponse, error) {
+	headers := map[string]string{}
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		for k, v := range md {
+			headers[k] = v[0]
+		}
+	}
+	r.record(req, headers)
+	return &coltracepb.ExportTraceServiceResponse{}, nil
+}
+
+func (r *otlpReceiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.URL.Path != "/v1/traces" {
+		http.NotFound(w, req)
+		return
+	}
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var export coltracepb.ExportTraceServiceRequest
+	if err := proto.Unmarshal(body, &export); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	headers := map[string]string{}
+	for k := range req.Header {
+		headers[k] = req.Header.Get(k)
+	}
+	r.record(&export, headers)
+	w.Header().Set("Content-Type", "application/x-protobuf")
+	w.WriteHeader(http.StatusOK)
+}
+
+func (r *otlpReceiver) Spans() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.spans...)
+}
+
+func exportOneSpan(t *testing.T, cfg Config) {
+	shutdown, err := Setup(context.TODO(), cfg)
+	assert.Nil(t, err)
+
+	_, span := otel.GetTracerProvider().Tracer("test").Start(context.TODO(), "exported span")
+	span.End()
+
+	assert.Nil(t, shutdown(context.TODO()))
+}
+
+func TestSetup_OTLPHTTPExporter(t *testing.T) {
+	receiver := &otlpReceiver{}
+	server := httptest.NewServer(receiver)
+	defer server.Close()
+
+	exportOneSpan(t, Config{
+		ServiceName: "service-a",
+		Sampling:    SamplingConfig{Ratio: 1},
+		Exporter: ExporterConfig{
+			Name:        ExporterOTLPHTTP,
+			Endpoint:    server.URL + "/",
+			Headers:     Headers{"X-Tenant": "fc"},
+			Compression: CompressionNone,
+			Insecure:    true,
+		},
+	})
+
+	assert.Equal(t, []string{"exported span"}, receiver.Spans())
+	assert.Equal(t, "fc", receiver.headers["X-Tenant"])
+}
+
+func TestSetup_OTLPGRPCExporter(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	receiver := &otlpReceiver{}
+	server := grpc.NewServer()
+	coltracepb.RegisterTraceServiceServer(server, receiver)
+	go server.Serve(lis)
+	defer server.Stop()
+
+	exportOneSpan(t, Config{
+		ServiceName: "service-a",
+		Sampling:    SamplingConfig{Ratio: 1},
+		Exporter: ExporterConfig{
+			Name:        ExporterOTLPGRPC,
+			Endpoint:    lis.Addr().String(),
+			Headers:     Headers{"x-tenant": "fc"},
+			Compression: CompressionGzip,
+			Insecure:    true,
+		},
+	})
+
+	assert.Equal(t, []string{"exported span"}, receiver.Spans())
+	assert.Equal(t, "fc", receiver.headers["x-tenant"])
+}
+
+func TestSetup_NoneExporter(t *testing.T) {
+	exportOneSpan(t, Config{
+		ServiceName: "service-a",
+		Sampling:    SamplingConfig{Ratio: 1},
+		Exporter:    ExporterConfig{Name: ExporterNone},
+	})
+}
+
+func TestParseHeaders(t *testing.T) {
+	headers, err := ParseHeaders("a=1, b = 2,")
+
+	assert.Nil(t, err)
+	assert.Equal(t, Headers{"a": "1", "b": "2"}, headers)
+	assert.Equal(t, "a=1,b=2", headers.String())
+
+	_, err = ParseHeaders("=1")
+	assert.NotNil(t, err)
+}
+
+func TestSignalURL(t *testing.T) {
+	assert.Equal(t, "http://collector:4318/v1/metrics", signalURL("http://collector:4318", "/v1/metrics"))
+	assert.Equal(t, "http://collector:4318/v1/metrics", signalURL("http://collector:4318/v1/traces", "/v1/metrics"))
+	assert.Equal(t, "https://gw/otlp/v1/logs", signalURL("https://gw/otlp/v1/traces/", "/v1/logs"))
+	assert.Equal(t, "https://gw/custom", signalURL("https://gw/custom", "/v1/logs"))
+}
+
+func TestOTLPOptions(t *testing.T) {
+	o := otlpOptions[string]{
+		endpoint:    func(e string) string { return "endpoint " + e },
+		endpointURL: func(u string) string { return "url " + u },
+		headers:     func(h map[string]string) string { return "headers " + Headers(h).String() },
+		gzip:        "gzip",
+		insecure:    "insecure",
+	}
+
+	assert.Empty(t, o.build(ExporterConfig{}, "/v1/traces"))
+	assert.Equal(t, []string{"endpoint collector:4317"}, o.build(ExporterConfig{Endpoint: "collector:4317"}, ""))
+	assert.Equal(t, []string{"url http://collector:4317"}, o.build(ExporterConfig{Endpoint: "http://collector:4317"}, ""))
+	full := ExporterConfig{
+		Endpoint:    "http://collector:4318/",
+		Headers:     Headers{"api-key": "secret"},
+		Compression: CompressionGzip,
+		Insecure:    true,
+	}
+	assert.Equal(t, []string{"url http://collector:4318/v1/logs", "headers api-key=secret", "gzip", "insecure"}, o.build(full, "/v1/logs"))
+}
@@ -0,0 +1,149 @@
+package telemetry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go.opentelemetry.io/contrib/bridges/otelslog"
+	"go.opentelemetry.io/otel/exporters/otlp/otlplog/otlploggrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlplog/otlploghttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdoutlog"
+	"go.opentelemetry.io/otel/log"
+	"go.opentelemetry.io/otel/log/global"
+	sdklog "go.opentelemetry.io/otel/sdk/log"
+	"go.opentelemetry.io/otel/sdk/resource"
+	"os"
+	"willianszwy/FC-Tracing/pkg/logging"
+)
+
+// ExporterFile writes log records as JSON lines to LogsConfig.File.
+const ExporterFile = "file"
+
+// LogsConfig controls the logger provider installed by Setup. Log records
+// of the slog default logger and of logging.Package loggers are bridged to
+// it, with the slog level mapped to the OpenTelemetry severity.
+type LogsConfig struct {
+	// Exporter is otlp-grpc, otlp-http, stdout, file or none. The OTLP
+	// exporters share the endpoint and options of the span exporter.
+	Exporter string
+	// File is the path the file exporter appends to.
+	File string
+}
+
+func logsFromEnv() LogsConfig {
+	return LogsConfig{
+		Exporter: getEnv("OTEL_LOGS_EXPORTER", ExporterNone),
+		File:     os.Getenv("OTEL_LOGS_FILE"),
+	}
+}
+
+func (c LogsConfig) validate() error {
+	switch c.Exporter {
+	case "", ExporterNone, ExporterOTLPGRPC, ExporterOTLPHTTP, ExporterStdout:
+	case ExporterFile:
+		if c.File == "" {
+			return errors.New("telemetry: a file is required for the file logs exporter")
+		}
+	default:
+		return fmt.Errorf("telemetry: unknown logs exporter %q", c.Exporter)
+	}
+	return nil
+}
+
+// setupLogs installs the logger provider and bridges slog to it. It returns
+// nil when logs are not exported.
+func setupLogs(ctx context.Context, cfg Config, res *resource.Resource) (Shutdown, error) {
+	exporter, closeFile, err := newLogExporter(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+	if exporter == nil {
+		logging.SetSink(nil)
+		return nil, nil
+	}
+	lp := sdklog.NewLoggerProvider(
+		sdklog.WithResource(res),
+		sdklog.WithProcessor(severityProcessor{}),
+		sdklog.WithProcessor(sdklog.NewBatchProcessor(exporter)),
+	)
+	global.SetLoggerProvider(lp)
+	logging.SetSink(otelslog.NewHandler(instrumentationName, otelslog.WithLoggerProvider(lp)))
+
+	return func(ctx context.Context) error {
+		logging.SetSink(nil)
+		err := lp.Shutdown(ctx)
+		if closeFile != nil {
+			err = errors.Join(err, closeFile())
+		}
+		return err
+	}, nil
+}
+
+func newLogExporter(ctx context.Context, cfg Config) (sdklog.Exporter, func() error, error) {
+	exp := cfg.Exporter
+	switch cfg.Logs.Exporter {
+	case ExporterOTLPGRPC:
+		e, err := otlploggrpc.New(ctx, otlpOptions[otlploggrpc.Option]{
+			endpoint:    otlploggrpc.WithEndpoint,
+			endpointURL: otlploggrpc.WithEndpointURL,
+			headers:     otlploggrpc.WithHeaders,
+			gzip:        otlploggrpc.WithCompressor(CompressionGzip),
+			insecure:    otlploggrpc.WithInsecure(),
+		}.build(exp, "")...)
+		return e, nil, err
+	case ExporterOTLPHTTP:
+		e, err := otlploghttp.New(ctx, otlpOptions[otlploghttp.Option]{
+			endpoint:    otlploghttp.WithEndpoint,
+			endpointURL: otlploghttp.WithEndpointURL,
+			headers:     otlploghttp.WithHeaders,
+			gzip:        otlploghttp.WithCompression(otlploghttp.GzipCompression),
+			insecure:    otlploghttp.WithInsecure(),
+		}.build(exp, "/v1/logs")...)
+		return e, nil, err
+	case ExporterStdout:
+		e, err := stdoutlog.New(stdoutlog.WithWriter(os.Stdout))
+		return e, nil, err
+	case ExporterFile:
+		f, err := os.OpenFile(cfg.Logs.File, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			return nil, nil, fmt.Errorf("telemetry: %w", err)
+		}
+		e, err := stdoutlog.New(stdoutlog.WithWriter(f))
+		if err != nil {
+			f.Close()
+			return nil, nil, err
+		}
+		return e, f.Close, nil
+	default:
+		return nil, nil, nil
+	}
+}
+
+// severityProcessor sets the severity text of bridged slog records, which
+// only carry the numeric severity, to the slog level name.
+type severityProcessor struct{}
+
+func (severityProcessor) OnEmit(_ context.Context, r *sdklog.Record) error {
+	if r.SeverityText() != "" {
+		return nil
+	}
+	switch sev := r.Severity(); {
+	case sev >= log.SeverityError:
+		r.SetSeverityText("ERROR")
+	case sev >= log.SeverityWarn:
+		r.SetSeverityText("WARN")
+	case sev >= log.SeverityInfo:
+		r.SetSeverityText("INFO")
+	default:
+		r.SetSeverityText("DEBUG")
+	}
+	return nil
+}
+
+func (severityProcessor) Shutdown(context.Context) error {
+	return nil
+}
+
+func (severityProcessor) ForceFlush(context.Context) error {
+	return nil
+}
@@ -0,0 +1,80 @@
+package telemetry
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"willianszwy/FC-Tracing/pkg/logging"
+)
+
+func TestConfigFromEnv_Logs(t *testing.T) {
+	t.Setenv("OTEL_LOGS_EXPORTER", ExporterFile)
+	t.Setenv("OTEL_LOGS_FILE", "/tmp/service-a.log")
+
+	cfg, err := ConfigFromEnv("service-a")
+
+	assert.Nil(t, err)
+	assert.Equal(t, LogsConfig{Exporter: ExporterFile, File: "/tmp/service-a.log"}, cfg.Logs)
+}
+
+func TestValidate_Logs(t *testing.T) {
+	cfg := Config{ServiceName: "service-a", Exporter: ExporterConfig{Name: ExporterNone}, Logs: LogsConfig{Exporter: ExporterFile}}
+	assert.EqualError(t, cfg.Validate(), "telemetry: a file is required for the file logs exporter")
+
+	cfg.Logs.Exporter = "syslog"
+	assert.EqualError(t, cfg.Validate(), `telemetry: unknown logs exporter "syslog"`)
+}
+
+func TestSetup_LogsFile(t *testing.T) {
+	_, err := logging.Setup(io.Discard, logging.Config{Format: logging.FormatJSON})
+	assert.Nil(t, err)
+	file := filepath.Join(t.TempDir(), "logs.jsonl")
+	shutdown, err := Setup(context.TODO(), Config{
+		ServiceName: "service-a",
+		Exporter:    ExporterConfig{Name: ExporterNone},
+		Sampling:    SamplingConfig{Ratio: 1},
+		Logs:        LogsConfig{Exporter: ExporterFile, File: file},
+	})
+	assert.Nil(t, err)
+
+	ctx, span := otel.Tracer("test").Start(context.TODO(), "test")
+	logging.Package("weather").WarnContext(ctx, "can not fetch weather", "api_key", "secret")
+	span.End()
+	assert.Nil(t, shutdown(context.TODO()))
+
+	out, err := os.ReadFile(file)
+	assert.Nil(t, err)
+	assert.Contains(t, string(out), `"Body":{"Type":"String","Value":"can not fetch weather"}`)
+	assert.Contains(t, string(out), `"Severity":13`)
+	assert.Contains(t, string(out), `"SeverityText":"WARN"`)
+	assert.Contains(t, string(out), span.SpanContext().TraceID().String())
+	assert.Contains(t, string(out), `"Key":"service.name","Value":{"Type":"STRING","Value":"service-a"}`)
+	assert.Contains(t, string(out), `"Key":"package","Value":{"Type":"String","Value":"weather"}`)
+	assert.NotContains(t, string(out), "secret")
+}
+
+func TestSetup_LogsOTLP(t *testing.T) {
+	paths := make(chan string, 1)
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths <- r.URL.Path
+	}))
+	defer collector.Close()
+	shutdown, err := Setup(context.TODO(), Config{
+		ServiceName: "service-a",
+		Exporter:    ExporterConfig{Name: ExporterNone, Endpoint: collector.URL, Insecure: true},
+		Logs:        LogsConfig{Exporter: ExporterOTLPHTTP},
+	})
+	assert.Nil(t, err)
+
+	slog.Default().Error("upstream error")
+
+	assert.Nil(t, shutdown(context.TODO()))
+	assert.Equal(t, "/v1/logs", <-paths)
+}
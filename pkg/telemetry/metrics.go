@@ -0,0 +1,136 @@
+package telemetry
+
+import (
+	"context"
+	"fmt"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetricgrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetrichttp"
+	otelprometheus "go.opentelemetry.io/otel/exporters/prometheus"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/resource"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+const defaultMetricsInterval = time.Minute
+
+// MetricsConfig controls the meter provider installed by Setup.
+type MetricsConfig struct {
+	// Prometheus serves the metrics in the Prometheus text format through
+	// MetricsHandler.
+	Prometheus bool
+	// Exporter pushes the metrics to an OTLP collector: otlp-grpc, otlp-http
+	// or none. It shares the endpoint and options of the span exporter.
+	Exporter string
+	// Interval between two OTLP pushes.
+	Interval time.Duration
+}
+
+func metricsFromEnv() (MetricsConfig, error) {
+	var cfg MetricsConfig
+	var err error
+	if cfg.Prometheus, err = getEnvBool("OTEL_METRICS_PROMETHEUS", true); err != nil {
+		return cfg, err
+	}
+	cfg.Exporter = getEnv("OTEL_METRICS_EXPORTER", ExporterNone)
+	// OTEL_METRIC_EXPORT_INTERVAL is in milliseconds.
+	interval, err := getEnvInt("OTEL_METRIC_EXPORT_INTERVAL", int(defaultMetricsInterval/time.Millisecond))
+	if err != nil {
+		return cfg, err
+	}
+	cfg.Interval = time.Duration(interval) * time.Millisecond
+	return cfg, nil
+}
+
+func (c MetricsConfig) validate() error {
+	switch c.Exporter {
+	case "", ExporterNone, ExporterOTLPGRPC, ExporterOTLPHTTP:
+	default:
+		return fmt.Errorf("telemetry: unknown metrics exporter %q", c.Exporter)
+	}
+	if c.Interval < 0 {
+		return fmt.Errorf("telemetry: metrics interval must not be negative, got %s", c.Interval)
+	}
+	return nil
+}
+
+// metricsEndpoint lets metricsHandler hold a nil handler.
+type metricsEndpoint struct {
+	handler http.Handler
+}
+
+var metricsHandler atomic.Value
+
+// MetricsHandler serves the metrics collected by the meter provider of the
+// last Setup in the Prometheus text format. It answers 404 when the
+// Prometheus endpoint is disabled.
+func MetricsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		endpoint, _ := metricsHandler.Load().(metricsEndpoint)
+		if endpoint.handler == nil {
+			http.NotFound(w, r)
+			return
+		}
+		endpoint.handler.ServeHTTP(w, r)
+	})
+}
+
+func newMeterProvider(ctx context.Context, cfg Config, res *resource.Resource) (*sdkmetric.MeterProvider, http.Handler, error) {
+	opts := []sdkmetric.Option{sdkmetric.WithResource(res)}
+
+	var handler http.Handler
+	if cfg.Metrics.Prometheus {
+		registry := prometheus.NewRegistry()
+		registry.MustRegister(
+			collectors.NewGoCollector(),
+			collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		)
+		reader, err := otelprometheus.New(otelprometheus.WithRegisterer(registry))
+		if err != nil {
+			return nil, nil, err
+		}
+		opts = append(opts, sdkmetric.WithReader(reader))
+		handler = promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
+	}
+
+	exporter, err := newMetricExporter(ctx, cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+	if exporter != nil {
+		interval := cfg.Metrics.Interval
+		if interval == 0 {
+			interval = defaultMetricsInterval
+		}
+		opts = append(opts, sdkmetric.WithReader(sdkmetric.NewPeriodicReader(exporter, sdkmetric.WithInterval(interval))))
+	}
+	return sdkmetric.NewMeterProvider(opts...), handler, nil
+}
+
+func newMetricExporter(ctx context.Context, cfg Config) (sdkmetric.Exporter, error) {
+	exp := cfg.Exporter
+	switch cfg.Metrics.Exporter {
+	case ExporterOTLPGRPC:
+		return otlpmetricgrpc.New(ctx, otlpOptions[otlpmetricgrpc.Option]{
+			endpoint:    otlpmetricgrpc.WithEndpoint,
+			endpointURL: otlpmetricgrpc.WithEndpointURL,
+			headers:     otlpmetricgrpc.WithHeaders,
+			gzip:        otlpmetricgrpc.WithCompressor(CompressionGzip),
+			insecure:    otlpmetricgrpc.WithInsecure(),
+		}.build(exp, "")...)
+	case ExporterOTLPHTTP:
+		return otlpmetrichttp.New(ctx, otlpOptions[otlpmetrichttp.Option]{
+			endpoint:    otlpmetrichttp.WithEndpoint,
+			endpointURL: otlpmetrichttp.WithEndpointURL,
+			headers:     otlpmetrichttp.WithHeaders,
+			gzip:        otlpmetrichttp.WithCompression(otlpmetrichttp.GzipCompression),
+			insecure:    otlpmetrichttp.WithInsecure(),
+		}.build(exp, "/v1/metrics")...)
+	default:
+		return nil, nil
+	}
+}
@@ -0,0 +1,85 @@
+package telemetry
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestConfigFromEnv_Metrics(t *testing.T) {
+	t.Setenv("OTEL_METRICS_EXPORTER", ExporterOTLPHTTP)
+	t.Setenv("OTEL_METRIC_EXPORT_INTERVAL", "5000")
+
+	cfg, err := ConfigFromEnv("service-a")
+
+	assert.Nil(t, err)
+	assert.Equal(t, MetricsConfig{Prometheus: true, Exporter: ExporterOTLPHTTP, Interval: 5 * time.Second}, cfg.Metrics)
+}
+
+func TestValidate_MetricsExporter(t *testing.T) {
+	cfg := Config{ServiceName: "service-a", Exporter: ExporterConfig{Name: ExporterNone}, Metrics: MetricsConfig{Exporter: "statsd"}}
+
+	assert.EqualError(t, cfg.Validate(), `telemetry: unknown metrics exporter "statsd"`)
+}
+
+func TestMetricsHandler(t *testing.T) {
+	shutdown, err := Setup(context.TODO(), Config{
+		ServiceName: "service-a",
+		Exporter:    ExporterConfig{Name: ExporterNone},
+		Metrics:     MetricsConfig{Prometheus: true},
+	})
+	assert.Nil(t, err)
+	defer shutdown(context.TODO())
+
+	counter, _ := otel.Meter("test").Int64Counter("upstream.requests")
+	counter.Add(context.TODO(), 2)
+
+	w := httptest.NewRecorder()
+	MetricsHandler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	body, _ := io.ReadAll(w.Result().Body)
+
+	assert.Equal(t, http.StatusOK, w.Result().StatusCode)
+	assert.Contains(t, string(body), "upstream_requests_total")
+	assert.Contains(t, string(body), `service_name="service-a"`)
+	assert.Contains(t, string(body), "go_goroutines")
+}
+
+func TestMetricsHandler_Disabled(t *testing.T) {
+	shutdown, err := Setup(context.TODO(), Config{ServiceName: "service-a", Exporter: ExporterConfig{Name: ExporterNone}})
+	assert.Nil(t, err)
+	defer shutdown(context.TODO())
+
+	w := httptest.NewRecorder()
+	MetricsHandler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	assert.Equal(t, http.StatusNotFound, w.Result().StatusCode)
+}
+
+func TestSetup_MetricsOTLP(t *testing.T) {
+	for _, path := range []string{"/", "/v1/traces"} {
+		t.Run(path, func(t *testing.T) {
+			paths := make(chan string, 1)
+			collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				paths <- r.URL.Path
+			}))
+			defer collector.Close()
+			shutdown, err := Setup(context.TODO(), Config{
+				ServiceName: "service-a",
+				Exporter:    ExporterConfig{Name: ExporterNone, Endpoint: collector.URL + path, Insecure: true},
+				Metrics:     MetricsConfig{Exporter: ExporterOTLPHTTP, Interval: time.Hour},
+			})
+			assert.Nil(t, err)
+
+			counter, _ := otel.Meter("test").Int64Counter("upstream.requests")
+			counter.Add(context.TODO(), 1)
+
+			assert.Nil(t, shutdown(context.TODO()))
+			assert.Equal(t, "/v1/metrics", <-paths)
+		})
+	}
+}
@@ -0,0 +1,91 @@
+package telemetry
+
+import (
+	"fmt"
+	"go.opentelemetry.io/contrib/propagators/b3"
+	"go.opentelemetry.io/contrib/propagators/jaeger"
+	"go.opentelemetry.io/otel/propagation"
+	"strings"
+)
+
+const (
+	PropagatorTraceContext = "tracecontext"
+	PropagatorBaggage      = "baggage"
+	PropagatorB3           = "b3"
+	PropagatorB3Multi      = "b3multi"
+	PropagatorJaeger       = "jaeger"
+	PropagatorNone         = "none"
+)
+
+var defaultPropagators = Propagators{PropagatorTraceContext, PropagatorBaggage, PropagatorB3}
+
+// Propagators is an ordered list of propagator names, written as a comma
+// separated list like OTEL_PROPAGATORS.
+type Propagators []string
+
+func (p *Propagators) String() string {
+	if p == nil {
+		return ""
+	}
+	return strings.Join(*p, ",")
+}
+
+func (p *Propagators) Set(value string) error {
+	names, err := ParsePropagators(value)
+	if err != nil {
+		return err
+	}
+	*p = names
+	return nil
+}
+
+// ParsePropagators parses and validates a comma separated propagator list.
+func ParsePropagators(value string) (Propagators, error) {
+	var names Propagators
+	for _, name := range strings.Split(value, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		if _, err := newPropagator(name); err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+// NewPropagator returns a composite propagator that injects every format in
+// names and extracts whichever of them a request carries.
+func NewPropagator(names Propagators) (propagation.TextMapPropagator, error) {
+	var propagators []propagation.TextMapPropagator
+	for _, name := range names {
+		p, err := newPropagator(name)
+		if err != nil {
+			return nil, err
+		}
+		if p != nil {
+			propagators = append(propagators, p)
+		}
+	}
+	return propagation.NewCompositeTextMapPropagator(propagators...), nil
+}
+
+func newPropagator(name string) (propagation.TextMapPropagator, error) {
+	switch name {
+	case PropagatorTraceContext:
+		return propagation.TraceContext{}, nil
+	case PropagatorBaggage:
+		return propagation.Baggage{}, nil
+	case PropagatorB3:
+		return b3.New(b3.WithInjectEncoding(b3.B3SingleHeader)), nil
+	case PropagatorB3Multi:
+		return b3.New(b3.WithInjectEncoding(b3.B3MultipleHeader)), nil
+	case PropagatorJaeger:
+		return jaeger.Jaeger{}, nil
+	case PropagatorNone:
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("telemetry: unknown propagator %q", name)
+	}
+}
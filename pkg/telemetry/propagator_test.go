@@ -0,0 +1,101 @@
+package telemetry
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/baggage"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+	"net/http"
+	"testing"
+)
+
+var propagatedSpan = trace.NewSpanContext(trace.SpanContextConfig{
+	TraceID:    trace.TraceID{0x4b, 0xf9, 0x2f, 0x35, 0x77, 0xb3, 0x4d, 0xa6, 0xa3, 0xce, 0x92, 0x9d, 0x0e, 0x0e, 0x47, 0x36},
+	SpanID:     trace.SpanID{0x00, 0xf0, 0x67, 0xaa, 0x0b, 0xa9, 0x02, 0xb7},
+	TraceFlags: trace.FlagsSampled,
+})
+
+func mustPropagator(t *testing.T, names string) propagation.TextMapPropagator {
+	parsed, err := ParsePropagators(names)
+	assert.Nil(t, err)
+	p, err := NewPropagator(parsed)
+	assert.Nil(t, err)
+	return p
+}
+
+func TestParsePropagators(t *testing.T) {
+	names, err := ParsePropagators("tracecontext, B3Multi,,jaeger")
+
+	assert.Nil(t, err)
+	assert.Equal(t, Propagators{PropagatorTraceContext, PropagatorB3Multi, PropagatorJaeger}, names)
+
+	_, err = ParsePropagators("tracecontext,xray")
+	assert.EqualError(t, err, `telemetry: unknown propagator "xray"`)
+}
+
+func TestPropagator_CrossFormat(t *testing.T) {
+	tests := []struct {
+		name    string
+		inject  string
+		extract string
+		header  string
+	}{
+		{"b3 single into composite", PropagatorB3, "tracecontext,baggage,b3", "B3"},
+		{"b3 multi into b3 single", PropagatorB3Multi, PropagatorB3, "X-B3-Traceid"},
+		{"jaeger into composite", PropagatorJaeger, "tracecontext,jaeger", "Uber-Trace-Id"},
+		{"tracecontext into composite", PropagatorTraceContext, "b3multi,tracecontext", "Traceparent"},
+		{"composite into tracecontext", "tracecontext,b3multi", PropagatorTraceContext, "Traceparent"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := http.Header{}
+			ctx := trace.ContextWithSpanContext(context.TODO(), propagatedSpan)
+			mustPropagator(t, tt.inject).Inject(ctx, propagation.HeaderCarrier(header))
+			assert.NotEmpty(t, header.Get(tt.header))
+
+			extracted := mustPropagator(t, tt.extract).Extract(context.TODO(), propagation.HeaderCarrier(header))
+			sc := trace.SpanContextFromContext(extracted)
+
+			assert.Equal(t, propagatedSpan.TraceID(), sc.TraceID())
+			assert.Equal(t, propagatedSpan.SpanID(), sc.SpanID())
+			assert.True(t, sc.IsSampled())
+			assert.True(t, sc.IsRemote())
+		})
+	}
+}
+
+func TestPropagator_InjectsEveryFormat(t *testing.T) {
+	header := http.Header{}
+	ctx := trace.ContextWithSpanContext(context.TODO(), propagatedSpan)
+
+	mustPropagator(t, "tracecontext,b3,b3multi,jaeger").Inject(ctx, propagation.HeaderCarrier(header))
+
+	assert.Equal(t, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", header.Get("Traceparent"))
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-1", header.Get("B3"))
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", header.Get("X-B3-Traceid"))
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736:00f067aa0ba902b7:0:1", header.Get("Uber-Trace-Id"))
+}
+
+func TestPropagator_Baggage(t *testing.T) {
+	member, err := baggage.NewMember("zipcode", "06835100")
+	assert.Nil(t, err)
+	bag, err := baggage.New(member)
+	assert.Nil(t, err)
+	header := http.Header{}
+
+	p := mustPropagator(t, "tracecontext,baggage")
+	p.Inject(baggage.ContextWithBaggage(context.TODO(), bag), propagation.HeaderCarrier(header))
+	extracted := p.Extract(context.TODO(), propagation.HeaderCarrier(header))
+
+	assert.Equal(t, "06835100", baggage.FromContext(extracted).Member("zipcode").Value())
+}
+
+func TestPropagator_None(t *testing.T) {
+	header := http.Header{}
+	ctx := trace.ContextWithSpanContext(context.TODO(), propagatedSpan)
+
+	mustPropagator(t, PropagatorNone).Inject(ctx, propagation.HeaderCarrier(header))
+
+	assert.Empty(t, header)
+}
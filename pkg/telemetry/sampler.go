@@ -0,0 +1,318 @@
+package telemetry
+
+import (
+	"context"
+	"fmt"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+const (
+	DecisionAlways = "always"
+	DecisionNever  = "never"
+	DecisionErrors = "errors"
+)
+
+// SamplingConfig controls the head sampler installed by Setup.
+type SamplingConfig struct {
+	// Ratio of new traces that are sampled when no rule matches.
+	Ratio float64
+	// DebugHeader names a request header that forces a request to be sampled.
+	DebugHeader string
+	// SampleErrors keeps spans that end with an error status even when the
+	// ratio would have dropped them. Only the failed spans are exported, so
+	// their parent may be missing from the trace. Spans below a remote parent
+	// that was not sampled are not kept: that parent is never exported.
+	SampleErrors bool
+	Rules        SamplingRules
+
+	// recordAll is set when a tail sampler decides later, so unsampled
+	// spans are still recorded for it.
+	recordAll bool
+}
+
+// SamplingRule overrides the ratio for requests matching Method and Route.
+// An empty Method or Route, or "*", matches anything. Decision is one of
+// always, never, errors or a ratio between 0 and 1; errors applies the
+// default decision but still keeps the span when it fails.
+type SamplingRule struct {
+	Method   string
+	Route    string
+	Decision string
+	ratio    float64
+}
+
+// SamplingRules is a list of rules written as "METHOD /route=decision"
+// entries separated by semicolons, e.g. "POST /temperature=errors;GET /healthz=never".
+type SamplingRules []SamplingRule
+
+func (r *SamplingRules) String() string {
+	if r == nil {
+		return ""
+	}
+	rules := make([]string, 0, len(*r))
+	for _, rule := range *r {
+		rules = append(rules, strings.TrimSpace(rule.Method+" "+rule.Route)+"="+rule.Decision)
+	}
+	return strings.Join(rules, ";")
+}
+
+func (r *SamplingRules) Set(value string) error {
+	rules, err := ParseSamplingRules(value)
+	if err != nil {
+		return err
+	}
+	*r = append(*r, rules...)
+	return nil
+}
+
+// ParseSamplingRules parses the format described on SamplingRules.
+func ParseSamplingRules(value string) (SamplingRules, error) {
+	var rules SamplingRules
+	for _, entry := range strings.Split(value, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		match, decision, ok := strings.Cut(entry, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid sampling rule %q, expected \"METHOD /route=decision\"", entry)
+		}
+		rule := SamplingRule{Decision: strings.TrimSpace(decision)}
+		fields := strings.Fields(match)
+		switch len(fields) {
+		case 1:
+			rule.Route = fields[0]
+		case 2:
+			rule.Method, rule.Route = strings.ToUpper(fields[0]), fields[1]
+		default:
+			return nil, fmt.Errorf("invalid sampling rule %q, expected \"METHOD /route=decision\"", entry)
+		}
+		if err := rule.validate(); err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+func (r *SamplingRule) validate() error {
+	switch r.Decision {
+	case DecisionAlways, DecisionNever, DecisionErrors:
+		return nil
+	}
+	ratio, err := strconv.ParseFloat(r.Decision, 64)
+	if err != nil || ratio < 0 || ratio > 1 {
+		return fmt.Errorf("invalid sampling decision %q, expected always, never, errors or a ratio between 0 and 1", r.Decision)
+	}
+	r.ratio = ratio
+	return nil
+}
+
+func (r SamplingRule) matches(method, route string) bool {
+	if r.Method != "" && r.Method != "*" && r.Method != method {
+		return false
+	}
+	return r.Route == "" || r.Route == "*" || r.Route == route
+}
+
+type forceSampleKey struct{}
+
+// ContextWithForceSample marks ctx so that spans started from it are
+// always sampled.
+func ContextWithForceSample(ctx context.Context) context.Context {
+	return context.WithValue(ctx, forceSampleKey{}, true)
+}
+
+func forceSampled(ctx context.Context) bool {
+	forced, _ := ctx.Value(forceSampleKey{}).(bool)
+	return forced
+}
+
+// DebugHeader returns a middleware that forces sampling for requests that
+// carry header with a non empty value. It is a no-op when header is empty.
+func DebugHeader(header string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if header == "" {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get(header) != "" {
+				r = r.WithContext(ContextWithForceSample(r.Context()))
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+type sampler struct {
+	cfg   SamplingConfig
+	ratio atomic.Pointer[ratioSampler]
+}
+
+// ratioSampler keeps the ratio next to its sampler so both are swapped
+// together.
+type ratioSampler struct {
+	sdktrace.Sampler
+	value float64
+}
+
+// activeSampler is the sampler of the tracer provider built by Setup.
+var activeSampler atomic.Pointer[sampler]
+
+// NewSampler returns the parent based sampler described by cfg.
+func NewSampler(cfg SamplingConfig) sdktrace.Sampler {
+	return newSampler(cfg)
+}
+
+func newSampler(cfg SamplingConfig) *sampler {
+	s := &sampler{cfg: cfg}
+	s.setRatio(cfg.Ratio)
+	return s
+}
+
+func (s *sampler) setRatio(ratio float64) {
+	s.ratio.Store(&ratioSampler{Sampler: sdktrace.TraceIDRatioBased(ratio), value: ratio})
+}
+
+// SetSamplingRatio changes the ratio of new traces sampled by the tracer
+// provider built by Setup. Rules keep their own ratio.
+func SetSamplingRatio(ratio float64) error {
+	if ratio < 0 || ratio > 1 {
+		return fmt.Errorf("telemetry: sampler ratio must be between 0 and 1, got %g", ratio)
+	}
+	if s := activeSampler.Load(); s != nil {
+		s.setRatio(ratio)
+	}
+	return nil
+}
+
+func (s *sampler) ShouldSample(p sdktrace.SamplingParameters) sdktrace.SamplingResult {
+	psc := trace.SpanContextFromContext(p.ParentContext)
+	if forceSampled(p.ParentContext) {
+		return sdktrace.SamplingResult{Decision: sdktrace.RecordAndSample, Tracestate: psc.TraceState()}
+	}
+
+	keepErrors := s.cfg.SampleErrors || s.cfg.recordAll
+	if rule, ok := s.match(p); ok {
+		switch rule.Decision {
+		case DecisionAlways:
+			return sdktrace.SamplingResult{Decision: sdktrace.RecordAndSample, Tracestate: psc.TraceState()}
+		case DecisionNever:
+			return sdktrace.SamplingResult{Decision: sdktrace.Drop, Tracestate: psc.TraceState()}
+		case DecisionErrors:
+			keepErrors = true
+		default:
+			if !psc.IsValid() {
+				return s.keepErrors(sdktrace.TraceIDRatioBased(rule.ratio).ShouldSample(p), keepErrors)
+			}
+		}
+	}
+
+	if psc.IsRemote() && !psc.IsSampled() {
+		keepErrors = s.cfg.recordAll
+	}
+
+	var result sdktrace.SamplingResult
+	switch {
+	case !psc.IsValid():
+		result = s.ratio.Load().ShouldSample(p)
+	case psc.IsSampled():
+		result = sdktrace.SamplingResult{Decision: sdktrace.RecordAndSample, Tracestate: psc.TraceState()}
+	default:
+		result = sdktrace.SamplingResult{Decision: sdktrace.Drop, Tracestate: psc.TraceState()}
+	}
+	return s.keepErrors(result, keepErrors)
+}
+
+// keepErrors turns a drop into record-only so the error span processor or
+// the tail sampler can still export the span.
+func (s *sampler) keepErrors(result sdktrace.SamplingResult, keep bool) sdktrace.SamplingResult {
+	if keep && result.Decision == sdktrace.Drop {
+		result.Decision = sdktrace.RecordOnly
+	}
+	return result
+}
+
+func (s *sampler) match(p sdktrace.SamplingParameters) (SamplingRule, bool) {
+	if len(s.cfg.Rules) == 0 {
+		return SamplingRule{}, false
+	}
+	method, route := requestRoute(p)
+	for _, rule := range s.cfg.Rules {
+		if rule.matches(method, route) {
+			return rule, true
+		}
+	}
+	return SamplingRule{}, false
+}
+
+// requestRoute reads the HTTP method and route from the span start
+// attributes, falling back to a "METHOD /route" span name.
+func requestRoute(p sdktrace.SamplingParameters) (string, string) {
+	var method, route string
+	for _, attr := range p.Attributes {
+		switch attr.Key {
+		case semconv.HTTPRequestMethodKey:
+			method = attr.Value.AsString()
+		case semconv.HTTPRouteKey:
+			route = attr.Value.AsString()
+		}
+	}
+	if method == "" || route == "" {
+		if m, r, ok := strings.Cut(p.Name, " "); ok && strings.HasPrefix(r, "/") {
+			if method == "" {
+				method = m
+			}
+			if route == "" {
+				route = r
+			}
+		}
+	}
+	return method, route
+}
+
+func (s *sampler) Description() string {
+	return fmt.Sprintf("FCSampler{ratio=%g,rules=%d,errors=%t}", s.ratio.Load().value, len(s.cfg.Rules), s.cfg.SampleErrors)
+}
+
+// errorSpanProcessor exports record-only spans that ended with an error by
+// handing them to the next processor marked as sampled.
+type errorSpanProcessor struct {
+	sdktrace.SpanProcessor
+}
+
+func (p errorSpanProcessor) OnEnd(s sdktrace.ReadOnlySpan) {
+	if !s.SpanContext().IsSampled() && failed(s) {
+		s = keptSpan{s}
+	}
+	p.SpanProcessor.OnEnd(s)
+}
+
+func failed(s sdktrace.ReadOnlySpan) bool {
+	if s.Status().Code == codes.Error {
+		return true
+	}
+	for _, attr := range s.Attributes() {
+		if attr.Key == semconv.HTTPResponseStatusCodeKey && attr.Value.Type() == attribute.INT64 {
+			return attr.Value.AsInt64() >= http.StatusInternalServerError
+		}
+	}
+	return false
+}
+
+type keptSpan struct {
+	sdktrace.ReadOnlySpan
+}
+
+func (s keptSpan) SpanContext() trace.SpanContext {
+	sc := s.ReadOnlySpan.SpanContext()
+	return sc.WithTraceFlags(sc.TraceFlags().WithSampled(true))
+}
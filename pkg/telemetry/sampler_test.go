@@ -0,0 +1,176 @@
+package telemetry
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func newSampledProvider(cfg SamplingConfig) (*sdktrace.TracerProvider, *tracetest.InMemoryExporter) {
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithSampler(NewSampler(cfg)),
+		sdktrace.WithSpanProcessor(errorSpanProcessor{sdktrace.NewSimpleSpanProcessor(exporter)}),
+	)
+	return tp, exporter
+}
+
+func spanNames(exporter *tracetest.InMemoryExporter) []string {
+	var names []string
+	for _, span := range exporter.GetSpans() {
+		names = append(names, span.Name)
+	}
+	return names
+}
+
+func TestParseSamplingRules(t *testing.T) {
+	rules, err := ParseSamplingRules("post /temperature=errors; GET /healthz=never;/=0.5")
+
+	assert.Nil(t, err)
+	assert.Len(t, rules, 3)
+	assert.Equal(t, "POST", rules[0].Method)
+	assert.Equal(t, "/temperature", rules[0].Route)
+	assert.Equal(t, DecisionErrors, rules[0].Decision)
+	assert.Equal(t, "", rules[2].Method)
+	assert.Equal(t, 0.5, rules[2].ratio)
+	assert.Equal(t, "POST /temperature=errors;GET /healthz=never;/=0.5", rules.String())
+}
+
+func TestParseSamplingRules_Invalid(t *testing.T) {
+	for _, value := range []string{"POST /temperature", "POST /temperature=sometimes", "/=2", "a b c=always"} {
+		_, err := ParseSamplingRules(value)
+		assert.NotNil(t, err, value)
+	}
+}
+
+func TestSampler_Ratio(t *testing.T) {
+	tp, exporter := newSampledProvider(SamplingConfig{Ratio: 0})
+
+	_, span := tp.Tracer("test").Start(context.TODO(), "dropped")
+	span.End()
+
+	assert.Empty(t, exporter.GetSpans())
+	assert.False(t, span.IsRecording())
+}
+
+func TestSetSamplingRatio(t *testing.T) {
+	s := newSampler(SamplingConfig{Ratio: 0})
+	activeSampler.Store(s)
+	t.Cleanup(func() { activeSampler.Store(nil) })
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSampler(s))
+
+	assert.NotNil(t, SetSamplingRatio(1.5))
+	assert.Nil(t, SetSamplingRatio(1))
+	_, span := tp.Tracer("test").Start(context.TODO(), "sampled")
+
+	assert.True(t, span.SpanContext().IsSampled())
+	assert.Equal(t, "FCSampler{ratio=1,rules=0,errors=false}", s.Description())
+}
+
+func TestSampler_ParentBased(t *testing.T) {
+	tp, exporter := newSampledProvider(SamplingConfig{Ratio: 0})
+	parent := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    trace.TraceID{1},
+		SpanID:     trace.SpanID{1},
+		TraceFlags: trace.FlagsSampled,
+		Remote:     true,
+	})
+
+	_, span := tp.Tracer("test").Start(trace.ContextWithRemoteSpanContext(context.TODO(), parent), "child")
+	span.End()
+
+	assert.Equal(t, []string{"child"}, spanNames(exporter))
+}
+
+func TestSampler_SampleErrors(t *testing.T) {
+	tp, exporter := newSampledProvider(SamplingConfig{Ratio: 0, SampleErrors: true})
+	tr := tp.Tracer("test")
+
+	_, ok := tr.Start(context.TODO(), "ok")
+	ok.End()
+	_, failing := tr.Start(context.TODO(), "failing")
+	failing.SetStatus(codes.Error, "boom")
+	failing.End()
+
+	assert.Equal(t, []string{"failing"}, spanNames(exporter))
+	assert.True(t, exporter.GetSpans()[0].SpanContext.IsSampled())
+}
+
+func TestSampler_SampleErrors_Parents(t *testing.T) {
+	tp, exporter := newSampledProvider(SamplingConfig{Ratio: 0, SampleErrors: true})
+	tr := tp.Tracer("test")
+
+	ctx, root := tr.Start(context.TODO(), "root")
+	_, child := tr.Start(ctx, "child")
+	child.SetStatus(codes.Error, "boom")
+	child.End()
+	root.End()
+
+	// The failed child is kept alone, pointing at its dropped local root.
+	spans := exporter.GetSpans()
+	assert.Equal(t, []string{"child"}, spanNames(exporter))
+	assert.Equal(t, root.SpanContext().SpanID(), spans[0].Parent.SpanID())
+	assert.False(t, spans[0].Parent.IsRemote())
+
+	exporter.Reset()
+	dropped := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID: trace.TraceID{1},
+		SpanID:  trace.SpanID{1},
+		Remote:  true,
+	})
+	_, remote := tr.Start(trace.ContextWithRemoteSpanContext(context.TODO(), dropped), "remote child")
+	remote.SetStatus(codes.Error, "boom")
+	remote.End()
+
+	assert.Empty(t, exporter.GetSpans())
+}
+
+func TestSampler_Rules(t *testing.T) {
+	rules, err := ParseSamplingRules("POST /temperature=errors;GET /healthz=never;GET /debug=always")
+	assert.Nil(t, err)
+	tp, exporter := newSampledProvider(SamplingConfig{Ratio: 1, Rules: rules})
+	tr := tp.Tracer("test")
+
+	_, health := tr.Start(context.TODO(), "GET /healthz")
+	health.End()
+	_, temperature := tr.Start(context.TODO(), "temperature", trace.WithAttributes(
+		semconv.HTTPRequestMethodKey.String(http.MethodPost),
+		semconv.HTTPRoute("/temperature"),
+	))
+	temperature.End()
+
+	assert.Equal(t, []string{"temperature"}, spanNames(exporter))
+
+	tp, exporter = newSampledProvider(SamplingConfig{Ratio: 0, Rules: rules})
+	tr = tp.Tracer("test")
+	_, debug := tr.Start(context.TODO(), "GET /debug")
+	debug.End()
+	_, ok := tr.Start(context.TODO(), "POST /temperature")
+	ok.End()
+	_, failing := tr.Start(context.TODO(), "POST /temperature", trace.WithAttributes(semconv.HTTPResponseStatusCode(http.StatusInternalServerError)))
+	failing.End()
+
+	assert.Equal(t, []string{"GET /debug", "POST /temperature"}, spanNames(exporter))
+}
+
+func TestDebugHeader(t *testing.T) {
+	tp, exporter := newSampledProvider(SamplingConfig{Ratio: 0})
+	handler := DebugHeader("X-Debug-Trace")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, span := tp.Tracer("test").Start(r.Context(), "handler")
+		span.End()
+	}))
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/", nil))
+	req := httptest.NewRequest(http.MethodPost, "/", nil)
+	req.Header.Set("X-Debug-Trace", "1")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	assert.Len(t, exporter.GetSpans(), 1)
+}
@@ -0,0 +1,305 @@
+package telemetry
+
+import (
+	"context"
+	"fmt"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultTailMaxTraces        = 1000
+	defaultTailMaxSpansPerTrace = 256
+	defaultTailDecisionWait     = 30 * time.Second
+)
+
+// TailSamplingConfig controls the tail sampling span processor. Traces the
+// head sampler did not sample are buffered until their local root span ends
+// and then exported only when one of the conditions below holds.
+type TailSamplingConfig struct {
+	Enabled bool
+	// Latency keeps traces whose local root span took at least this long.
+	Latency time.Duration
+	// Errors keeps traces with at least one span with an error status.
+	Errors bool
+	// Attributes keeps traces with a span carrying one of the attributes.
+	Attributes AttributeRules
+	// MaxTraces bounds how many undecided traces are held in memory; the
+	// oldest one is evicted when it is reached.
+	MaxTraces int
+	// MaxSpansPerTrace bounds how many spans are held for one trace.
+	MaxSpansPerTrace int
+	// DecisionWait evicts traces whose root span has not ended in time.
+	DecisionWait time.Duration
+}
+
+func (c TailSamplingConfig) validate() error {
+	if c.Latency < 0 {
+		return fmt.Errorf("telemetry: tail sampling latency must not be negative, got %s", c.Latency)
+	}
+	if c.MaxTraces < 0 {
+		return fmt.Errorf("telemetry: tail sampling max traces must not be negative, got %d", c.MaxTraces)
+	}
+	if c.MaxSpansPerTrace < 0 {
+		return fmt.Errorf("telemetry: tail sampling max spans must not be negative, got %d", c.MaxSpansPerTrace)
+	}
+	if c.DecisionWait < 0 {
+		return fmt.Errorf("telemetry: tail sampling decision wait must not be negative, got %s", c.DecisionWait)
+	}
+	return nil
+}
+
+// AttributeRule matches a span attribute by key and, if Value is set, by
+// its string value.
+type AttributeRule struct {
+	Key   string
+	Value string
+}
+
+// AttributeRules is written as comma separated "key" or "key=value" entries.
+type AttributeRules []AttributeRule
+
+func (r *AttributeRules) String() string {
+	if r == nil {
+		return ""
+	}
+	rules := make([]string, 0, len(*r))
+	for _, rule := range *r {
+		if rule.Value == "" {
+			rules = append(rules, rule.Key)
+			continue
+		}
+		rules = append(rules, rule.Key+"="+rule.Value)
+	}
+	return strings.Join(rules, ",")
+}
+
+func (r *AttributeRules) Set(value string) error {
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		key, val, _ := strings.Cut(entry, "=")
+		if strings.TrimSpace(key) == "" {
+			return fmt.Errorf("invalid attribute rule %q, expected key or key=value", entry)
+		}
+		*r = append(*r, AttributeRule{Key: strings.TrimSpace(key), Value: strings.TrimSpace(val)})
+	}
+	return nil
+}
+
+func (r AttributeRule) matches(attrs []attribute.KeyValue) bool {
+	for _, attr := range attrs {
+		if string(attr.Key) == r.Key && (r.Value == "" || attr.Value.Emit() == r.Value) {
+			return true
+		}
+	}
+	return false
+}
+
+// TailSamplingStats is a snapshot of the processor counters.
+type TailSamplingStats struct {
+	Buffered     int
+	KeptTraces   int64
+	DroppedSpans int64
+	Evicted      int64
+}
+
+type bufferedTrace struct {
+	spans   []sdktrace.ReadOnlySpan
+	keep    bool
+	started time.Time
+}
+
+// TailSamplingProcessor buffers the spans of unsampled traces and forwards
+// the interesting ones to the next processor once their local root ends.
+type TailSamplingProcessor struct {
+	next sdktrace.SpanProcessor
+	cfg  TailSamplingConfig
+	now  func() time.Time
+
+	mu     sync.Mutex
+	traces map[trace.TraceID]*bufferedTrace
+	order  []trace.TraceID
+	stats  TailSamplingStats
+
+	keptCounter    metric.Int64Counter
+	droppedCounter metric.Int64Counter
+	evictedCounter metric.Int64Counter
+}
+
+// NewTailSamplingProcessor wraps next, usually a BatchSpanProcessor.
+func NewTailSamplingProcessor(next sdktrace.SpanProcessor, cfg TailSamplingConfig) *TailSamplingProcessor {
+	if cfg.MaxTraces <= 0 {
+		cfg.MaxTraces = defaultTailMaxTraces
+	}
+	if cfg.MaxSpansPerTrace <= 0 {
+		cfg.MaxSpansPerTrace = defaultTailMaxSpansPerTrace
+	}
+	if cfg.DecisionWait <= 0 {
+		cfg.DecisionWait = defaultTailDecisionWait
+	}
+	p := &TailSamplingProcessor{
+		next:   next,
+		cfg:    cfg,
+		now:    time.Now,
+		traces: map[trace.TraceID]*bufferedTrace{},
+	}
+
+	meter := otel.Meter(instrumentationName)
+	p.keptCounter, _ = meter.Int64Counter("tailsampling.traces.kept",
+		metric.WithDescription("Unsampled traces kept by the tail sampler"))
+	p.droppedCounter, _ = meter.Int64Counter("tailsampling.spans.dropped",
+		metric.WithDescription("Spans discarded by the tail sampler"))
+	p.evictedCounter, _ = meter.Int64Counter("tailsampling.traces.evicted",
+		metric.WithDescription("Traces evicted from the tail sampler buffer before a decision"))
+	_, _ = meter.Int64ObservableGauge("tailsampling.traces.buffered",
+		metric.WithDescription("Traces waiting for a tail sampling decision"),
+		metric.WithInt64Callback(func(_ context.Context, o metric.Int64Observer) error {
+			o.Observe(int64(p.Stats().Buffered))
+			return nil
+		}))
+	return p
+}
+
+func (p *TailSamplingProcessor) OnStart(parent context.Context, s sdktrace.ReadWriteSpan) {
+	p.next.OnStart(parent, s)
+}
+
+func (p *TailSamplingProcessor) OnEnd(s sdktrace.ReadOnlySpan) {
+	if s.SpanContext().IsSampled() {
+		p.next.OnEnd(s)
+		return
+	}
+
+	p.mu.Lock()
+	forward, dropped := p.record(s)
+	p.mu.Unlock()
+
+	for _, span := range forward {
+		p.next.OnEnd(keptSpan{span})
+	}
+	if dropped > 0 {
+		p.droppedCounter.Add(context.Background(), dropped)
+	}
+}
+
+// record buffers s and, when s is the local root, decides the trace. It
+// returns the spans to forward and the number of spans dropped.
+func (p *TailSamplingProcessor) record(s sdktrace.ReadOnlySpan) ([]sdktrace.ReadOnlySpan, int64) {
+	id := s.SpanContext().TraceID()
+	p.evictExpired()
+
+	t, ok := p.traces[id]
+	if !ok {
+		p.evictOldest()
+		t = &bufferedTrace{started: p.now()}
+		p.traces[id] = t
+		p.order = append(p.order, id)
+	}
+
+	if len(t.spans) < p.cfg.MaxSpansPerTrace {
+		t.spans = append(t.spans, s)
+	} else {
+		p.stats.DroppedSpans++
+		p.droppedCounter.Add(context.Background(), 1)
+	}
+	t.keep = t.keep || p.interesting(s)
+
+	if s.Parent().IsValid() && !s.Parent().IsRemote() {
+		return nil, 0
+	}
+
+	p.remove(id)
+	if t.keep {
+		p.stats.KeptTraces++
+		p.keptCounter.Add(context.Background(), 1)
+		return t.spans, 0
+	}
+	p.stats.DroppedSpans += int64(len(t.spans))
+	return nil, int64(len(t.spans))
+}
+
+func (p *TailSamplingProcessor) interesting(s sdktrace.ReadOnlySpan) bool {
+	if p.cfg.Errors && s.Status().Code == codes.Error {
+		return true
+	}
+	root := !s.Parent().IsValid() || s.Parent().IsRemote()
+	if root && p.cfg.Latency > 0 && s.EndTime().Sub(s.StartTime()) >= p.cfg.Latency {
+		return true
+	}
+	for _, rule := range p.cfg.Attributes {
+		if rule.matches(s.Attributes()) {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *TailSamplingProcessor) evictOldest() {
+	for len(p.traces) >= p.cfg.MaxTraces && len(p.order) > 0 {
+		p.evict(p.order[0])
+	}
+}
+
+func (p *TailSamplingProcessor) evictExpired() {
+	deadline := p.now().Add(-p.cfg.DecisionWait)
+	for len(p.order) > 0 {
+		t := p.traces[p.order[0]]
+		if t != nil && t.started.After(deadline) {
+			return
+		}
+		p.evict(p.order[0])
+	}
+}
+
+func (p *TailSamplingProcessor) evict(id trace.TraceID) {
+	if t, ok := p.traces[id]; ok {
+		p.stats.Evicted++
+		p.stats.DroppedSpans += int64(len(t.spans))
+		p.evictedCounter.Add(context.Background(), 1)
+		p.droppedCounter.Add(context.Background(), int64(len(t.spans)))
+	}
+	p.remove(id)
+}
+
+func (p *TailSamplingProcessor) remove(id trace.TraceID) {
+	delete(p.traces, id)
+	for i, o := range p.order {
+		if o == id {
+			p.order = append(p.order[:i], p.order[i+1:]...)
+			break
+		}
+	}
+}
+
+// Stats returns a snapshot of the processor counters.
+func (p *TailSamplingProcessor) Stats() TailSamplingStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	stats := p.stats
+	stats.Buffered = len(p.traces)
+	return stats
+}
+
+// Shutdown drops the undecided traces and shuts down the next processor.
+func (p *TailSamplingProcessor) Shutdown(ctx context.Context) error {
+	p.mu.Lock()
+	for _, id := range append([]trace.TraceID(nil), p.order...) {
+		p.evict(id)
+	}
+	p.mu.Unlock()
+	return p.next.Shutdown(ctx)
+}
+
+func (p *TailSamplingProcessor) ForceFlush(ctx context.Context) error {
+	return p.next.ForceFlush(ctx)
+}
@@ -0,0 +1,168 @@
+package telemetry
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"testing"
+	"time"
+)
+
+func newTailSampledProvider(cfg TailSamplingConfig) (*sdktrace.TracerProvider, *TailSamplingProcessor, *tracetest.InMemoryExporter) {
+	exporter := tracetest.NewInMemoryExporter()
+	processor := NewTailSamplingProcessor(sdktrace.NewSimpleSpanProcessor(exporter), cfg)
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithSampler(NewSampler(SamplingConfig{Ratio: 0, recordAll: true})),
+		sdktrace.WithSpanProcessor(processor),
+	)
+	return tp, processor, exporter
+}
+
+func TestTailSampling_KeepsFailedTraces(t *testing.T) {
+	tp, processor, exporter := newTailSampledProvider(TailSamplingConfig{Enabled: true, Errors: true})
+	tr := tp.Tracer("test")
+
+	ctx, root := tr.Start(context.TODO(), "root")
+	_, child := tr.Start(ctx, "Viacep")
+	child.SetStatus(codes.Error, "error city notfound")
+	child.End()
+
+	assert.Empty(t, exporter.GetSpans())
+	assert.Equal(t, 1, processor.Stats().Buffered)
+
+	root.End()
+
+	assert.Equal(t, []string{"Viacep", "root"}, spanNames(exporter))
+	for _, span := range exporter.GetSpans() {
+		assert.True(t, span.SpanContext.IsSampled())
+	}
+	assert.Equal(t, TailSamplingStats{KeptTraces: 1}, processor.Stats())
+}
+
+func TestTailSampling_DropsUninterestingTraces(t *testing.T) {
+	tp, processor, exporter := newTailSampledProvider(TailSamplingConfig{Enabled: true, Errors: true, Latency: time.Hour})
+	tr := tp.Tracer("test")
+
+	ctx, root := tr.Start(context.TODO(), "root")
+	_, child := tr.Start(ctx, "WeatherAPI")
+	child.End()
+	root.End()
+
+	assert.Empty(t, exporter.GetSpans())
+	assert.Equal(t, TailSamplingStats{DroppedSpans: 2}, processor.Stats())
+}
+
+func TestTailSampling_KeepsSlowTraces(t *testing.T) {
+	tp, _, exporter := newTailSampledProvider(TailSamplingConfig{Enabled: true, Latency: time.Second})
+	tr := tp.Tracer("test")
+	start := time.Now()
+
+	ctx, root := tr.Start(context.TODO(), "root", trace.WithTimestamp(start))
+	_, child := tr.Start(ctx, "WeatherAPI", trace.WithTimestamp(start))
+	child.End(trace.WithTimestamp(start.Add(2 * time.Second)))
+	root.End(trace.WithTimestamp(start.Add(2 * time.Second)))
+
+	assert.Equal(t, []string{"WeatherAPI", "root"}, spanNames(exporter))
+}
+
+func TestTailSampling_LatencyOfRootSpan(t *testing.T) {
+	tp, _, exporter := newTailSampledProvider(TailSamplingConfig{Enabled: true, Latency: time.Second})
+	tr := tp.Tracer("test")
+	start := time.Now()
+
+	ctx, root := tr.Start(context.TODO(), "root", trace.WithTimestamp(start))
+	_, child := tr.Start(ctx, "WeatherAPI", trace.WithTimestamp(start))
+	child.End(trace.WithTimestamp(start.Add(2 * time.Second)))
+	root.End(trace.WithTimestamp(start.Add(500 * time.Millisecond)))
+
+	assert.Empty(t, exporter.GetSpans())
+
+	remote := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID: trace.TraceID{1},
+		SpanID:  trace.SpanID{1},
+		Remote:  true,
+	})
+	_, server := tr.Start(trace.ContextWithRemoteSpanContext(context.TODO(), remote), "POST /temperature", trace.WithTimestamp(start))
+	server.End(trace.WithTimestamp(start.Add(2 * time.Second)))
+
+	assert.Equal(t, []string{"POST /temperature"}, spanNames(exporter))
+}
+
+func TestTailSampling_KeepsByAttribute(t *testing.T) {
+	var rules AttributeRules
+	assert.Nil(t, rules.Set("upstream.outcome=bad_response, debug"))
+	tp, _, exporter := newTailSampledProvider(TailSamplingConfig{Enabled: true, Attributes: rules})
+	tr := tp.Tracer("test")
+
+	_, other := tr.Start(context.TODO(), "other", trace.WithAttributes(attribute.String("upstream.outcome", "ok")))
+	other.End()
+	_, kept := tr.Start(context.TODO(), "kept", trace.WithAttributes(attribute.String("upstream.outcome", "bad_response")))
+	kept.End()
+
+	assert.Equal(t, []string{"kept"}, spanNames(exporter))
+	assert.Equal(t, "upstream.outcome=bad_response,debug", rules.String())
+}
+
+func TestTailSampling_ForwardsHeadSampledSpans(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	processor := NewTailSamplingProcessor(sdktrace.NewSimpleSpanProcessor(exporter), TailSamplingConfig{Enabled: true})
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(processor))
+
+	ctx, root := tp.Tracer("test").Start(context.TODO(), "root")
+	_, child := tp.Tracer("test").Start(ctx, "child")
+	child.End()
+
+	assert.Equal(t, []string{"child"}, spanNames(exporter))
+	root.End()
+	assert.Equal(t, 0, processor.Stats().Buffered)
+}
+
+func TestTailSampling_BoundedMemory(t *testing.T) {
+	tp, processor, exporter := newTailSampledProvider(TailSamplingConfig{Enabled: true, Errors: true, MaxTraces: 2, MaxSpansPerTrace: 1})
+	tr := tp.Tracer("test")
+
+	var roots []trace.Span
+	for i := 0; i < 3; i++ {
+		ctx, root := tr.Start(context.TODO(), "root")
+		_, child := tr.Start(ctx, "child")
+		child.End()
+		roots = append(roots, root)
+	}
+
+	stats := processor.Stats()
+	assert.Equal(t, 2, stats.Buffered)
+	assert.Equal(t, int64(1), stats.Evicted)
+
+	ctx := trace.ContextWithSpan(context.TODO(), roots[2])
+	_, extra := tr.Start(ctx, "extra")
+	extra.SetStatus(codes.Error, "boom")
+	extra.End()
+	roots[2].End()
+
+	assert.Equal(t, []string{"child"}, spanNames(exporter))
+	assert.Equal(t, int64(3), processor.Stats().DroppedSpans)
+}
+
+func TestTailSampling_EvictsExpiredTraces(t *testing.T) {
+	tp, processor, _ := newTailSampledProvider(TailSamplingConfig{Enabled: true, DecisionWait: time.Minute})
+	now := time.Now()
+	processor.now = func() time.Time { return now }
+	tr := tp.Tracer("test")
+
+	ctx, root := tr.Start(context.TODO(), "root")
+	_, child := tr.Start(ctx, "child")
+	child.End()
+	defer root.End()
+
+	now = now.Add(2 * time.Minute)
+	_, other := tr.Start(context.TODO(), "other")
+	other.End()
+
+	stats := processor.Stats()
+	assert.Equal(t, 0, stats.Buffered)
+	assert.Equal(t, int64(1), stats.Evicted)
+}
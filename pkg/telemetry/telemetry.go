@@ -0,0 +1,377 @@
+package telemetry
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"os"
+	"strconv"
+	"time"
+	"willianszwy/FC-Tracing/pkg/tracing"
+)
+
+const instrumentationName = "willianszwy/FC-Tracing/pkg/telemetry"
+
+const (
+	defaultZipkinURL   = "http://zipkin:9411/api/v2/spans"
+	defaultDebugHeader = "X-Debug-Trace"
+)
+
+// Config holds everything needed to bootstrap telemetry for a service.
+type Config struct {
+	ServiceName    string
+	ServiceVersion string
+	Environment    string
+	ZipkinURL      string
+	Exporter       ExporterConfig
+	Sampling       SamplingConfig
+	TailSampling   TailSamplingConfig
+	Propagators    Propagators
+	Metrics        MetricsConfig
+	Logs           LogsConfig
+	// PIIMode controls how personal data is written to span attributes.
+	PIIMode tracing.PIIMode
+	// PIIHashKey keys the HMAC written in the hash PII mode, which needs it.
+	PIIHashKey string
+}
+
+// Shutdown flushes and stops every provider created by Setup.
+type Shutdown func(context.Context) error
+
+// ConfigFromEnv returns a Config for serviceName with values taken from the
+// standard OTEL_* variables when they are set.
+func ConfigFromEnv(serviceName string) (Config, error) {
+	headers, err := ParseHeaders(os.Getenv("OTEL_EXPORTER_OTLP_HEADERS"))
+	if err != nil {
+		return Config{}, fmt.Errorf("OTEL_EXPORTER_OTLP_HEADERS: %w", err)
+	}
+	insecure, err := getEnvBool("OTEL_EXPORTER_OTLP_INSECURE", false)
+	if err != nil {
+		return Config{}, err
+	}
+	ratio, err := getEnvFloat("OTEL_TRACES_SAMPLER_ARG", 1)
+	if err != nil {
+		return Config{}, err
+	}
+	sampleErrors, err := getEnvBool("OTEL_SAMPLING_ERRORS", true)
+	if err != nil {
+		return Config{}, err
+	}
+	rules, err := ParseSamplingRules(os.Getenv("OTEL_SAMPLING_RULES"))
+	if err != nil {
+		return Config{}, fmt.Errorf("OTEL_SAMPLING_RULES: %w", err)
+	}
+	tail, err := tailSamplingFromEnv()
+	if err != nil {
+		return Config{}, err
+	}
+	piiMode, err := tracing.ParsePIIMode(getEnv("TRACE_PII_MODE", string(tracing.PIIMask)))
+	if err != nil {
+		return Config{}, fmt.Errorf("TRACE_PII_MODE: %w", err)
+	}
+	metrics, err := metricsFromEnv()
+	if err != nil {
+		return Config{}, err
+	}
+	propagators := defaultPropagators
+	if v := os.Getenv("OTEL_PROPAGATORS"); v != "" {
+		if propagators, err = ParsePropagators(v); err != nil {
+			return Config{}, fmt.Errorf("OTEL_PROPAGATORS: %w", err)
+		}
+	}
+	return Config{
+		ServiceName:    getEnv("OTEL_SERVICE_NAME", serviceName),
+		ServiceVersion: os.Getenv("SERVICE_VERSION"),
+		Environment:    os.Getenv("DEPLOYMENT_ENVIRONMENT"),
+		ZipkinURL:      getEnv("OTEL_EXPORTER_ZIPKIN_ENDPOINT", defaultZipkinURL),
+		Exporter: ExporterConfig{
+			Name:        getEnv("OTEL_TRACES_EXPORTER", ExporterZipkin),
+			Endpoint:    os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT"),
+			Headers:     headers,
+			Compression: getEnv("OTEL_EXPORTER_OTLP_COMPRESSION", CompressionNone),
+			Insecure:    insecure,
+		},
+		Sampling: SamplingConfig{
+			Ratio:        ratio,
+			DebugHeader:  getEnv("OTEL_SAMPLING_DEBUG_HEADER", defaultDebugHeader),
+			SampleErrors: sampleErrors,
+			Rules:        rules,
+		},
+		TailSampling: tail,
+		Propagators:  propagators,
+		Metrics:      metrics,
+		Logs:         logsFromEnv(),
+		PIIMode:      piiMode,
+		PIIHashKey:   os.Getenv("TRACE_PII_HASH_KEY"),
+	}, nil
+}
+
+func tailSamplingFromEnv() (TailSamplingConfig, error) {
+	var cfg TailSamplingConfig
+	var err error
+	if cfg.Enabled, err = getEnvBool("OTEL_TAIL_SAMPLING_ENABLED", false); err != nil {
+		return cfg, err
+	}
+	if cfg.Latency, err = getEnvDuration("OTEL_TAIL_SAMPLING_LATENCY", time.Second); err != nil {
+		return cfg, err
+	}
+	if cfg.Errors, err = getEnvBool("OTEL_TAIL_SAMPLING_ERRORS", true); err != nil {
+		return cfg, err
+	}
+	if err = cfg.Attributes.Set(os.Getenv("OTEL_TAIL_SAMPLING_ATTRIBUTES")); err != nil {
+		return cfg, fmt.Errorf("OTEL_TAIL_SAMPLING_ATTRIBUTES: %w", err)
+	}
+	if cfg.MaxTraces, err = getEnvInt("OTEL_TAIL_SAMPLING_MAX_TRACES", defaultTailMaxTraces); err != nil {
+		return cfg, err
+	}
+	if cfg.MaxSpansPerTrace, err = getEnvInt("OTEL_TAIL_SAMPLING_MAX_SPANS", defaultTailMaxSpansPerTrace); err != nil {
+		return cfg, err
+	}
+	if cfg.DecisionWait, err = getEnvDuration("OTEL_TAIL_SAMPLING_DECISION_WAIT", defaultTailDecisionWait); err != nil {
+		return cfg, err
+	}
+	return cfg, nil
+}
+
+// RegisterFlags binds the config fields to fs, using the current values as
+// defaults so flags take precedence over the environment.
+func (c *Config) RegisterFlags(fs *flag.FlagSet) {
+	fs.StringVar(&c.ServiceName, "service-name", c.ServiceName, "service name reported on telemetry")
+	fs.StringVar(&c.ZipkinURL, "zipkin", c.ZipkinURL, "zipkin url")
+	fs.StringVar(&c.Exporter.Name, "traces-exporter", c.Exporter.Name, "span exporter: zipkin, otlp-grpc, otlp-http, stdout or none")
+	fs.StringVar(&c.Exporter.Endpoint, "otlp-endpoint", c.Exporter.Endpoint, "otlp collector endpoint")
+	if c.Exporter.Headers == nil {
+		c.Exporter.Headers = Headers{}
+	}
+	fs.Var(c.Exporter.Headers, "otlp-headers", "otlp headers as key=value pairs separated by commas")
+	fs.StringVar(&c.Exporter.Compression, "otlp-compression", c.Exporter.Compression, "otlp compression: gzip or none")
+	fs.BoolVar(&c.Exporter.Insecure, "otlp-insecure", c.Exporter.Insecure, "disable TLS for the otlp exporter")
+	fs.Float64Var(&c.Sampling.Ratio, "sampler-ratio", c.Sampling.Ratio, "ratio of new traces that are sampled")
+	fs.StringVar(&c.Sampling.DebugHeader, "sampler-debug-header", c.Sampling.DebugHeader, "request header that forces sampling")
+	fs.BoolVar(&c.Sampling.SampleErrors, "sampler-errors", c.Sampling.SampleErrors, "always keep spans that end with an error")
+	fs.Func("pii-mode", "how personal data is written to spans: plain, mask, hash or drop", func(value string) error {
+		m, err := tracing.ParsePIIMode(value)
+		c.PIIMode = m
+		return err
+	})
+	fs.Var(&c.Propagators, "propagators", "context propagation formats: tracecontext, baggage, b3, b3multi, jaeger or none")
+	fs.BoolVar(&c.TailSampling.Enabled, "tail-sampling", c.TailSampling.Enabled, "buffer unsampled traces and keep the slow or failed ones")
+	fs.DurationVar(&c.TailSampling.Latency, "tail-sampling-latency", c.TailSampling.Latency, "keep traces whose root span takes at least this long")
+	fs.BoolVar(&c.TailSampling.Errors, "tail-sampling-errors", c.TailSampling.Errors, "keep traces with a failed span")
+	fs.Var(&c.TailSampling.Attributes, "tail-sampling-attributes", "keep traces with a span carrying one of these key or key=value attributes")
+	fs.IntVar(&c.TailSampling.MaxTraces, "tail-sampling-max-traces", c.TailSampling.MaxTraces, "maximum number of traces buffered by the tail sampler")
+	fs.BoolVar(&c.Metrics.Prometheus, "metrics-prometheus", c.Metrics.Prometheus, "serve metrics in the prometheus format")
+	fs.StringVar(&c.Metrics.Exporter, "metrics-exporter", c.Metrics.Exporter, "metrics push exporter: otlp-grpc, otlp-http or none")
+	fs.DurationVar(&c.Metrics.Interval, "metrics-interval", c.Metrics.Interval, "interval between two metrics pushes")
+	fs.StringVar(&c.Logs.Exporter, "logs-exporter", c.Logs.Exporter, "log record exporter: otlp-grpc, otlp-http, stdout, file or none")
+	fs.StringVar(&c.Logs.File, "logs-file", c.Logs.File, "file the file logs exporter appends to")
+	fs.Var(&c.Sampling.Rules, "sampler-rules", "per route sampling rules, e.g. \"POST /temperature=errors;GET /healthz=never\"")
+}
+
+// Validate reports the first setting that would prevent Setup from working.
+func (c *Config) Validate() error {
+	if c.ServiceName == "" {
+		return errors.New("telemetry: service name is required")
+	}
+	switch c.Exporter.Name {
+	case ExporterZipkin:
+		if c.ZipkinURL == "" {
+			return errors.New("telemetry: zipkin url is required for the zipkin exporter")
+		}
+	case ExporterOTLPGRPC, ExporterOTLPHTTP, ExporterStdout, ExporterNone:
+	default:
+		return fmt.Errorf("telemetry: unknown exporter %q", c.Exporter.Name)
+	}
+	if !validCompression(c.Exporter.Compression) {
+		return fmt.Errorf("telemetry: unknown compression %q", c.Exporter.Compression)
+	}
+	if err := c.Metrics.validate(); err != nil {
+		return err
+	}
+	if err := c.Logs.validate(); err != nil {
+		return err
+	}
+	if err := c.TailSampling.validate(); err != nil {
+		return err
+	}
+	if c.PIIMode != "" {
+		if _, err := tracing.ParsePIIMode(string(c.PIIMode)); err != nil {
+			return fmt.Errorf("telemetry: %w", err)
+		}
+	}
+	if c.PIIMode == tracing.PIIHash && c.PIIHashKey == "" {
+		return errors.New("telemetry: the hash pii mode needs TRACE_PII_HASH_KEY")
+	}
+	if c.Sampling.Ratio < 0 || c.Sampling.Ratio > 1 {
+		return fmt.Errorf("telemetry: sampler ratio must be between 0 and 1, got %g", c.Sampling.Ratio)
+	}
+	return nil
+}
+
+// Setup configures the global tracer, meter and logger providers and the
+// propagator and returns a single handle that shuts all of them down.
+func Setup(ctx context.Context, cfg Config) (Shutdown, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	names := cfg.Propagators
+	if len(names) == 0 {
+		names = defaultPropagators
+	}
+	propagator, err := NewPropagator(names)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := newResource(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	exporter, err := newSpanExporter(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+	mp, handler, err := newMeterProvider(ctx, cfg, res)
+	if err != nil {
+		shutdownExporter(ctx, exporter)
+		return nil, err
+	}
+	logsShutdown, err := setupLogs(ctx, cfg, res)
+	if err != nil {
+		shutdownExporter(ctx, exporter)
+		mp.Shutdown(ctx)
+		return nil, err
+	}
+
+	sampling := cfg.Sampling
+	sampling.recordAll = cfg.TailSampling.Enabled
+	s := newSampler(sampling)
+	activeSampler.Store(s)
+	opts := []sdktrace.TracerProviderOption{
+		sdktrace.WithSampler(s),
+		sdktrace.WithResource(res),
+	}
+	if exporter != nil {
+		opts = append(opts, sdktrace.WithSpanProcessor(newSpanProcessor(cfg, exporter)))
+	}
+	otel.SetMeterProvider(mp)
+	metricsHandler.Store(metricsEndpoint{handler})
+
+	tp := sdktrace.NewTracerProvider(opts...)
+	otel.SetTracerProvider(tp)
+	otel.SetTextMapPropagator(propagator)
+	if cfg.PIIMode != "" {
+		tracing.SetPIIMode(cfg.PIIMode)
+	}
+	tracing.SetPIIHashKey([]byte(cfg.PIIHashKey))
+
+	// Shutdowns run in reverse, so log records written while the other
+	// providers stop are still exported.
+	var shutdowns []Shutdown
+	if logsShutdown != nil {
+		shutdowns = append(shutdowns, logsShutdown)
+	}
+	shutdowns = append(shutdowns, mp.Shutdown, tp.Shutdown)
+
+	return func(ctx context.Context) error {
+		var errs []error
+		for i := len(shutdowns) - 1; i >= 0; i-- {
+			errs = append(errs, shutdowns[i](ctx))
+		}
+		return errors.Join(errs...)
+	}, nil
+}
+
+// shutdownExporter releases an exporter Setup gave up on.
+func shutdownExporter(ctx context.Context, exporter sdktrace.SpanExporter) {
+	if exporter != nil {
+		exporter.Shutdown(ctx)
+	}
+}
+
+func newSpanProcessor(cfg Config, exporter sdktrace.SpanExporter) sdktrace.SpanProcessor {
+	batcher := sdktrace.NewBatchSpanProcessor(exporter)
+	if cfg.TailSampling.Enabled {
+		return NewTailSamplingProcessor(batcher, cfg.TailSampling)
+	}
+	return errorSpanProcessor{batcher}
+}
+
+func newResource(ctx context.Context, cfg Config) (*resource.Resource, error) {
+	opts := []resource.Option{
+		resource.WithSchemaURL(semconv.SchemaURL),
+		resource.WithFromEnv(),
+		resource.WithTelemetrySDK(),
+		resource.WithHost(),
+		resource.WithAttributes(semconv.ServiceName(cfg.ServiceName)),
+	}
+	if cfg.ServiceVersion != "" {
+		opts = append(opts, resource.WithAttributes(semconv.ServiceVersion(cfg.ServiceVersion)))
+	}
+	if cfg.Environment != "" {
+		opts = append(opts, resource.WithAttributes(semconv.DeploymentEnvironment(cfg.Environment)))
+	}
+	return resource.New(ctx, opts...)
+}
+
+func getEnv(key, fallback string) string {
+	if v, ok := os.LookupEnv(key); ok && v != "" {
+		return v
+	}
+	return fallback
+}
+
+func getEnvFloat(key string, fallback float64) (float64, error) {
+	v, ok := os.LookupEnv(key)
+	if !ok || v == "" {
+		return fallback, nil
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", key, err)
+	}
+	return f, nil
+}
+
+func getEnvInt(key string, fallback int) (int, error) {
+	v, ok := os.LookupEnv(key)
+	if !ok || v == "" {
+		return fallback, nil
+	}
+	i, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", key, err)
+	}
+	return i, nil
+}
+
+func getEnvDuration(key string, fallback time.Duration) (time.Duration, error) {
+	v, ok := os.LookupEnv(key)
+	if !ok || v == "" {
+		return fallback, nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", key, err)
+	}
+	return d, nil
+}
+
+func getEnvBool(key string, fallback bool) (bool, error) {
+	v, ok := os.LookupEnv(key)
+	if !ok || v == "" {
+		return fallback, nil
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", key, err)
+	}
+	return b, nil
+}
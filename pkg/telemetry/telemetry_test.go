@@ -0,0 +1,139 @@
+package telemetry
+
+import (
+	"context"
+	"flag"
+	"github.com/stretchr/testify/assert"
+	"path/filepath"
+	"testing"
+	"time"
+	"willianszwy/FC-Tracing/pkg/tracing"
+)
+
+func TestConfigFromEnv(t *testing.T) {
+	t.Setenv("OTEL_SERVICE_NAME", "from-env")
+	t.Setenv("OTEL_EXPORTER_ZIPKIN_ENDPOINT", "http://collector:9411/api/v2/spans")
+
+	cfg, err := ConfigFromEnv("service-a")
+
+	assert.Nil(t, err)
+	assert.Equal(t, "from-env", cfg.ServiceName)
+	assert.Equal(t, "http://collector:9411/api/v2/spans", cfg.ZipkinURL)
+}
+
+func TestConfigFromEnv_Defaults(t *testing.T) {
+	t.Setenv("OTEL_SERVICE_NAME", "")
+	t.Setenv("OTEL_EXPORTER_ZIPKIN_ENDPOINT", "")
+
+	cfg, err := ConfigFromEnv("service-a")
+
+	assert.Nil(t, err)
+	assert.Equal(t, "service-a", cfg.ServiceName)
+	assert.Equal(t, defaultZipkinURL, cfg.ZipkinURL)
+	assert.Equal(t, ExporterZipkin, cfg.Exporter.Name)
+}
+
+func TestConfigFromEnv_OTLP(t *testing.T) {
+	t.Setenv("OTEL_TRACES_EXPORTER", ExporterOTLPGRPC)
+	t.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", "otel-collector:4317")
+	t.Setenv("OTEL_EXPORTER_OTLP_HEADERS", "api-key=secret, tenant=fc")
+	t.Setenv("OTEL_EXPORTER_OTLP_COMPRESSION", CompressionGzip)
+	t.Setenv("OTEL_EXPORTER_OTLP_INSECURE", "true")
+
+	cfg, err := ConfigFromEnv("service-a")
+
+	assert.Nil(t, err)
+	assert.Equal(t, ExporterConfig{
+		Name:        ExporterOTLPGRPC,
+		Endpoint:    "otel-collector:4317",
+		Headers:     Headers{"api-key": "secret", "tenant": "fc"},
+		Compression: CompressionGzip,
+		Insecure:    true,
+	}, cfg.Exporter)
+}
+
+func TestConfigFromEnv_InvalidHeaders(t *testing.T) {
+	t.Setenv("OTEL_EXPORTER_OTLP_HEADERS", "missing-value")
+
+	_, err := ConfigFromEnv("service-a")
+
+	assert.NotNil(t, err)
+}
+
+func TestRegisterFlags_OverrideEnv(t *testing.T) {
+	cfg := Config{ServiceName: "service-a", ZipkinURL: defaultZipkinURL, Exporter: ExporterConfig{Name: ExporterZipkin}}
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	cfg.RegisterFlags(fs)
+
+	err := fs.Parse([]string{
+		"-zipkin", "http://localhost:9411/api/v2/spans",
+		"-traces-exporter", ExporterOTLPHTTP,
+		"-otlp-headers", "a=1,b=2",
+		"-otlp-insecure",
+	})
+
+	assert.Nil(t, err)
+	assert.Equal(t, "http://localhost:9411/api/v2/spans", cfg.ZipkinURL)
+	assert.Equal(t, "service-a", cfg.ServiceName)
+	assert.Equal(t, ExporterOTLPHTTP, cfg.Exporter.Name)
+	assert.Equal(t, Headers{"a": "1", "b": "2"}, cfg.Exporter.Headers)
+	assert.True(t, cfg.Exporter.Insecure)
+}
+
+func TestValidate(t *testing.T) {
+	valid := Config{ServiceName: "service-a", ZipkinURL: defaultZipkinURL, Exporter: ExporterConfig{Name: ExporterZipkin}}
+	assert.Nil(t, valid.Validate())
+
+	unknown := valid
+	unknown.Exporter.Name = "jaeger"
+	assert.EqualError(t, unknown.Validate(), `telemetry: unknown exporter "jaeger"`)
+
+	compression := valid
+	compression.Exporter.Compression = "zstd"
+	assert.EqualError(t, compression.Validate(), `telemetry: unknown compression "zstd"`)
+
+	hash := valid
+	hash.PIIMode = tracing.PIIHash
+	assert.EqualError(t, hash.Validate(), "telemetry: the hash pii mode needs TRACE_PII_HASH_KEY")
+	hash.PIIHashKey = "secret"
+	assert.Nil(t, hash.Validate())
+
+	latency := valid
+	latency.TailSampling.Latency = -time.Second
+	assert.EqualError(t, latency.Validate(), "telemetry: tail sampling latency must not be negative, got -1s")
+
+	maxTraces := valid
+	maxTraces.TailSampling.MaxTraces = -1
+	assert.EqualError(t, maxTraces.Validate(), "telemetry: tail sampling max traces must not be negative, got -1")
+}
+
+func TestSetup_MissingServiceName(t *testing.T) {
+	shutdown, err := Setup(context.TODO(), Config{ZipkinURL: defaultZipkinURL, Exporter: ExporterConfig{Name: ExporterZipkin}})
+
+	assert.Nil(t, shutdown)
+	assert.NotNil(t, err)
+}
+
+func TestSetup(t *testing.T) {
+	shutdown, err := Setup(context.TODO(), Config{ServiceName: "service-a", ZipkinURL: defaultZipkinURL, Exporter: ExporterConfig{Name: ExporterZipkin}})
+
+	assert.Nil(t, err)
+	assert.NotNil(t, shutdown)
+	assert.Nil(t, shutdown(context.TODO()))
+}
+
+func TestSetup_FailureLeavesSamplerUntouched(t *testing.T) {
+	cfg := Config{
+		ServiceName: "service-a",
+		Exporter:    ExporterConfig{Name: ExporterStdout},
+		Logs:        LogsConfig{Exporter: ExporterFile, File: filepath.Join(t.TempDir(), "missing", "logs.jsonl")},
+	}
+
+	before := activeSampler.Load()
+
+	shutdown, err := Setup(context.TODO(), cfg)
+
+	assert.Nil(t, shutdown)
+	assert.ErrorContains(t, err, "logs.jsonl")
+	assert.Same(t, before, activeSampler.Load())
+}
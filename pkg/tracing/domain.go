@@ -0,0 +1,113 @@
+package tracing
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"go.opentelemetry.io/otel/attribute"
+	"strings"
+	"sync/atomic"
+)
+
+// Attributes describing the zipcode to temperature flow.
+const (
+	ZipcodeKey               = attribute.Key("zipcode")
+	CityNameKey              = attribute.Key("city.name")
+	CityStateKey             = attribute.Key("city.state")
+	UpstreamProviderKey      = attribute.Key("upstream.provider")
+	UpstreamStatusCodeKey    = attribute.Key("upstream.http.status_code")
+	CacheHitKey              = attribute.Key("cache.hit")
+	TemperatureCelsiusKey    = attribute.Key("temperature.celsius")
+	TemperatureFahrenheitKey = attribute.Key("temperature.fahrenheit")
+	TemperatureKelvinKey     = attribute.Key("temperature.kelvin")
+)
+
+// Span events of the zipcode to temperature flow.
+const (
+	EventValidationPassed = "validation.passed"
+	EventCityResolved     = "city.resolved"
+	EventWeatherFetched   = "weather.fetched"
+)
+
+// PIIMode decides how personal data such as the zipcode is written to spans.
+type PIIMode string
+
+const (
+	PIIPlain PIIMode = "plain"
+	PIIMask  PIIMode = "mask"
+	PIIHash  PIIMode = "hash"
+	PIIDrop  PIIMode = "drop"
+)
+
+// ParsePIIMode validates a mode name.
+func ParsePIIMode(value string) (PIIMode, error) {
+	switch m := PIIMode(strings.ToLower(value)); m {
+	case PIIPlain, PIIMask, PIIHash, PIIDrop:
+		return m, nil
+	}
+	return "", fmt.Errorf("invalid pii mode %q, expected plain, mask, hash or drop", value)
+}
+
+var piiMode atomic.Value
+
+func init() {
+	piiMode.Store(PIIMask)
+}
+
+// SetPIIMode sets the process wide PII mode used by PII.
+func SetPIIMode(m PIIMode) {
+	piiMode.Store(m)
+}
+
+var piiHashKey atomic.Pointer[[]byte]
+
+// SetPIIHashKey sets the secret keying the HMAC written in hash mode, so the
+// few possible zipcodes cannot be hashed in advance to reverse it.
+func SetPIIHashKey(key []byte) {
+	piiHashKey.Store(&key)
+}
+
+// GetPIIMode returns the process wide PII mode.
+func GetPIIMode() PIIMode {
+	return piiMode.Load().(PIIMode)
+}
+
+// PII returns key set to value transformed by the current PII mode, or no
+// attribute at all in drop mode.
+func PII(key attribute.Key, value string) []attribute.KeyValue {
+	v, ok := PIIValue(value)
+	if !ok {
+		return nil
+	}
+	return []attribute.KeyValue{key.String(v)}
+}
+
+// PIIValue transforms value by the current PII mode. It reports false when
+// the value must be dropped, as in hash mode without a key.
+func PIIValue(value string) (string, bool) {
+	switch GetPIIMode() {
+	case PIIPlain:
+		return value, true
+	case PIIHash:
+		key := piiHashKey.Load()
+		if key == nil || len(*key) == 0 {
+			return "", false
+		}
+		mac := hmac.New(sha256.New, *key)
+		mac.Write([]byte(value))
+		return hex.EncodeToString(mac.Sum(nil)[:8]), true
+	case PIIDrop:
+		return "", false
+	default:
+		return mask(value), true
+	}
+}
+
+// mask keeps the first half of value, enough to tell the region of a
+// zipcode apart, and hides the rest.
+func mask(value string) string {
+	runes := []rune(value)
+	keep := len(runes) / 2
+	return string(runes[:keep]) + strings.Repeat("*", len(runes)-keep)
+}
@@ -0,0 +1,42 @@
+package tracing
+
+import (
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/attribute"
+	"testing"
+)
+
+func TestPII(t *testing.T) {
+	defer SetPIIMode(GetPIIMode())
+
+	SetPIIMode(PIIPlain)
+	assert.Equal(t, []attribute.KeyValue{ZipcodeKey.String("06835100")}, PII(ZipcodeKey, "06835100"))
+
+	SetPIIMode(PIIMask)
+	assert.Equal(t, []attribute.KeyValue{ZipcodeKey.String("0683****")}, PII(ZipcodeKey, "06835100"))
+
+	SetPIIMode(PIIHash)
+	SetPIIHashKey(nil)
+	assert.Empty(t, PII(ZipcodeKey, "06835100"))
+	SetPIIHashKey([]byte("secret"))
+	defer SetPIIHashKey(nil)
+	hashed := PII(ZipcodeKey, "06835100")
+	assert.Len(t, hashed, 1)
+	assert.Len(t, hashed[0].Value.AsString(), 16)
+	assert.NotContains(t, hashed[0].Value.AsString(), "06835100")
+	assert.Equal(t, hashed, PII(ZipcodeKey, "06835100"))
+	SetPIIHashKey([]byte("other"))
+	assert.NotEqual(t, hashed, PII(ZipcodeKey, "06835100"))
+
+	SetPIIMode(PIIDrop)
+	assert.Empty(t, PII(ZipcodeKey, "06835100"))
+}
+
+func TestParsePIIMode(t *testing.T) {
+	m, err := ParsePIIMode("HASH")
+	assert.Nil(t, err)
+	assert.Equal(t, PIIHash, m)
+
+	_, err = ParsePIIMode("encrypt")
+	assert.NotNil(t, err)
+}
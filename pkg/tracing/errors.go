@@ -0,0 +1,110 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+	"net"
+	"net/http"
+)
+
+// Error classes recorded on failed spans as error.class.
+const (
+	ErrorValidation          = "validation"
+	ErrorNotFound            = "not_found"
+	ErrorUpstreamTimeout     = "upstream_timeout"
+	ErrorUpstreamUnavailable = "upstream_unavailable"
+	ErrorUpstreamBadResponse = "upstream_bad_response"
+	ErrorCircuitOpen         = "circuit_open"
+	ErrorInternal            = "internal"
+)
+
+// ErrorClassKey is the span attribute holding the error classification.
+const ErrorClassKey = attribute.Key("error.class")
+
+type classifiedError struct {
+	class string
+	err   error
+}
+
+func (e *classifiedError) Error() string {
+	return e.err.Error()
+}
+
+func (e *classifiedError) Unwrap() error {
+	return e.err
+}
+
+// Classify attaches class to err without changing its message.
+func Classify(class string, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &classifiedError{class: class, err: err}
+}
+
+// ClassifyUpstream classifies an error returned while calling an upstream
+// dependency as a timeout or as the dependency being unavailable.
+func ClassifyUpstream(err error) error {
+	if err == nil {
+		return nil
+	}
+	var netErr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()) {
+		return Classify(ErrorUpstreamTimeout, err)
+	}
+	return Classify(ErrorUpstreamUnavailable, err)
+}
+
+// ClassifyStatus classifies err, an upstream dependency answering status:
+// 404 as not found and the other 4xx but 429 as a rejected input, caused by
+// the request rather than the dependency; 429 and the rest as a bad
+// response.
+func ClassifyStatus(status int, err error) error {
+	switch {
+	case status == http.StatusNotFound:
+		return Classify(ErrorNotFound, err)
+	case status >= http.StatusBadRequest && status < http.StatusInternalServerError && status != http.StatusTooManyRequests:
+		return Classify(ErrorValidation, err)
+	}
+	return Classify(ErrorUpstreamBadResponse, err)
+}
+
+// ErrorClass returns the class attached to err, or ErrorInternal.
+func ErrorClass(err error) string {
+	var ce *classifiedError
+	if errors.As(err, &ce) {
+		return ce.class
+	}
+	return ErrorInternal
+}
+
+// RecordError records err on span, marks the span as failed and sets the
+// error.type and error.class attributes.
+func RecordError(span trace.Span, err error) {
+	if err == nil {
+		return
+	}
+	class := ErrorClass(err)
+	span.RecordError(err, trace.WithAttributes(ErrorClassKey.String(class)))
+	span.SetStatus(codes.Error, err.Error())
+	span.SetAttributes(
+		semconv.ErrorTypeKey.String(errorType(err)),
+		ErrorClassKey.String(class),
+	)
+}
+
+// errorType is the type name of the innermost wrapped error.
+func errorType(err error) string {
+	for {
+		next := errors.Unwrap(err)
+		if next == nil {
+			return fmt.Sprintf("%T", err)
+		}
+		err = next
+	}
+}
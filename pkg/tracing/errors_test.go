@@ -0,0 +1,64 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/codes"
+	"net/url"
+	"testing"
+)
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func TestClassify(t *testing.T) {
+	err := Classify(ErrorNotFound, errors.New("error city notfound"))
+
+	assert.Equal(t, "error city notfound", err.Error())
+	assert.Equal(t, ErrorNotFound, ErrorClass(fmt.Errorf("wrapped: %w", err)))
+	assert.Equal(t, ErrorInternal, ErrorClass(errors.New("boom")))
+	assert.Nil(t, Classify(ErrorNotFound, nil))
+}
+
+func TestClassifyUpstream(t *testing.T) {
+	assert.Equal(t, ErrorUpstreamTimeout, ErrorClass(ClassifyUpstream(fmt.Errorf("error doing request %w", context.DeadlineExceeded))))
+	assert.Equal(t, ErrorUpstreamTimeout, ErrorClass(ClassifyUpstream(&url.Error{Op: "Get", URL: "http://viacep", Err: timeoutError{}})))
+	assert.Equal(t, ErrorUpstreamUnavailable, ErrorClass(ClassifyUpstream(errors.New("connection refused"))))
+}
+
+func TestClassifyStatus(t *testing.T) {
+	tests := map[int]string{
+		400: ErrorValidation,
+		404: ErrorNotFound,
+		422: ErrorValidation,
+		429: ErrorUpstreamBadResponse,
+		500: ErrorUpstreamBadResponse,
+		503: ErrorUpstreamBadResponse,
+		302: ErrorUpstreamBadResponse,
+	}
+	for status, class := range tests {
+		assert.Equal(t, class, ErrorClass(ClassifyStatus(status, errors.New("unexpected status"))), status)
+	}
+}
+
+func TestRecordError(t *testing.T) {
+	tp, sr := newRecorder()
+	_, span := tp.Tracer("test").Start(context.TODO(), "Viacep")
+
+	RecordError(span, Classify(ErrorUpstreamBadResponse, fmt.Errorf("error deconding request %w", &url.Error{Op: "Get", Err: errors.New("eof")})))
+	RecordError(span, nil)
+	span.End()
+
+	s := sr.Ended()[0]
+	assert.Equal(t, codes.Error, s.Status().Code)
+	assert.Equal(t, "error deconding request Get \"\": eof", s.Status().Description)
+	a := attrs(s)
+	assert.Equal(t, ErrorUpstreamBadResponse, a["error.class"].AsString())
+	assert.Equal(t, "*errors.errorString", a["error.type"].AsString())
+	assert.Equal(t, []string{"exception"}, eventNames(s))
+}
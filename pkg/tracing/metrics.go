@@ -0,0 +1,86 @@
+package tracing
+
+import (
+	"context"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"net/http"
+	"time"
+)
+
+// OutcomeKey labels upstream metrics with OutcomeSuccess or the error class
+// of the failed call.
+const OutcomeKey = attribute.Key("outcome")
+
+const OutcomeSuccess = "success"
+
+// serverMetrics are the RED metrics recorded by Middleware for every route.
+type serverMetrics struct {
+	requests metric.Int64Counter
+	errors   metric.Int64Counter
+	duration metric.Float64Histogram
+}
+
+func newServerMetrics(mp metric.MeterProvider) serverMetrics {
+	meter := mp.Meter(instrumentationName)
+	var m serverMetrics
+	m.requests, _ = meter.Int64Counter("http.server.requests",
+		metric.WithDescription("Number of HTTP requests handled."),
+		metric.WithUnit("{request}"))
+	m.errors, _ = meter.Int64Counter("http.server.errors",
+		metric.WithDescription("Number of HTTP requests answered with a 5xx status."),
+		metric.WithUnit("{request}"))
+	m.duration, _ = meter.Float64Histogram("http.server.request.duration",
+		metric.WithDescription("Duration of HTTP requests."),
+		metric.WithUnit("s"))
+	return m
+}
+
+func (m serverMetrics) record(ctx context.Context, method, route string, status int, elapsed time.Duration) {
+	attrs := metric.WithAttributes(
+		semconv.HTTPRequestMethodKey.String(method),
+		semconv.HTTPRoute(route),
+		semconv.HTTPResponseStatusCode(status),
+	)
+	m.requests.Add(ctx, 1, attrs)
+	if status >= http.StatusInternalServerError {
+		m.errors.Add(ctx, 1, attrs)
+	}
+	m.duration.Record(ctx, elapsed.Seconds(), attrs)
+}
+
+// UpstreamMetrics counts and times calls to an upstream dependency.
+type UpstreamMetrics struct {
+	requests metric.Int64Counter
+	duration metric.Float64Histogram
+}
+
+// NewUpstreamMetrics creates the upstream instruments on the meter provider
+// given by WithMeterProvider, or the global one.
+func NewUpstreamMetrics(opts ...Option) *UpstreamMetrics {
+	meter := newConfig(opts).mp.Meter(instrumentationName)
+	m := &UpstreamMetrics{}
+	m.requests, _ = meter.Int64Counter("upstream.requests",
+		metric.WithDescription("Number of calls to upstream dependencies."),
+		metric.WithUnit("{request}"))
+	m.duration, _ = meter.Float64Histogram("upstream.request.duration",
+		metric.WithDescription("Duration of calls to upstream dependencies."),
+		metric.WithUnit("s"))
+	return m
+}
+
+// Record records a call to provider that started at start and failed with
+// err, or succeeded when err is nil.
+func (m *UpstreamMetrics) Record(ctx context.Context, provider string, start time.Time, err error) {
+	if m == nil {
+		return
+	}
+	outcome := OutcomeSuccess
+	if err != nil {
+		outcome = ErrorClass(err)
+	}
+	attrs := metric.WithAttributes(UpstreamProviderKey.String(provider), OutcomeKey.String(outcome))
+	m.requests.Add(ctx, 1, attrs)
+	m.duration.Record(ctx, time.Since(start).Seconds(), attrs)
+}
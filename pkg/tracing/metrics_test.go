@@ -0,0 +1,74 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+	"willianszwy/FC-Tracing/pkg/health"
+)
+
+// sums collects the int64 sums of the metric called name keyed by the
+// value of attribute key.
+func sums(t *testing.T, reader *sdkmetric.ManualReader, name string, key attribute.Key) map[string]int64 {
+	var rm metricdata.ResourceMetrics
+	assert.Nil(t, reader.Collect(context.TODO(), &rm))
+	got := map[string]int64{}
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			if m.Name != name {
+				continue
+			}
+			for _, dp := range m.Data.(metricdata.Sum[int64]).DataPoints {
+				v, _ := dp.Attributes.Value(key)
+				got[v.Emit()] += dp.Value
+			}
+		}
+	}
+	return got
+}
+
+func TestMiddleware_Metrics(t *testing.T) {
+	reader := sdkmetric.NewManualReader()
+	mp := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+	tp, sr := newRecorder()
+	r := chi.NewRouter()
+	r.Use(Middleware(r, WithTracerProvider(tp), WithMeterProvider(mp), WithIgnoredRoutes("/metrics")))
+	r.Get("/ok", func(w http.ResponseWriter, r *http.Request) {})
+	r.Get("/fail", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	})
+	r.Get("/metrics", func(w http.ResponseWriter, r *http.Request) {})
+	r.Handle(health.LivenessRoute, health.Liveness())
+
+	for _, path := range []string{"/ok", "/ok", "/fail", "/metrics", health.LivenessRoute} {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	assert.Equal(t, map[string]int64{"/ok": 2, "/fail": 1}, sums(t, reader, "http.server.requests", "http.route"))
+	assert.Equal(t, map[string]int64{"/fail": 1}, sums(t, reader, "http.server.errors", "http.route"))
+	assert.Len(t, sr.Ended(), 3)
+}
+
+func TestUpstreamMetrics(t *testing.T) {
+	reader := sdkmetric.NewManualReader()
+	m := NewUpstreamMetrics(WithMeterProvider(sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))))
+
+	m.Record(context.TODO(), "viacep", time.Now(), nil)
+	m.Record(context.TODO(), "viacep", time.Now(), ClassifyUpstream(context.DeadlineExceeded))
+	m.Record(context.TODO(), "viacep", time.Now(), Classify(ErrorNotFound, errors.New("not found")))
+	m.Record(context.TODO(), "viacep", time.Now(), Classify(ErrorNotFound, errors.New("not found")))
+
+	assert.Equal(t, map[string]int64{
+		OutcomeSuccess:       1,
+		ErrorUpstreamTimeout: 1,
+		ErrorNotFound:        2,
+	}, sums(t, reader, "upstream.requests", OutcomeKey))
+}
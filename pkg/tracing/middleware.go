@@ -0,0 +1,193 @@
+package tracing
+
+import (
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"willianszwy/FC-Tracing/pkg/health"
+)
+
+const instrumentationName = "willianszwy/FC-Tracing/pkg/tracing"
+
+type config struct {
+	tp             trace.TracerProvider
+	mp             metric.MeterProvider
+	propagator     propagation.TextMapPropagator
+	redactedParams []string
+	ignoredRoutes  map[string]bool
+}
+
+// Option customizes the middleware and the transport.
+type Option func(*config)
+
+// WithTracerProvider uses tp instead of the global tracer provider.
+func WithTracerProvider(tp trace.TracerProvider) Option {
+	return func(c *config) {
+		c.tp = tp
+	}
+}
+
+// WithMeterProvider uses mp instead of the global meter provider.
+func WithMeterProvider(mp metric.MeterProvider) Option {
+	return func(c *config) {
+		c.mp = mp
+	}
+}
+
+// WithIgnoredRoutes makes the middleware skip requests matching one of the
+// route patterns, e.g. the metrics endpoint. The health endpoints are always
+// skipped.
+func WithIgnoredRoutes(routes ...string) Option {
+	return func(c *config) {
+		for _, r := range routes {
+			c.ignoredRoutes[r] = true
+		}
+	}
+}
+
+// WithPropagator uses p instead of the global propagator.
+func WithPropagator(p propagation.TextMapPropagator) Option {
+	return func(c *config) {
+		c.propagator = p
+	}
+}
+
+// WithRedactedParams adds query parameters, on top of
+// DefaultRedactedParams, whose values the transport hides.
+func WithRedactedParams(params ...string) Option {
+	return func(c *config) {
+		c.redactedParams = append(c.redactedParams, params...)
+	}
+}
+
+func newConfig(opts []Option) config {
+	c := config{
+		tp:            otel.GetTracerProvider(),
+		mp:            otel.GetMeterProvider(),
+		propagator:    otel.GetTextMapPropagator(),
+		ignoredRoutes: map[string]bool{health.LivenessRoute: true, health.ReadinessRoute: true},
+	}
+	for _, opt := range opts {
+		opt(&c)
+	}
+	return c
+}
+
+// Middleware returns a chi middleware that continues the caller's trace,
+// wraps every request in a server span named after the matched route
+// pattern and records the request count, error count and duration per
+// route. routes is the router the middleware is installed on, it is used to
+// resolve the pattern before the span starts.
+func Middleware(routes chi.Routes, opts ...Option) func(http.Handler) http.Handler {
+	cfg := newConfig(opts)
+	tr := cfg.tp.Tracer(instrumentationName)
+	metrics := newServerMetrics(cfg.mp)
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			route := matchRoute(routes, r)
+			if cfg.ignoredRoutes[route] {
+				next.ServeHTTP(w, r)
+				return
+			}
+			start := time.Now()
+			ctx := cfg.propagator.Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+
+			name := r.Method
+			if route != "" {
+				name += " " + route
+			}
+
+			ctx, span := tr.Start(ctx, name,
+				trace.WithSpanKind(trace.SpanKindServer),
+				trace.WithAttributes(serverAttributes(r, route)...),
+			)
+			defer span.End()
+
+			ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+			next.ServeHTTP(ww, r.WithContext(ctx))
+
+			status := ww.Status()
+			if status == 0 {
+				status = http.StatusOK
+			}
+			span.SetAttributes(
+				semconv.HTTPResponseStatusCode(status),
+				semconv.HTTPResponseBodySize(ww.BytesWritten()),
+			)
+			if status >= http.StatusInternalServerError {
+				span.SetStatus(codes.Error, http.StatusText(status))
+			}
+			metrics.record(ctx, r.Method, route, status, time.Since(start))
+		})
+	}
+}
+
+func matchRoute(routes chi.Routes, r *http.Request) string {
+	if routes == nil {
+		return ""
+	}
+	rctx := chi.NewRouteContext()
+	if !routes.Match(rctx, r.Method, r.URL.Path) {
+		return ""
+	}
+	return rctx.RoutePattern()
+}
+
+func serverAttributes(r *http.Request, route string) []attribute.KeyValue {
+	attrs := []attribute.KeyValue{
+		semconv.HTTPRequestMethodKey.String(r.Method),
+		semconv.URLPath(r.URL.Path),
+		semconv.URLScheme(scheme(r)),
+		semconv.NetworkProtocolVersion(strconv.Itoa(r.ProtoMajor) + "." + strconv.Itoa(r.ProtoMinor)),
+	}
+	if route != "" {
+		attrs = append(attrs, semconv.HTTPRoute(route))
+	}
+	if host, port := splitHostPort(r.Host); host != "" {
+		attrs = append(attrs, semconv.ServerAddress(host))
+		if port > 0 {
+			attrs = append(attrs, semconv.ServerPort(port))
+		}
+	}
+	if ip, _ := splitHostPort(r.RemoteAddr); ip != "" {
+		attrs = append(attrs, semconv.ClientAddress(ip))
+	}
+	if ua := r.UserAgent(); ua != "" {
+		attrs = append(attrs, semconv.UserAgentOriginal(ua))
+	}
+	if r.ContentLength >= 0 {
+		attrs = append(attrs, semconv.HTTPRequestBodySize(int(r.ContentLength)))
+	}
+	if id := middleware.GetReqID(r.Context()); id != "" {
+		attrs = append(attrs, attribute.String("http.request.id", id))
+	}
+	return attrs
+}
+
+func scheme(r *http.Request) string {
+	if r.TLS != nil {
+		return "https"
+	}
+	return "http"
+}
+
+func splitHostPort(hostport string) (string, int) {
+	host, port, err := net.SplitHostPort(hostport)
+	if err != nil {
+		return strings.Trim(hostport, "[]"), 0
+	}
+	p, _ := strconv.Atoi(port)
+	return host, p
+}
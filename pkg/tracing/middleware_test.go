@@ -0,0 +1,119 @@
+package tracing
+
+import (
+	"context"
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func newRecorder() (*sdktrace.TracerProvider, *tracetest.SpanRecorder) {
+	sr := tracetest.NewSpanRecorder()
+	return sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr)), sr
+}
+
+func attrs(span sdktrace.ReadOnlySpan) map[attribute.Key]attribute.Value {
+	m := map[attribute.Key]attribute.Value{}
+	for _, kv := range span.Attributes() {
+		m[kv.Key] = kv.Value
+	}
+	return m
+}
+
+func newRouter(tp trace.TracerProvider, status int) *chi.Mux {
+	r := chi.NewRouter()
+	r.Use(Middleware(r, WithTracerProvider(tp), WithPropagator(propagation.TraceContext{})))
+	r.Post("/temperature/{zipcode}", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+		w.Write([]byte(`{"city":"São Paulo"}`))
+	})
+	return r
+}
+
+func TestMiddleware(t *testing.T) {
+	tp, sr := newRecorder()
+	router := newRouter(tp, http.StatusOK)
+
+	req := httptest.NewRequest(http.MethodPost, "http://service-b:8080/temperature/06835100", strings.NewReader(`{}`))
+	req.RemoteAddr = "10.0.0.1:51000"
+	req.Header.Set("User-Agent", "curl/8.0")
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	spans := sr.Ended()
+	assert.Len(t, spans, 1)
+	span := spans[0]
+	assert.Equal(t, "POST /temperature/{zipcode}", span.Name())
+	assert.Equal(t, trace.SpanKindServer, span.SpanKind())
+	assert.Equal(t, codes.Unset, span.Status().Code)
+
+	a := attrs(span)
+	assert.Equal(t, "POST", a["http.request.method"].AsString())
+	assert.Equal(t, "/temperature/{zipcode}", a["http.route"].AsString())
+	assert.Equal(t, "/temperature/06835100", a["url.path"].AsString())
+	assert.Equal(t, "service-b", a["server.address"].AsString())
+	assert.Equal(t, int64(8080), a["server.port"].AsInt64())
+	assert.Equal(t, "10.0.0.1", a["client.address"].AsString())
+	assert.Equal(t, "curl/8.0", a["user_agent.original"].AsString())
+	assert.Equal(t, int64(2), a["http.request.body.size"].AsInt64())
+	assert.Equal(t, int64(200), a["http.response.status_code"].AsInt64())
+	assert.Equal(t, int64(len(`{"city":"São Paulo"}`)), a["http.response.body.size"].AsInt64())
+}
+
+func TestMiddleware_ServerErrorMarksSpan(t *testing.T) {
+	tp, sr := newRecorder()
+	router := newRouter(tp, http.StatusBadGateway)
+
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/temperature/1", nil))
+
+	span := sr.Ended()[0]
+	assert.Equal(t, codes.Error, span.Status().Code)
+	assert.Equal(t, int64(502), attrs(span)["http.response.status_code"].AsInt64())
+}
+
+func TestMiddleware_ClientErrorIsNotSpanError(t *testing.T) {
+	tp, sr := newRecorder()
+	router := newRouter(tp, http.StatusUnprocessableEntity)
+
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/temperature/1", nil))
+
+	assert.Equal(t, codes.Unset, sr.Ended()[0].Status().Code)
+}
+
+func TestMiddleware_ContinuesRemoteTrace(t *testing.T) {
+	tp, sr := newRecorder()
+	router := newRouter(tp, http.StatusOK)
+	parent := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    trace.TraceID{1, 2, 3},
+		SpanID:     trace.SpanID{4, 5, 6},
+		TraceFlags: trace.FlagsSampled,
+	})
+	req := httptest.NewRequest(http.MethodPost, "/temperature/1", nil)
+	propagation.TraceContext{}.Inject(trace.ContextWithSpanContext(context.TODO(), parent), propagation.HeaderCarrier(req.Header))
+
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	span := sr.Ended()[0]
+	assert.Equal(t, parent.TraceID(), span.SpanContext().TraceID())
+	assert.Equal(t, parent.SpanID(), span.Parent().SpanID())
+	assert.True(t, span.Parent().IsRemote())
+}
+
+func TestMiddleware_UnmatchedRoute(t *testing.T) {
+	tp, sr := newRecorder()
+	router := newRouter(tp, http.StatusOK)
+
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/unknown", nil))
+
+	span := sr.Ended()[0]
+	assert.Equal(t, "GET", span.Name())
+	assert.Equal(t, int64(404), attrs(span)["http.response.status_code"].AsInt64())
+}
@@ -0,0 +1,228 @@
+package tracing
+
+import (
+	"crypto/tls"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+	"io"
+	"net/http"
+	"net/http/httptrace"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+const redacted = "REDACTED"
+
+// DefaultRedactedParams are query parameters whose values never reach span
+// attributes.
+var DefaultRedactedParams = []string{"key", "api_key", "apikey", "token", "access_token", "password", "secret"}
+
+// Transport is an http.RoundTripper that wraps each request in a client
+// span, injects the propagation headers and records connection timings as
+// span events.
+type Transport struct {
+	base       http.RoundTripper
+	tracer     trace.Tracer
+	propagator propagation.TextMapPropagator
+	redact     map[string]bool
+}
+
+// NewTransport wraps base, or http.DefaultTransport when base is nil.
+func NewTransport(base http.RoundTripper, opts ...Option) *Transport {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	cfg := newConfig(opts)
+	return &Transport{
+		base:       base,
+		tracer:     cfg.tp.Tracer(instrumentationName),
+		propagator: cfg.propagator,
+		redact:     redactSet(cfg.redactedParams),
+	}
+}
+
+// NewClient returns an http.Client using an instrumented default transport.
+// It satisfies the HTTPClient interfaces used by the upstream clients.
+func NewClient(opts ...Option) *http.Client {
+	return &http.Client{Transport: NewTransport(nil, opts...)}
+}
+
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx, span := t.tracer.Start(req.Context(), req.Method,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(t.clientAttributes(req)...),
+	)
+
+	ctx = httptrace.WithClientTrace(ctx, clientTrace(span))
+	r := req.Clone(ctx)
+	t.propagator.Inject(ctx, propagation.HeaderCarrier(r.Header))
+
+	resp, err := t.base.RoundTrip(r)
+	if err != nil {
+		RecordError(span, ClassifyUpstream(err))
+		span.End()
+		return resp, err
+	}
+
+	span.SetAttributes(semconv.HTTPResponseStatusCode(resp.StatusCode))
+	if resp.ContentLength >= 0 {
+		span.SetAttributes(semconv.HTTPResponseBodySize(int(resp.ContentLength)))
+	}
+	if resp.StatusCode >= http.StatusBadRequest {
+		span.SetStatus(codes.Error, http.StatusText(resp.StatusCode))
+	}
+	resp.Body = &spanBody{ReadCloser: resp.Body, span: span}
+	return resp, nil
+}
+
+func (t *Transport) clientAttributes(req *http.Request) []attribute.KeyValue {
+	attrs := []attribute.KeyValue{
+		semconv.HTTPRequestMethodKey.String(req.Method),
+		semconv.URLFull(t.RedactURL(req.URL)),
+	}
+	if host, port := splitHostPort(req.URL.Host); host != "" {
+		attrs = append(attrs, semconv.ServerAddress(host))
+		if port == 0 {
+			port = defaultPort(req.URL.Scheme)
+		}
+		if port > 0 {
+			attrs = append(attrs, semconv.ServerPort(port))
+		}
+	}
+	if req.ContentLength > 0 {
+		attrs = append(attrs, semconv.HTTPRequestBodySize(int(req.ContentLength)))
+	}
+	return attrs
+}
+
+// RedactURL returns u as a string with the values of sensitive query
+// parameters and any user password replaced.
+func (t *Transport) RedactURL(u *url.URL) string {
+	return redactURL(u, t.redact)
+}
+
+// RedactURL redacts u using DefaultRedactedParams and the extra params.
+func RedactURL(u *url.URL, extra ...string) string {
+	return redactURL(u, redactSet(extra))
+}
+
+func redactSet(extra []string) map[string]bool {
+	redact := map[string]bool{}
+	for _, p := range DefaultRedactedParams {
+		redact[p] = true
+	}
+	for _, p := range extra {
+		redact[strings.ToLower(p)] = true
+	}
+	return redact
+}
+
+func redactURL(u *url.URL, redact map[string]bool) string {
+	if u == nil {
+		return ""
+	}
+	c := *u
+	if c.User != nil {
+		c.User = url.User(c.User.Username())
+	}
+	if c.RawQuery != "" {
+		q := c.Query()
+		for k := range q {
+			if redact[strings.ToLower(k)] {
+				q[k] = []string{redacted}
+			}
+		}
+		c.RawQuery = q.Encode()
+	}
+	return c.String()
+}
+
+func defaultPort(scheme string) int {
+	switch scheme {
+	case "http":
+		return 80
+	case "https":
+		return 443
+	}
+	return 0
+}
+
+// clientTrace records the connection phases of a request as span events.
+func clientTrace(span trace.Span) *httptrace.ClientTrace {
+	return &httptrace.ClientTrace{
+		DNSStart: func(info httptrace.DNSStartInfo) {
+			span.AddEvent("dns.start", trace.WithAttributes(attribute.String("net.host.name", info.Host)))
+		},
+		DNSDone: func(info httptrace.DNSDoneInfo) {
+			attrs := []attribute.KeyValue{attribute.Int("dns.addresses", len(info.Addrs))}
+			if info.Err != nil {
+				attrs = append(attrs, attribute.String("error.message", info.Err.Error()))
+			}
+			span.AddEvent("dns.done", trace.WithAttributes(attrs...))
+		},
+		ConnectStart: func(network, addr string) {
+			span.AddEvent("connect.start", trace.WithAttributes(attribute.String("network.peer.address", addr)))
+		},
+		ConnectDone: func(network, addr string, err error) {
+			attrs := []attribute.KeyValue{attribute.String("network.peer.address", addr)}
+			if err != nil {
+				attrs = append(attrs, attribute.String("error.message", err.Error()))
+			}
+			span.AddEvent("connect.done", trace.WithAttributes(attrs...))
+		},
+		TLSHandshakeStart: func() {
+			span.AddEvent("tls.start")
+		},
+		TLSHandshakeDone: func(state tls.ConnectionState, err error) {
+			attrs := []attribute.KeyValue{attribute.String("tls.version", tls.VersionName(state.Version))}
+			if err != nil {
+				attrs = append(attrs, attribute.String("error.message", err.Error()))
+			}
+			span.AddEvent("tls.done", trace.WithAttributes(attrs...))
+		},
+		GotConn: func(info httptrace.GotConnInfo) {
+			span.AddEvent("got.conn", trace.WithAttributes(attribute.Bool("reused", info.Reused)))
+		},
+		WroteRequest: func(info httptrace.WroteRequestInfo) {
+			span.AddEvent("wrote.request")
+		},
+		GotFirstResponseByte: func() {
+			span.AddEvent("first.byte")
+		},
+	}
+}
+
+// spanBody ends the client span once the response body is fully read or
+// closed, so the span covers the whole transfer.
+type spanBody struct {
+	io.ReadCloser
+	span trace.Span
+	once sync.Once
+}
+
+func (b *spanBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if err == io.EOF {
+		b.end()
+	} else if err != nil {
+		b.span.RecordError(err)
+		b.end()
+	}
+	return n, err
+}
+
+func (b *spanBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.end()
+	return err
+}
+
+func (b *spanBody) end() {
+	b.once.Do(func() {
+		b.span.End()
+	})
+}